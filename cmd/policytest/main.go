@@ -0,0 +1,52 @@
+// Command policytest runs policy test files, and exits with a non-zero status if any case fails.
+//
+//	policytest [-v] [-json] path...
+//
+// Paths are test files, or directories searched for files ending in .test.yaml.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/theonlyrob/vercer/webserver/pkg/predicates"
+)
+
+func main() {
+	verbose := flag.Bool("v", false, "list passing cases too")
+	asJSON := flag.Bool("json", false, "print the results as JSON")
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: policytest [-v] [-json] path...")
+		os.Exit(2)
+	}
+
+	results, err := (&predicates.PolicyTestRunner{}).Run(flag.Args()...)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	failed := 0
+	for _, result := range results {
+		if !result.Passed() {
+			failed++
+		}
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		_ = encoder.Encode(results)
+	} else {
+		for _, result := range results {
+			if *verbose || !result.Passed() {
+				fmt.Println(result)
+			}
+		}
+		fmt.Printf("%d of %d case(s) failed\n", failed, len(results))
+	}
+	if failed != 0 {
+		os.Exit(1)
+	}
+}
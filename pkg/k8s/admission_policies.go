@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/theonlyrob/vercer/webserver/pkg/predicates"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+var validatingAdmissionPolicies = schema.GroupVersionResource{
+	Group:    "admissionregistration.k8s.io",
+	Version:  "v1",
+	Resource: "validatingadmissionpolicies",
+}
+
+// ImportAdmissionPolicies reads the ValidatingAdmissionPolicy objects of the cluster, and translates them into policies
+// for objects of the example's type, which TestPods can check existing pods against.
+func ImportAdmissionPolicies(example interface{}) ([]*predicates.AdmissionPolicyImport, error) {
+	client, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	list, err := client.Resource(validatingAdmissionPolicies).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	imports := make([]*predicates.AdmissionPolicyImport, 0, len(list.Items))
+	for _, item := range list.Items {
+		vap := &predicates.ValidatingAdmissionPolicy{}
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(item.Object, vap); err != nil {
+			return nil, err
+		}
+		imports = append(imports, predicates.ImportAdmissionPolicy(example, vap))
+	}
+	return imports, nil
+}
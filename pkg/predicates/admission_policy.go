@@ -0,0 +1,440 @@
+package predicates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/ast"
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ValidatingAdmissionPolicy holds the parts of an admissionregistration.k8s.io ValidatingAdmissionPolicy that are
+// imported, in the same json form. The API version of the client library in use predates the type.
+type ValidatingAdmissionPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              ValidatingAdmissionPolicySpec `json:"spec"`
+}
+
+type ValidatingAdmissionPolicySpec struct {
+	ParamKind        *AdmissionParamKind        `json:"paramKind,omitempty"`
+	MatchConstraints *AdmissionMatchResources   `json:"matchConstraints,omitempty"`
+	Validations      []AdmissionValidation      `json:"validations,omitempty"`
+	FailurePolicy    string                     `json:"failurePolicy,omitempty"`
+	AuditAnnotations []AdmissionAuditAnnotation `json:"auditAnnotations,omitempty"`
+	MatchConditions  []AdmissionMatchCondition  `json:"matchConditions,omitempty"`
+	Variables        []AdmissionVariable        `json:"variables,omitempty"`
+}
+
+type AdmissionParamKind struct {
+	APIVersion string `json:"apiVersion,omitempty"`
+	Kind       string `json:"kind,omitempty"`
+}
+
+type AdmissionMatchResources struct {
+	NamespaceSelector    *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+	ObjectSelector       *metav1.LabelSelector `json:"objectSelector,omitempty"`
+	ResourceRules        []AdmissionRule       `json:"resourceRules,omitempty"`
+	ExcludeResourceRules []AdmissionRule       `json:"excludeResourceRules,omitempty"`
+}
+
+type AdmissionRule struct {
+	ResourceNames []string `json:"resourceNames,omitempty"`
+	Operations    []string `json:"operations,omitempty"`
+	APIGroups     []string `json:"apiGroups,omitempty"`
+	APIVersions   []string `json:"apiVersions,omitempty"`
+	Resources     []string `json:"resources,omitempty"`
+}
+
+type AdmissionValidation struct {
+	Expression        string `json:"expression"`
+	Message           string `json:"message,omitempty"`
+	Reason            string `json:"reason,omitempty"`
+	MessageExpression string `json:"messageExpression,omitempty"`
+}
+
+type AdmissionAuditAnnotation struct {
+	Key             string `json:"key"`
+	ValueExpression string `json:"valueExpression"`
+}
+
+type AdmissionMatchCondition struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+}
+
+type AdmissionVariable struct {
+	Name       string `json:"name"`
+	Expression string `json:"expression"`
+}
+
+// ParseAdmissionPolicies reads the ValidatingAdmissionPolicy objects of a JSON or YAML stream, which may hold several
+// documents and lists. Objects of other kinds, such as policy bindings, are skipped.
+func ParseAdmissionPolicies(data []byte) ([]*ValidatingAdmissionPolicy, error) {
+	var policies []*ValidatingAdmissionPolicy
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	for {
+		var object map[string]interface{}
+		if err := decoder.Decode(&object); err == io.EOF {
+			return policies, nil
+		} else if err != nil {
+			return nil, err
+		}
+		found, err := admissionPolicies(object)
+		if err != nil {
+			return nil, err
+		}
+		policies = append(policies, found...)
+	}
+}
+
+func admissionPolicies(object map[string]interface{}) ([]*ValidatingAdmissionPolicy, error) {
+	if object == nil {
+		return nil, nil
+	}
+	if items, ok := object["items"].([]interface{}); ok {
+		var policies []*ValidatingAdmissionPolicy
+		for _, item := range items {
+			itemObject, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, fmt.Errorf("expected list items to be objects, found %T", item)
+			}
+			found, err := admissionPolicies(itemObject)
+			if err != nil {
+				return nil, err
+			}
+			policies = append(policies, found...)
+		}
+		return policies, nil
+	}
+	if object["kind"] != "ValidatingAdmissionPolicy" {
+		return nil, nil
+	}
+	encoded, err := json.Marshal(object)
+	if err != nil {
+		return nil, err
+	}
+	policy := &ValidatingAdmissionPolicy{}
+	if err := json.Unmarshal(encoded, policy); err != nil {
+		return nil, fmt.Errorf("invalid ValidatingAdmissionPolicy: %v", err)
+	}
+	return []*ValidatingAdmissionPolicy{policy}, nil
+}
+
+// AdmissionPolicyImport is the outcome of importing a ValidatingAdmissionPolicy. Policy holds the validations that were
+// translated, and is nil if none were. Untranslated lists the parts of the admission policy that were left out.
+type AdmissionPolicyImport struct {
+	Policy       *Policy             `json:"policy,omitempty"`
+	Untranslated []*UntranslatedRule `json:"untranslated,omitempty"`
+}
+
+// UntranslatedRule is a part of an admission policy that has no equivalent predicate.
+type UntranslatedRule struct {
+	// Field is the path of the part in the admission policy, e.g. spec.validations[1].
+	Field      string `json:"field"`
+	Expression string `json:"expression,omitempty"`
+	Reason     string `json:"reason"`
+}
+
+func (r *UntranslatedRule) String() string {
+	if r.Expression == "" {
+		return fmt.Sprintf("%s: %s", r.Field, r.Reason)
+	}
+	return fmt.Sprintf("%s: %s: `%s`", r.Field, r.Reason, r.Expression)
+}
+
+// admissionVariablesRegexp matches references to the variables of an admission policy.
+var admissionVariablesRegexp = regexp.MustCompile(`\bvariables\.([A-Za-z_][A-Za-z0-9_]*)`)
+
+// celTypeNames are the identifiers CEL declares for its types.
+var celTypeNames = map[string]bool{
+	"bool": true, "bytes": true, "double": true, "duration": true, "dyn": true, "int": true, "list": true, "map": true,
+	"null_type": true, "string": true, "timestamp": true, "type": true, "uint": true,
+}
+
+// ImportAdmissionPolicy translates the validations of an admission policy into a policy for objects of the example's
+// type, so that objects admitted before the admission policy existed can be audited.
+//
+// Validations made of comparisons of fields to literals, has() tests and the logical operators become native
+// predicates, and the others become CEL predicates, which see the admitted object as `object` like the admission
+// policy does. Variables are inlined. Validations that depend on the admission request (oldObject, request, params,
+// namespaceObject or authorizer), or that do not type-check against the example, are left out and reported, as are
+// message expressions, audit annotations and object and namespace selectors. Match conditions restrict the
+// validations to the objects they hold for; if one of them cannot be translated, nothing is.
+func ImportAdmissionPolicy(example interface{}, vap *ValidatingAdmissionPolicy) *AdmissionPolicyImport {
+	i := &admissionImporter{
+		pf:        NewPredicateFactory(example),
+		example:   reflect.TypeOf(example),
+		variables: map[string]string{},
+		result:    &AdmissionPolicyImport{},
+	}
+	for _, variable := range vap.Spec.Variables {
+		i.variables[variable.Name] = fmt.Sprintf("(%s)", i.inline(variable.Expression))
+	}
+	var conditions []*PredicateDescriptor
+	for n, condition := range vap.Spec.MatchConditions {
+		field := fmt.Sprintf("spec.matchConditions[%d]", n)
+		d := i.translate(field, condition.Expression, "")
+		if d == nil {
+			i.skip(field, "", "the validations only apply where this condition holds, so none were imported")
+			return i.result
+		}
+		conditions = append(conditions, d)
+	}
+	var validations []*PredicateDescriptor
+	for n, validation := range vap.Spec.Validations {
+		field := fmt.Sprintf("spec.validations[%d]", n)
+		if d := i.translate(field, validation.Expression, validation.Message); d != nil {
+			validations = append(validations, d)
+		}
+		if validation.MessageExpression != "" {
+			i.skip(field+".messageExpression", validation.MessageExpression, "message expressions are not evaluated")
+		}
+	}
+	for n, annotation := range vap.Spec.AuditAnnotations {
+		i.skip(fmt.Sprintf("spec.auditAnnotations[%d]", n), annotation.ValueExpression, "audit annotations are not evaluated")
+	}
+	if match := vap.Spec.MatchConstraints; match != nil {
+		if match.NamespaceSelector != nil && (len(match.NamespaceSelector.MatchLabels) != 0 || len(match.NamespaceSelector.MatchExpressions) != 0) {
+			i.skip("spec.matchConstraints.namespaceSelector", "", "namespace selectors are not applied")
+		}
+		if match.ObjectSelector != nil && (len(match.ObjectSelector.MatchLabels) != 0 || len(match.ObjectSelector.MatchExpressions) != 0) {
+			i.skip("spec.matchConstraints.objectSelector", "", "object selectors are not applied")
+		}
+	}
+	if len(validations) == 0 {
+		return i.result
+	}
+	d := conjunction(validations)
+	if len(conditions) != 0 {
+		d = Disjunction(Not(conjunction(conditions)), d)
+	}
+	policy := NewPolicy(vap.Name, ERROR_SEVERITY, d)
+	policy.Category = "admission"
+	policy.Description = fmt.Sprintf("Imported from ValidatingAdmissionPolicy %s.", vap.Name)
+	i.result.Policy = policy
+	return i.result
+}
+
+type admissionImporter struct {
+	pf        PredicateFactory
+	example   reflect.Type
+	variables map[string]string
+	result    *AdmissionPolicyImport
+}
+
+func (i *admissionImporter) skip(field, expression, reason string) {
+	i.result.Untranslated = append(i.result.Untranslated, &UntranslatedRule{Field: field, Expression: expression, Reason: reason})
+}
+
+// inline replaces references to known variables by their expressions. Variables may refer to those declared before
+// them, which are already inlined.
+func (i *admissionImporter) inline(expression string) string {
+	return admissionVariablesRegexp.ReplaceAllStringFunc(expression, func(reference string) string {
+		if inlined, ok := i.variables[strings.TrimPrefix(reference, "variables.")]; ok {
+			return inlined
+		}
+		return reference
+	})
+}
+
+// translate turns an expression into a descriptor that builds for the example type, or reports why it cannot.
+func (i *admissionImporter) translate(field, expression, message string) *PredicateDescriptor {
+	rule := i.inline(expression)
+	env, err := cel.NewEnv()
+	if err != nil {
+		i.skip(field, expression, err.Error())
+		return nil
+	}
+	parsed, issues := env.Parse(rule)
+	if issues != nil && issues.Err() != nil {
+		i.skip(field, expression, fmt.Sprintf("invalid expression: %v", issues.Err()))
+		return nil
+	}
+	root := ast.NavigateCheckedAST(&ast.CheckedAST{Expr: parsed.Expr()})
+	if unknown := unboundIdentifiers(root); len(unknown) != 0 {
+		i.skip(field, expression, fmt.Sprintf("refers to %s, which only exist at admission", strings.Join(unknown, ", ")))
+		return nil
+	}
+	var buildErr error
+	// Native paths fan out over the lists they cross, where CEL selects fields of the list itself and rejects the
+	// expression, so such paths stay in CEL.
+	if native := nativeDescriptor(root); native != nil && !crossesList(native, i.example) {
+		if _, buildErr = i.pf.Build(native); buildErr == nil {
+			return native
+		}
+	}
+	d := &PredicateDescriptor{CEL: &CELPredicateDescriptor{Rule: rule, Message: message}}
+	if _, err := i.pf.Build(d); err != nil {
+		i.skip(field, expression, err.Error())
+		return nil
+	}
+	return d
+}
+
+// unboundIdentifiers lists the identifiers of an expression other than `object`, the variables of its macros and the
+// names of CEL types.
+func unboundIdentifiers(root ast.NavigableExpr) []string {
+	bound := map[string]bool{"object": true}
+	for _, e := range ast.MatchDescendants(root, ast.KindMatcher(ast.ComprehensionKind)) {
+		bound[e.AsComprehension().IterVar()] = true
+		bound[e.AsComprehension().AccuVar()] = true
+	}
+	found := map[string]bool{}
+	for _, e := range ast.MatchDescendants(root, ast.KindMatcher(ast.IdentKind)) {
+		if name := e.AsIdent(); !bound[name] && !celTypeNames[name] {
+			found[name] = true
+		}
+	}
+	var names []string
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var admissionComparisons = map[string]string{
+	"_==_": opEqual, "_!=_": opNotEqual, "_<_": opLess, "_<=_": opLessEqual, "_>_": opGreater, "_>=_": opGreaterEqual,
+}
+
+// flippedComparisons gives the operator comparing the operands the other way around.
+var flippedComparisons = map[string]string{
+	opEqual: opEqual, opNotEqual: opNotEqual, opLess: opGreater, opLessEqual: opGreaterEqual, opGreater: opLess, opGreaterEqual: opLessEqual,
+}
+
+// nativeDescriptor translates an expression made only of comparisons of object fields to literals, has() tests and
+// logical operators. It returns nil for any other expression.
+func nativeDescriptor(e ast.NavigableExpr) *PredicateDescriptor {
+	switch e.Kind() {
+	case ast.SelectKind:
+		if !e.AsSelect().IsTestOnly() {
+			return nil
+		}
+		path, ok := objectPath(e.AsSelect().Operand())
+		if !ok {
+			return nil
+		}
+		return Exists(formatKey(path, e.AsSelect().FieldName()))
+	case ast.CallKind:
+	default:
+		return nil
+	}
+	call := e.AsCall()
+	args := call.Args()
+	switch call.FunctionName() {
+	case "!_":
+		if child := nativeDescriptor(args[0]); child != nil {
+			return Not(child)
+		}
+		return nil
+	case "_&&_", "_||_":
+		left, right := nativeDescriptor(args[0]), nativeDescriptor(args[1])
+		if left == nil || right == nil {
+			return nil
+		}
+		if call.FunctionName() == "_&&_" {
+			return conjunction([]*PredicateDescriptor{left, right})
+		}
+		return disjunction([]*PredicateDescriptor{left, right})
+	}
+	op, ok := admissionComparisons[call.FunctionName()]
+	if !ok || len(args) != 2 {
+		return nil
+	}
+	path, ok := objectPath(args[0])
+	literal := args[1]
+	if !ok {
+		path, ok = objectPath(args[1])
+		literal, op = args[0], flippedComparisons[op]
+	}
+	if !ok || literal.Kind() != ast.LiteralKind || path == "" {
+		return nil
+	}
+	var base *PredicateDescriptor
+	switch value := literal.AsLiteral().Value().(type) {
+	case int64:
+		base = NumberValue(op + strconv.FormatInt(value, 10))
+	case uint64:
+		base = NumberValue(op + strconv.FormatUint(value, 10))
+	case float64:
+		base = NumberValue(op + strconv.FormatFloat(value, 'g', -1, 64))
+	case string:
+		if op != opEqual && op != opNotEqual {
+			return nil
+		}
+		base = StringValue(op + value)
+	case bool:
+		if op != opEqual && op != opNotEqual {
+			return nil
+		}
+		base = BooleanValue(op + strconv.FormatBool(value))
+	default:
+		return nil
+	}
+	return Field(path, base)
+}
+
+// objectPath gives the field path a chain of field selections and map lookups on `object` reads.
+func objectPath(e ast.NavigableExpr) (string, bool) {
+	switch e.Kind() {
+	case ast.IdentKind:
+		return "", e.AsIdent() == "object"
+	case ast.SelectKind:
+		if e.AsSelect().IsTestOnly() {
+			return "", false
+		}
+		path, ok := objectPath(e.AsSelect().Operand())
+		return formatKey(path, e.AsSelect().FieldName()), ok
+	case ast.CallKind:
+		call := e.AsCall()
+		if call.FunctionName() != "_[_]" || call.Args()[1].Kind() != ast.LiteralKind {
+			return "", false
+		}
+		key, isString := call.Args()[1].AsLiteral().Value().(string)
+		path, ok := objectPath(call.Args()[0])
+		return formatKey(path, key), ok && isString
+	}
+	return "", false
+}
+
+// conjunction joins descriptors with And, merging nested Ands and leaving a single descriptor as it is.
+func conjunction(ds []*PredicateDescriptor) *PredicateDescriptor {
+	var flat []*PredicateDescriptor
+	for _, d := range ds {
+		if descriptorKind(d) == "and" {
+			flat = append(flat, d.And...)
+		} else {
+			flat = append(flat, d)
+		}
+	}
+	if len(flat) == 1 {
+		return flat[0]
+	}
+	return Conjunction(flat...)
+}
+
+// disjunction joins descriptors with Or, like conjunction.
+func disjunction(ds []*PredicateDescriptor) *PredicateDescriptor {
+	var flat []*PredicateDescriptor
+	for _, d := range ds {
+		if descriptorKind(d) == "or" {
+			flat = append(flat, d.Or...)
+		} else {
+			flat = append(flat, d)
+		}
+	}
+	if len(flat) == 1 {
+		return flat[0]
+	}
+	return Disjunction(flat...)
+}
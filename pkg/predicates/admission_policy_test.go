@@ -0,0 +1,106 @@
+package predicates
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestImportAdmissionPolicy(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/admission-policy.yaml")
+	require.NoError(t, err)
+	vaps, err := ParseAdmissionPolicies(data)
+	require.NoError(t, err)
+	require.Len(t, vaps, 1)
+
+	imported := ImportAdmissionPolicy(v1.Pod{}, vaps[0])
+	require.NotNil(t, imported.Policy)
+	var untranslated []string
+	for _, r := range imported.Untranslated {
+		untranslated = append(untranslated, r.Field)
+	}
+	assert.Equal(t, []string{
+		"spec.validations[1].messageExpression",
+		"spec.validations[2]",
+		"spec.validations[3]",
+		"spec.validations[4]",
+		"spec.auditAnnotations[0]",
+	}, untranslated)
+	assert.Contains(t, imported.Untranslated[1].String(), "refers to oldObject")
+	assert.Contains(t, imported.Untranslated[3].String(), "undefined field 'replicas'")
+
+	// The match condition and the host network check are native, the image check is kept as CEL.
+	d := imported.Policy.Descriptor
+	assert.Equal(t, Disjunction(
+		Not(Field("metadata.namespace", StringValue("!=kube-system"))),
+		Conjunction(
+			Disjunction(Not(Exists("spec.hostNetwork")), Field("spec.hostNetwork", BooleanValue("==false"))),
+			&PredicateDescriptor{CEL: &CELPredicateDescriptor{
+				Rule:    `(object.spec.containers).all(c, c.image.lowerAscii().startsWith("registry.example.com/"))`,
+				Message: "images come from the internal registry",
+			}},
+		),
+	), d)
+	assert.Empty(t, Lint(v1.Pod{}, d))
+
+	pred, err := BuildPolicy(NewPredicateFactory(v1.Pod{}), imported.Policy)
+	require.NoError(t, err)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "default"},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Image: "Registry.example.com/app"}}},
+	}
+	assert.NoError(t, pred(pod))
+	pod.Spec.HostNetwork = true
+	assert.Error(t, pred(pod))
+	pod.Spec.HostNetwork = false
+	pod.Spec.Containers = append(pod.Spec.Containers, v1.Container{Image: "docker.io/app"})
+	err = pred(pod)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "images come from the internal registry")
+	pod.Namespace = "kube-system"
+	assert.NoError(t, pred(pod))
+}
+
+func TestImportAdmissionPolicyConditions(t *testing.T) {
+	vap := &ValidatingAdmissionPolicy{Spec: ValidatingAdmissionPolicySpec{
+		MatchConditions: []AdmissionMatchCondition{{Name: "user", Expression: `request.userInfo.username != "admin"`}},
+		Validations:     []AdmissionValidation{{Expression: `object.spec.priority >= 0`}},
+	}}
+	imported := ImportAdmissionPolicy(v1.Pod{}, vap)
+	assert.Nil(t, imported.Policy)
+	require.Len(t, imported.Untranslated, 2)
+	assert.Equal(t, "spec.matchConditions[0]", imported.Untranslated[1].Field)
+
+	vap.Spec.MatchConditions = nil
+	vap.Name = "priority"
+	imported = ImportAdmissionPolicy(v1.Pod{}, vap)
+	require.NotNil(t, imported.Policy)
+	assert.Empty(t, imported.Untranslated)
+	assert.Equal(t, Field("spec.priority", NumberValue(">=0")), imported.Policy.Descriptor)
+
+	vaps, err := ParseAdmissionPolicies([]byte(`{kind: List, items: [{kind: ValidatingAdmissionPolicy, metadata: {name: a}},
+		{kind: ValidatingAdmissionPolicy, metadata: {name: b}}]}`))
+	require.NoError(t, err)
+	require.Len(t, vaps, 2)
+	assert.Equal(t, "b", vaps[1].Name)
+}
+
+func TestImportAdmissionPolicyLists(t *testing.T) {
+	// CEL selects fields of a list itself rather than of its elements, so these do not type-check, and must not become
+	// native fields that fan out over the containers.
+	vap := &ValidatingAdmissionPolicy{Spec: ValidatingAdmissionPolicySpec{Validations: []AdmissionValidation{
+		{Expression: `object.spec.containers.image == "x"`},
+		{Expression: `has(object.spec.containers.image)`},
+		{Expression: `object.spec.priority >= 0`},
+	}}}
+	imported := ImportAdmissionPolicy(v1.Pod{}, vap)
+	require.NotNil(t, imported.Policy)
+	assert.Equal(t, Field("spec.priority", NumberValue(">=0")), imported.Policy.Descriptor)
+	require.Len(t, imported.Untranslated, 2)
+	assert.Equal(t, "spec.validations[0]", imported.Untranslated[0].Field)
+	assert.Equal(t, "spec.validations[1]", imported.Untranslated[1].Field)
+}
@@ -0,0 +1,629 @@
+package predicates
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// Comparison operators understood by base value descriptors. A descriptor value is an operator followed by its
+// operand, e.g. `>=0` or `==latest`. String values with no operator are treated as regular expressions.
+const (
+	opEqual        = "=="
+	opNotEqual     = "!="
+	opLessEqual    = "<="
+	opGreaterEqual = ">="
+	opLess         = "<"
+	opGreater      = ">"
+	opMatch        = "=~"
+	opNotMatch     = "!~"
+)
+
+// Longer operators must come first so that `<=` is not read as `<`.
+var operators = []string{opEqual, opNotEqual, opLessEqual, opGreaterEqual, opMatch, opNotMatch, opLess, opGreater}
+
+var (
+	timeType         = reflect.TypeOf(time.Time{})
+	metaTimeType     = reflect.TypeOf(metav1.Time{})
+	microTimeType    = reflect.TypeOf(metav1.MicroTime{})
+	intOrStringType  = reflect.TypeOf(intstr.IntOrString{})
+	quantityType     = reflect.TypeOf(resource.Quantity{})
+	durationType     = reflect.TypeOf(time.Duration(0))
+	metaDurationType = reflect.TypeOf(metav1.Duration{})
+)
+
+// splitOperator separates the leading operator of a descriptor value from its operand. An empty operator is returned
+// if the value does not start with one.
+func splitOperator(value string) (string, string) {
+	value = strings.TrimSpace(value)
+	for _, op := range operators {
+		if strings.HasPrefix(value, op) {
+			return op, strings.TrimSpace(strings.TrimPrefix(value, op))
+		}
+	}
+	return "", value
+}
+
+// parseValueMatcher compiles the value of a base descriptor. Relative datetime values are evaluated against clock.
+func parseValueMatcher(fType FieldType, value string, clock func() time.Time) (valueMatcher, error) {
+	switch fType {
+	case STRING_FIELD:
+		return parseTextPredicate(value)
+	case URI_FIELD:
+		return parseURIPredicate(value)
+	case NUMERICAL_FIELD:
+		return parseNumberPredicate(value)
+	case DATETIME_FIELD:
+		return parseDatePredicate(value, clock)
+	case BOOLEAN_FIELD:
+		return parseBooleanPredicate(value)
+	case QUANTITY_FIELD:
+		return parseQuantityPredicate(value)
+	case DURATION_FIELD:
+		return parseDurationPredicate(value)
+	default:
+		return nil, fmt.Errorf("cannot handle field of type %d", fType)
+	}
+}
+
+func parseTextPredicate(value string) (valueMatcher, error) {
+	op, operand := splitOperator(value)
+	if op == "" && operand == "" {
+		return func(v reflect.Value) bool {
+			_, ok := stringOf(v)
+			return ok
+		}, nil
+	}
+	match, err := parseStringMatcher(op, operand)
+	if err != nil {
+		return nil, err
+	}
+	return func(v reflect.Value) bool {
+		str, ok := stringOf(v)
+		return ok && match(str)
+	}, nil
+}
+
+func parseStringMatcher(op, operand string) (func(string) bool, error) {
+	switch op {
+	case opEqual:
+		return func(s string) bool { return s == operand }, nil
+	case opNotEqual:
+		return func(s string) bool { return s != operand }, nil
+	case "", opMatch, opNotMatch:
+		re, err := regexp.Compile(operand)
+		if err != nil {
+			return nil, err
+		}
+		if op == opNotMatch {
+			return func(s string) bool { return !re.MatchString(s) }, nil
+		}
+		return re.MatchString, nil
+	default:
+		return nil, fmt.Errorf("operator %s cannot be applied to text: %s", op, operand)
+	}
+}
+
+func parseURIPredicate(value string) (valueMatcher, error) {
+	op, operand := splitOperator(value)
+	var match func(string) bool
+	if op == opEqual || op == opNotEqual {
+		// Compare URIs in their normalized form, so that differences in case of the scheme and host are ignored.
+		want, err := parseURI(operand)
+		if err != nil {
+			return nil, err
+		}
+		match = func(s string) bool {
+			got, err := parseURI(s)
+			return err == nil && (got.String() == want.String()) == (op == opEqual)
+		}
+	} else if op != "" || operand != "" {
+		var err error
+		if match, err = parseStringMatcher(op, operand); err != nil {
+			return nil, err
+		}
+	}
+	return func(v reflect.Value) bool {
+		str, ok := stringOf(v)
+		if !ok {
+			return false
+		}
+		if _, err := parseURI(str); err != nil {
+			return false
+		}
+		return match == nil || match(str)
+	}, nil
+}
+
+func parseURI(str string) (*url.URL, error) {
+	u, err := url.Parse(str)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme == "" && u.Host == "" && u.Path == "" {
+		return nil, fmt.Errorf("empty uri: %s", str)
+	}
+	u.Scheme = strings.ToLower(u.Scheme)
+	u.Host = strings.ToLower(u.Host)
+	return u, nil
+}
+
+func parseNumberPredicate(value string) (valueMatcher, error) {
+	op, operand := splitOperator(value)
+	if op == "" && operand == "" {
+		return func(v reflect.Value) bool {
+			_, ok := numberOf(v)
+			return ok
+		}, nil
+	}
+	num, err := parseNum(operand)
+	if err != nil {
+		return nil, err
+	}
+	compare, err := comparison(op, operand)
+	if err != nil {
+		return nil, err
+	}
+	return func(v reflect.Value) bool {
+		got, ok := numberOf(v)
+		return ok && compare(compareFloats(got, num))
+	}, nil
+}
+
+func parseNum(strNum string) (float64, error) {
+	num, err := strconv.ParseFloat(strNum, 64)
+	if err != nil {
+		return 0, err
+	}
+	return num, err
+}
+
+func compareFloats(a, b float64) int {
+	if a < b {
+		return -1
+	} else if a > b {
+		return 1
+	}
+	return 0
+}
+
+// Relative datetime values compare the age of a timestamp, e.g. `olderThan 30d` or `newerThan 1h30m`.
+const (
+	olderThan = "olderThan"
+	newerThan = "newerThan"
+)
+
+func parseDatePredicate(value string, clock func() time.Time) (valueMatcher, error) {
+	if relation, age, ok := splitRelativeDate(value); ok {
+		maxAge, err := parseAge(age)
+		if err != nil {
+			return nil, err
+		}
+		return func(v reflect.Value) bool {
+			got, ok := timeOf(v)
+			if !ok {
+				return false
+			}
+			cutoff := clock().Add(-maxAge)
+			if relation == olderThan {
+				return got.Before(cutoff)
+			}
+			return got.After(cutoff)
+		}, nil
+	}
+	op, operand := splitOperator(value)
+	if op == "" && operand == "" {
+		return func(v reflect.Value) bool {
+			_, ok := timeOf(v)
+			return ok
+		}, nil
+	}
+	date, err := parseDate(operand)
+	if err != nil {
+		return nil, err
+	}
+	compare, err := comparison(op, operand)
+	if err != nil {
+		return nil, err
+	}
+	return func(v reflect.Value) bool {
+		got, ok := timeOf(v)
+		if !ok {
+			return false
+		}
+		if got.Before(date) {
+			return compare(-1)
+		} else if got.After(date) {
+			return compare(1)
+		}
+		return compare(0)
+	}, nil
+}
+
+// splitRelativeDate separates a relative datetime value into its relation and age.
+func splitRelativeDate(value string) (string, string, bool) {
+	value = strings.TrimSpace(value)
+	for _, relation := range []string{olderThan, newerThan} {
+		if strings.HasPrefix(value, relation) {
+			return relation, strings.TrimSpace(strings.TrimPrefix(value, relation)), true
+		}
+	}
+	return "", "", false
+}
+
+// parseAge reads a Go duration, optionally preceded by a number of days, e.g. `30d` or `1d12h`.
+func parseAge(age string) (time.Duration, error) {
+	var days time.Duration
+	if i := strings.Index(age, "d"); i >= 0 {
+		n, err := strconv.Atoi(age[:i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid age: %s", age)
+		}
+		days, age = time.Duration(n)*24*time.Hour, age[i+1:]
+		if age == "" {
+			return days, nil
+		}
+	}
+	d, err := time.ParseDuration(age)
+	if err != nil {
+		return 0, err
+	}
+	return days + d, nil
+}
+
+// parseDate reads RFC3339 timestamps, with or without fractional seconds.
+func parseDate(strDate string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, strDate)
+}
+
+func parseBooleanPredicate(value string) (valueMatcher, error) {
+	op, operand := splitOperator(value)
+	if op == "" && operand == "" {
+		return func(v reflect.Value) bool {
+			_, ok := boolOf(v)
+			return ok
+		}, nil
+	}
+	want, err := strconv.ParseBool(operand)
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "", opEqual:
+	case opNotEqual:
+		want = !want
+	default:
+		return nil, fmt.Errorf("operator %s cannot be applied to a boolean: %s", op, operand)
+	}
+	return func(v reflect.Value) bool {
+		got, ok := boolOf(v)
+		return ok && got == want
+	}, nil
+}
+
+func parseQuantityPredicate(value string) (valueMatcher, error) {
+	op, operand := splitOperator(value)
+	if op == "" && operand == "" {
+		return func(v reflect.Value) bool {
+			_, ok := quantityOf(v)
+			return ok
+		}, nil
+	}
+	quantity, err := resource.ParseQuantity(operand)
+	if err != nil {
+		return nil, err
+	}
+	compare, err := comparison(op, operand)
+	if err != nil {
+		return nil, err
+	}
+	return func(v reflect.Value) bool {
+		got, ok := quantityOf(v)
+		return ok && compare(got.Cmp(quantity))
+	}, nil
+}
+
+func parseDurationPredicate(value string) (valueMatcher, error) {
+	op, operand := splitOperator(value)
+	if op == "" && operand == "" {
+		return func(v reflect.Value) bool {
+			_, ok := durationOf(v)
+			return ok
+		}, nil
+	}
+	duration, err := time.ParseDuration(operand)
+	if err != nil {
+		return nil, err
+	}
+	compare, err := comparison(op, operand)
+	if err != nil {
+		return nil, err
+	}
+	return func(v reflect.Value) bool {
+		got, ok := durationOf(v)
+		return ok && compare(compareFloats(float64(got), float64(duration)))
+	}, nil
+}
+
+// parseValueComparator returns a function comparing two values of a field type with a bare operator, as used when a
+// value is compared to another field. Values that cannot be read as the field type never match.
+func parseValueComparator(fType FieldType, value string) (func(a, b reflect.Value) bool, error) {
+	op, operand := splitOperator(value)
+	if operand != "" {
+		return nil, fmt.Errorf("expected only an operator when comparing to a field, found %q", value)
+	}
+	compare, err := comparison(op, operand)
+	if err != nil {
+		return nil, err
+	}
+	var order func(a, b reflect.Value) (int, bool)
+	switch fType {
+	case STRING_FIELD:
+		order = func(a, b reflect.Value) (int, bool) {
+			x, okX := stringOf(a)
+			y, okY := stringOf(b)
+			return strings.Compare(x, y), okX && okY
+		}
+	case NUMERICAL_FIELD:
+		order = func(a, b reflect.Value) (int, bool) {
+			x, okX := numberOf(a)
+			y, okY := numberOf(b)
+			return compareFloats(x, y), okX && okY
+		}
+	case DATETIME_FIELD:
+		order = func(a, b reflect.Value) (int, bool) {
+			x, okX := timeOf(a)
+			y, okY := timeOf(b)
+			if !okX || !okY {
+				return 0, false
+			}
+			if x.Before(y) {
+				return -1, true
+			} else if x.After(y) {
+				return 1, true
+			}
+			return 0, true
+		}
+	case QUANTITY_FIELD:
+		order = func(a, b reflect.Value) (int, bool) {
+			x, okX := quantityOf(a)
+			y, okY := quantityOf(b)
+			if !okX || !okY {
+				return 0, false
+			}
+			return x.Cmp(y), true
+		}
+	case DURATION_FIELD:
+		order = func(a, b reflect.Value) (int, bool) {
+			x, okX := durationOf(a)
+			y, okY := durationOf(b)
+			return compareFloats(float64(x), float64(y)), okX && okY
+		}
+	case URI_FIELD, BOOLEAN_FIELD:
+		if op != opEqual && op != opNotEqual {
+			return nil, fmt.Errorf("operator %s cannot be applied to a %s", op, fType)
+		}
+		order = func(a, b reflect.Value) (int, bool) {
+			x, okX := canonicalOf(fType, a)
+			y, okY := canonicalOf(fType, b)
+			return strings.Compare(x, y), okX && okY
+		}
+	default:
+		return nil, fmt.Errorf("cannot compare fields of type %d", fType)
+	}
+	return func(a, b reflect.Value) bool {
+		if !a.IsValid() || !b.IsValid() {
+			return false
+		}
+		c, ok := order(a, b)
+		return ok && compare(c)
+	}, nil
+}
+
+// canonicalOf renders uri and boolean values in a form where equal values have equal strings.
+func canonicalOf(fType FieldType, v reflect.Value) (string, bool) {
+	if fType == BOOLEAN_FIELD {
+		b, ok := boolOf(v)
+		return strconv.FormatBool(b), ok
+	}
+	str, ok := stringOf(v)
+	if !ok {
+		return "", false
+	}
+	u, err := parseURI(str)
+	if err != nil {
+		return "", false
+	}
+	return u.String(), true
+}
+
+// comparison returns a function that checks the result of comparing a value to an operand (-1, 0 or 1) against op.
+func comparison(op, operand string) (func(int) bool, error) {
+	switch op {
+	case opEqual:
+		return func(c int) bool { return c == 0 }, nil
+	case opNotEqual:
+		return func(c int) bool { return c != 0 }, nil
+	case opLess:
+		return func(c int) bool { return c < 0 }, nil
+	case opLessEqual:
+		return func(c int) bool { return c <= 0 }, nil
+	case opGreater:
+		return func(c int) bool { return c > 0 }, nil
+	case opGreaterEqual:
+		return func(c int) bool { return c >= 0 }, nil
+	default:
+		return nil, fmt.Errorf("incorrectly formatted comparison: %s%s", op, operand)
+	}
+}
+
+// Conversions from reflected values.
+/////////////////////////////////////
+
+// indirect follows pointers and interfaces, returning an invalid value if a nil is encountered.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
+
+// isCollection reports whether a base value should be applied to each element of v rather than to v itself.
+func isCollection(v reflect.Value) bool {
+	return (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8
+}
+
+// addressable returns v itself if its fields can be addressed, or else an addressable copy of it. Inputs passed by
+// value are copied once per evaluation, so that addressOf can read the values under them in place.
+func addressable(v reflect.Value) reflect.Value {
+	if !v.IsValid() || v.CanAddr() || (v.Kind() != reflect.Struct && v.Kind() != reflect.Array) {
+		return v
+	}
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	return ptr.Elem()
+}
+
+// addressOf returns a pointer to a struct value as an interface. Values reached through a pointer or an addressable
+// input are read in place, while the values of maps are copied into a new interface value.
+func addressOf(v reflect.Value) interface{} {
+	if v.CanAddr() {
+		return v.Addr().Interface()
+	}
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	return ptr.Interface()
+}
+
+func intOrStringOf(v reflect.Value) *intstr.IntOrString {
+	return addressOf(v).(*intstr.IntOrString)
+}
+
+func stringOf(v reflect.Value) (string, bool) {
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), true
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), true
+		}
+	case reflect.Struct:
+		if v.Type() == intOrStringType {
+			ios := intOrStringOf(v)
+			return ios.String(), true
+		}
+	}
+	return "", false
+}
+
+func numberOf(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	case reflect.String:
+		num, err := parseNum(v.String())
+		return num, err == nil
+	case reflect.Struct:
+		if v.Type() == intOrStringType {
+			ios := intOrStringOf(v)
+			if ios.Type == intstr.Int {
+				return float64(ios.IntVal), true
+			}
+			num, err := parseNum(ios.StrVal)
+			return num, err == nil
+		}
+	}
+	return 0, false
+}
+
+// timeOf reads timestamps from time values and RFC 3339 strings. A zero time, such as the creationTimestamp of an object
+// that has not been created yet, is missing.
+func timeOf(v reflect.Value) (time.Time, bool) {
+	var t time.Time
+	switch v.Type() {
+	case timeType:
+		t = *addressOf(v).(*time.Time)
+	case metaTimeType:
+		t = addressOf(v).(*metav1.Time).Time
+	case microTimeType:
+		t = addressOf(v).(*metav1.MicroTime).Time
+	default:
+		if v.Kind() != reflect.String {
+			return time.Time{}, false
+		}
+		var err error
+		if t, err = parseDate(v.String()); err != nil {
+			return time.Time{}, false
+		}
+	}
+	return t, !t.IsZero()
+}
+
+// quantityOf reads resource quantities, e.g. `512Mi` or `250m`, from Quantity values, strings and integers.
+func quantityOf(v reflect.Value) (resource.Quantity, bool) {
+	switch v.Kind() {
+	case reflect.Struct:
+		switch v.Type() {
+		case quantityType:
+			return *addressOf(v).(*resource.Quantity), true
+		case intOrStringType:
+			ios := intOrStringOf(v)
+			if ios.Type == intstr.Int {
+				return *resource.NewQuantity(int64(ios.IntVal), resource.DecimalSI), true
+			}
+			q, err := resource.ParseQuantity(ios.StrVal)
+			return q, err == nil
+		}
+	case reflect.String:
+		q, err := resource.ParseQuantity(v.String())
+		return q, err == nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return *resource.NewQuantity(v.Int(), resource.DecimalSI), true
+	}
+	return resource.Quantity{}, false
+}
+
+// durationOf reads durations from Duration values and Go duration strings, e.g. `1m30s`. Integers are read as seconds,
+// which is how the API represents durations such as terminationGracePeriodSeconds.
+func durationOf(v reflect.Value) (time.Duration, bool) {
+	switch v.Type() {
+	case durationType:
+		return time.Duration(v.Int()), true
+	case metaDurationType:
+		return addressOf(v).(*metav1.Duration).Duration, true
+	}
+	switch v.Kind() {
+	case reflect.String:
+		d, err := time.ParseDuration(v.String())
+		return d, err == nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return time.Duration(v.Int()) * time.Second, true
+	}
+	return 0, false
+}
+
+func boolOf(v reflect.Value) (bool, bool) {
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool(), true
+	case reflect.String:
+		b, err := strconv.ParseBool(v.String())
+		return b, err == nil
+	}
+	return false, false
+}
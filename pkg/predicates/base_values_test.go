@@ -0,0 +1,278 @@
+package predicates
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+type valueMatcherCase struct {
+	value string
+	input interface{}
+	match bool
+}
+
+func runValueMatcherCases(t *testing.T, fType FieldType, cases []valueMatcherCase) {
+	for _, c := range cases {
+		matcher, err := parseValueMatcher(fType, c.value, time.Now)
+		if !assert.NoError(t, err, "%s %q", fType, c.value) {
+			continue
+		}
+		assert.Equal(t, c.match, matcher(reflect.ValueOf(c.input)), "%s %q against %#v", fType, c.value, c.input)
+	}
+}
+
+func TestStringValue(t *testing.T) {
+	runValueMatcherCases(t, STRING_FIELD, []valueMatcherCase{
+		{``, "anything", true},
+		{``, 5, false},
+		{`\w`, "sh", true},
+		{`\w`, "", false},
+		{`=~^nginx:`, "nginx:1.17", true},
+		{`=~^nginx:`, "busybox", false},
+		{`!~latest$`, "nginx:latest", false},
+		{`!~latest$`, "nginx:1.17", true},
+		{`==latest`, "latest", true},
+		{`==latest`, "latest2", false},
+		{`!=latest`, "latest", false},
+		{`!=latest`, "1.0", true},
+		{`==8080`, intstr.FromInt(8080), true},
+		{`==http`, intstr.FromString("http"), true},
+	})
+}
+
+func TestURIValue(t *testing.T) {
+	runValueMatcherCases(t, URI_FIELD, []valueMatcherCase{
+		{``, "https://example.com/path", true},
+		{``, "", false},
+		{`==https://example.com/path`, "HTTPS://Example.com/path", true},
+		{`==https://example.com/path`, "https://example.com/other", false},
+		{`!=https://example.com`, "https://example.org", true},
+		{`!=https://example.com`, "https://EXAMPLE.com", false},
+		{`^https://`, "https://example.com", true},
+		{`^https://`, "http://example.com", false},
+		{`!~^http://`, "http://example.com", false},
+	})
+}
+
+func TestNumberValue(t *testing.T) {
+	runValueMatcherCases(t, NUMERICAL_FIELD, []valueMatcherCase{
+		{``, int32(3), true},
+		{``, "three", false},
+		{`==3`, int32(3), true},
+		{`==3`, int64(4), false},
+		{`!=3`, uint(3), false},
+		{`!=3`, uint(4), true},
+		{`<3`, 2.5, true},
+		{`<3`, 3, false},
+		{`<=3`, 3, true},
+		{`<=3`, 4, false},
+		{`>3`, 4, true},
+		{`>3`, 3, false},
+		{`>=0 `, 0, true},
+		{`>=0 `, -1, false},
+		{`<=9999`, intstr.FromInt(8080), true},
+		{`<=9999`, intstr.FromString("8080"), true},
+		{`>=0`, intstr.FromString("http"), false},
+		{`>=1.5`, "2", true},
+	})
+}
+
+func TestDateTimeValue(t *testing.T) {
+	date := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	runValueMatcherCases(t, DATETIME_FIELD, []valueMatcherCase{
+		{``, date, true},
+		{``, 5, false},
+		{`==2020-03-01T12:00:00.000Z`, date, true},
+		{`==2020-03-01T12:00:00.000Z`, date.Add(time.Second), false},
+		{`!=2020-03-01T12:00:00.000Z`, date, false},
+		{`!=2020-03-01T12:00:00.000Z`, date.Add(time.Second), true},
+		{`<2020-03-01T12:00:00.000Z`, date.Add(-time.Second), true},
+		{`<2020-03-01T12:00:00.000Z`, date, false},
+		{`<=2020-03-01T12:00:00.000Z`, date, true},
+		{`<=2020-03-01T12:00:00.000Z`, date.Add(time.Second), false},
+		{`>2020-03-01T12:00:00.000Z`, metav1.NewTime(date.Add(time.Hour)), true},
+		{`>2020-03-01T12:00:00.000Z`, metav1.NewTime(date), false},
+		{`>=2020-03-01T12:00:00.000Z`, metav1.NewMicroTime(date), true},
+		{`>=2020-03-01T12:00:00.000Z`, "2020-02-01T12:00:00.000Z", false},
+		{`==2020-03-01T12:00:00Z`, date, true},
+		{`==2020-03-01T13:00:00+01:00`, date, true},
+		{`<2020-03-01T12:00:00.5Z`, "2020-03-01T12:00:00Z", true},
+	})
+}
+
+func TestRelativeDateTimeValue(t *testing.T) {
+	now := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	pf := NewPredicateFactory(v1.Pod{}, WithClock(func() time.Time { return now }))
+	created := func(age time.Duration) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{CreationTimestamp: metav1.NewTime(now.Add(-age))}}
+	}
+	annotated := func(value string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"expires": value}}}
+	}
+	for _, c := range []struct {
+		d     *PredicateDescriptor
+		pod   *v1.Pod
+		match bool
+	}{
+		{Field("metadata.creationTimestamp", DateTimeValue("olderThan 30d")), created(31 * 24 * time.Hour), true},
+		{Field("metadata.creationTimestamp", DateTimeValue("olderThan 30d")), created(29 * 24 * time.Hour), false},
+		{Field("metadata.creationTimestamp", DateTimeValue("olderThan 1d12h")), created(37 * time.Hour), true},
+		{Field("metadata.creationTimestamp", DateTimeValue("olderThan 1d12h")), created(35 * time.Hour), false},
+		{Field("metadata.creationTimestamp", DateTimeValue("newerThan 1h")), created(30 * time.Minute), true},
+		{Field("metadata.creationTimestamp", DateTimeValue("newerThan 1h")), created(2 * time.Hour), false},
+		{Field("metadata.annotations.expires", DateTimeValue("newerThan 1h")), annotated("2020-03-01T11:30:00Z"), true},
+		{Field("metadata.annotations.expires", DateTimeValue("newerThan 1h")), annotated("2020-03-01T10:00:00Z"), false},
+		{Field("metadata.annotations.expires", DateTimeValue("newerThan 1h")), annotated("not a time"), false},
+		// An unset timestamp is neither older nor newer than anything.
+		{Field("metadata.creationTimestamp", DateTimeValue("olderThan 30d")), &v1.Pod{}, false},
+		{Field("metadata.creationTimestamp", DateTimeValue("newerThan 30d")), &v1.Pod{}, false},
+		{Field("metadata.creationTimestamp", DateTimeValue("<2020-03-01T12:00:00Z")), &v1.Pod{}, false},
+		{Field("metadata.creationTimestamp", DateTimeValue("")), &v1.Pod{}, false},
+		{Field("metadata.deletionTimestamp", DateTimeValue("olderThan 30d")), &v1.Pod{}, false},
+	} {
+		pred, err := pf.Build(c.d)
+		if !assert.NoError(t, err, describe(c.d)) {
+			continue
+		}
+		assert.Equal(t, c.match, pred(c.pod) == nil, "%s on %s", describe(c.d), formatValue(reflect.ValueOf(c.pod.ObjectMeta)))
+	}
+
+	// The clock is read when the predicate is evaluated, not when it is built.
+	pred, err := pf.Build(Field("metadata.creationTimestamp", DateTimeValue("olderThan 30d")))
+	require.NoError(t, err)
+	pod := created(29 * 24 * time.Hour)
+	assert.Error(t, pred(pod))
+	now = now.Add(2 * 24 * time.Hour)
+	assert.NoError(t, pred(pod))
+
+	_, err = pf.Build(Field("metadata.creationTimestamp", DateTimeValue("olderThan a month")))
+	assert.Error(t, err)
+}
+
+func TestBooleanValue(t *testing.T) {
+	runValueMatcherCases(t, BOOLEAN_FIELD, []valueMatcherCase{
+		{``, false, true},
+		{``, "nope", false},
+		{`true`, true, true},
+		{`true`, false, false},
+		{`==false`, false, true},
+		{`==false`, true, false},
+		{`!=true`, false, true},
+		{`!=true`, true, false},
+		{`==true`, "true", true},
+	})
+}
+
+func TestQuantityValue(t *testing.T) {
+	runValueMatcherCases(t, QUANTITY_FIELD, []valueMatcherCase{
+		{``, resource.MustParse("1Gi"), true},
+		{``, "lots", false},
+		{`==512Mi`, resource.MustParse("0.5Gi"), true},
+		{`==512Mi`, resource.MustParse("512M"), false},
+		{`!=250m`, resource.MustParse("0.25"), false},
+		{`!=250m`, resource.MustParse("1"), true},
+		{`<1`, resource.MustParse("250m"), true},
+		{`<1`, resource.MustParse("1000m"), false},
+		{`<=1Gi`, "1024Mi", true},
+		{`<=1Gi`, "1025Mi", false},
+		{`>100m`, intstr.FromString("200m"), true},
+		{`>100m`, 0, false},
+		{`>=2`, int64(2), true},
+		{`>=2`, resource.MustParse("1999m"), false},
+	})
+}
+
+func TestDurationValue(t *testing.T) {
+	runValueMatcherCases(t, DURATION_FIELD, []valueMatcherCase{
+		{``, time.Minute, true},
+		{``, "a while", false},
+		{`==90s`, "1m30s", true},
+		{`==90s`, time.Minute, false},
+		{`!=30s`, int64(30), false},
+		{`!=30s`, int64(31), true},
+		{`<1h`, metav1.Duration{Duration: 59 * time.Minute}, true},
+		{`<1h`, time.Hour, false},
+		{`<=1h`, time.Hour, true},
+		{`<=1h`, int32(3601), false},
+		{`>5m`, "6m", true},
+		{`>5m`, "5m", false},
+		{`>=10s`, int32(10), true},
+		{`>=10s`, 9 * time.Second, false},
+	})
+}
+
+func TestInvalidValues(t *testing.T) {
+	for fType, value := range map[FieldType]string{
+		STRING_FIELD:    `<3`,
+		URI_FIELD:       `==`,
+		NUMERICAL_FIELD: `>=three`,
+		DATETIME_FIELD:  `<yesterday`,
+		BOOLEAN_FIELD:   `>true`,
+		QUANTITY_FIELD:  `>=lots`,
+		DURATION_FIELD:  `<30d`,
+	} {
+		_, err := parseValueMatcher(fType, value, time.Now)
+		assert.Error(t, err, "%s %q", fType, value)
+	}
+}
+
+func TestValueComparator(t *testing.T) {
+	date := time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		fType FieldType
+		op    string
+		a, b  interface{}
+		match bool
+	}{
+		{STRING_FIELD, "==", "a", "a", true},
+		{STRING_FIELD, "!=", "a", "a", false},
+		{STRING_FIELD, "<", "a", "b", true},
+		{NUMERICAL_FIELD, ">=", int32(10), int64(5), true},
+		{NUMERICAL_FIELD, ">=", 1.5, intstr.FromInt(2), false},
+		{DATETIME_FIELD, "<", metav1.NewTime(date), date.Add(time.Hour), true},
+		{DATETIME_FIELD, "==", "2020-03-01T13:00:00+01:00", metav1.NewTime(date), true},
+		{QUANTITY_FIELD, "<=", resource.MustParse("512Mi"), resource.MustParse("1Gi"), true},
+		{QUANTITY_FIELD, "<=", resource.MustParse("2Gi"), "1Gi", false},
+		{DURATION_FIELD, ">", "2m", time.Minute, true},
+		{URI_FIELD, "==", "HTTPS://example.com/a", "https://example.com/a", true},
+		{BOOLEAN_FIELD, "==", true, "true", true},
+		{BOOLEAN_FIELD, "!=", true, false, true},
+		// Values of the wrong type never compare, whatever the operator.
+		{NUMERICAL_FIELD, "==", "ten", int64(10), false},
+		{NUMERICAL_FIELD, "!=", "ten", int64(10), false},
+		{DATETIME_FIELD, "<", "yesterday", date, false},
+		{QUANTITY_FIELD, ">", resource.MustParse("1Gi"), "lots", false},
+		{BOOLEAN_FIELD, "==", "yes", true, false},
+		{STRING_FIELD, "==", 10, "10", false},
+	} {
+		compare, err := parseValueComparator(c.fType, c.op)
+		if !assert.NoError(t, err, "%s %s", c.fType, c.op) {
+			continue
+		}
+		assert.Equal(t, c.match, compare(reflect.ValueOf(c.a), reflect.ValueOf(c.b)), "%#v %s %s %#v", c.a, c.fType, c.op, c.b)
+	}
+	// A missing value never compares.
+	compare, err := parseValueComparator(NUMERICAL_FIELD, "!=")
+	if assert.NoError(t, err) {
+		assert.False(t, compare(reflect.ValueOf(1), reflect.Value{}))
+	}
+
+	for fType, value := range map[FieldType]string{
+		STRING_FIELD:    `=~`,
+		NUMERICAL_FIELD: `>=5`,
+		BOOLEAN_FIELD:   `<`,
+		URI_FIELD:       `<`,
+		FieldType(99):   `==`,
+	} {
+		_, err := parseValueComparator(fType, value)
+		assert.Error(t, err, "%s %q", fType, value)
+	}
+}
@@ -0,0 +1,333 @@
+package predicates
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/ext"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// CELPredicateDescriptor describes a Common Expression Language rule, written as in the x-kubernetes-validations of a
+// CustomResourceDefinition. The rule sees the current value as `self` and the whole input as `object`, and must
+// evaluate to a boolean. Fields are selected by their json names, and fields that may be unset should be tested with
+// has() before they are read. For example, to require a container's probe to use one of its declared ports:
+//
+//	!has(self.livenessProbe) || !has(self.livenessProbe.tcpSocket) ||
+//	  self.ports.exists(p, p.containerPort == self.livenessProbe.tcpSocket.port)
+//
+// The string extension functions, e.g. lowerAscii() and split(), are available as in Kubernetes. Rules are
+// type-checked against the example type when the predicate is built. Values are seen as in their json form,
+// except that timestamps and durations have the CEL timestamp and duration types, and int-or-string values are dynamic.
+type CELPredicateDescriptor struct {
+	Rule string `json:"rule" yaml:"rule"`
+	// Message replaces the rule in violations.
+	Message string `json:"message,omitempty" yaml:"message,omitempty"`
+}
+
+// celEnvironment declares the types of a factory's example to CEL. It is created on first use.
+type celEnvironment struct {
+	env   *cel.Env
+	types *celTypes
+}
+
+func (pf *predicateFactoryImpl) celEnvironment() (*celEnvironment, error) {
+	pf.celOnce.Do(func() {
+		base, err := cel.NewEnv(ext.Strings())
+		if err != nil {
+			pf.celErr = err
+			return
+		}
+		celTypes := newCELTypes(base.CELTypeProvider())
+		rootType := celTypes.typeOf(reflect.TypeOf(pf.example))
+		env, err := base.Extend(cel.CustomTypeProvider(celTypes), cel.Variable("object", rootType))
+		pf.cel, pf.celErr = &celEnvironment{env: env, types: celTypes}, err
+	})
+	return pf.cel, pf.celErr
+}
+
+func (pf *predicateFactoryImpl) parseCELPredicate(currentPath string, currentType reflect.Type, d *CELPredicateDescriptor) (internalPredicate, error) {
+	environment, err := pf.celEnvironment()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create CEL environment: %v", err)
+	}
+	env, err := environment.env.Extend(cel.Variable("self", environment.types.typeOf(currentType)))
+	if err != nil {
+		return nil, err
+	}
+	ast, issues := env.Compile(d.Rule)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("invalid CEL rule at path %s: %v", displayPath(currentPath), issues.Err())
+	}
+	if ast.OutputType() != types.BoolType {
+		return nil, fmt.Errorf("CEL rule at path %s evaluates to %s, expected bool", displayPath(currentPath), ast.OutputType())
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("invalid CEL rule at path %s: %v", displayPath(currentPath), err)
+	}
+	expected := describeCEL(d)
+	convert := environment.types.value
+	return func(input reflect.Value, at location) []*Violation {
+		out, _, err := program.Eval(map[string]interface{}{
+			"self":   convert(input),
+			"object": func() interface{} { return convert(at.root) },
+		})
+		if err == nil && out == types.True {
+			return nil
+		}
+		if at.quiet {
+			return quietViolations
+		}
+		if err != nil {
+			return []*Violation{at.violation(fmt.Sprintf("%s (%v)", expected, err), input)}
+		}
+		return []*Violation{at.violation(expected, input)}
+	}, nil
+}
+
+// celTypes maps Go types to CEL types, and provides the object types it creates to the CEL type checker. Struct types
+// become object types whose fields are their json fields.
+type celTypes struct {
+	base types.Provider
+
+	mu      sync.RWMutex
+	names   map[reflect.Type]string
+	objects map[string]map[string]*types.Type
+}
+
+func newCELTypes(base types.Provider) *celTypes {
+	return &celTypes{
+		base:    base,
+		names:   map[reflect.Type]string{},
+		objects: map[string]map[string]*types.Type{},
+	}
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	celNameReplacer   = strings.NewReplacer("/", ".", "-", "_")
+)
+
+func (c *celTypes) typeOf(t reflect.Type) *types.Type {
+	if t == nil {
+		return types.DynType
+	}
+	t = derefType(t)
+	switch t {
+	case intOrStringType:
+		return types.DynType
+	case quantityType:
+		return types.StringType
+	case timeType, metaTimeType, microTimeType:
+		return types.TimestampType
+	case durationType, metaDurationType:
+		return types.DurationType
+	}
+	if t.Implements(jsonMarshalerType) || reflect.PtrTo(t).Implements(jsonMarshalerType) {
+		return types.DynType
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return types.BoolType
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return types.IntType
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return types.UintType
+	case reflect.Float32, reflect.Float64:
+		return types.DoubleType
+	case reflect.String:
+		return types.StringType
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return types.BytesType
+		}
+		return types.NewListType(c.typeOf(t.Elem()))
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return types.DynType
+		}
+		return types.NewMapType(types.StringType, c.typeOf(t.Elem()))
+	case reflect.Struct:
+		return types.NewObjectType(c.objectName(t))
+	}
+	return types.DynType
+}
+
+// objectName declares a struct type as an object type, named after its Go type.
+func (c *celTypes) objectName(t reflect.Type) string {
+	c.mu.Lock()
+	if name, ok := c.names[t]; ok {
+		c.mu.Unlock()
+		return name
+	}
+	name := fmt.Sprintf("%s.%s", celNameReplacer.Replace(t.PkgPath()), t.Name())
+	if t.Name() == "" {
+		name = fmt.Sprintf("object%d", len(c.names))
+	}
+	c.names[t] = name
+	c.mu.Unlock()
+
+	// Fields are resolved after the type is named, so that recursive types terminate.
+	fields := map[string]*types.Type{}
+	for fieldName, field := range jsonFields(t) {
+		fields[fieldName] = c.typeOf(field.Type)
+	}
+	c.mu.Lock()
+	c.objects[name] = fields
+	c.mu.Unlock()
+	return name
+}
+
+func (c *celTypes) object(name string) (map[string]*types.Type, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	fields, ok := c.objects[name]
+	return fields, ok
+}
+
+func (c *celTypes) EnumValue(enumName string) ref.Val {
+	return c.base.EnumValue(enumName)
+}
+
+func (c *celTypes) FindIdent(identName string) (ref.Val, bool) {
+	return c.base.FindIdent(identName)
+}
+
+func (c *celTypes) FindStructType(structType string) (*types.Type, bool) {
+	if _, ok := c.object(structType); ok {
+		return types.NewTypeTypeWithParam(types.NewObjectType(structType)), true
+	}
+	return c.base.FindStructType(structType)
+}
+
+func (c *celTypes) FindStructFieldType(structType, fieldName string) (*types.FieldType, bool) {
+	fields, ok := c.object(structType)
+	if !ok {
+		return c.base.FindStructFieldType(structType, fieldName)
+	}
+	// Without IsSet and GetFrom, fields are read from the maps that values are converted to.
+	fieldType, ok := fields[fieldName]
+	if !ok {
+		return nil, false
+	}
+	return &types.FieldType{Type: fieldType}, true
+}
+
+func (c *celTypes) NewValue(structType string, fields map[string]ref.Val) ref.Val {
+	if _, ok := c.object(structType); ok {
+		return types.NewErr("cannot create a %s in a rule", structType)
+	}
+	return c.base.NewValue(structType, fields)
+}
+
+// value converts a reflected value to the form its CEL type describes. Structs become maps of their json fields,
+// leaving out the unset ones, so that has() can test for them.
+func (c *celTypes) value(v reflect.Value) interface{} {
+	v = indirect(v)
+	if !v.IsValid() {
+		return nil
+	}
+	switch v.Type() {
+	case intOrStringType:
+		if ios := intOrStringOf(v); ios.Type == intstr.Int {
+			return int64(ios.IntVal)
+		}
+		return intOrStringOf(v).StrVal
+	case quantityType:
+		q, _ := quantityOf(v)
+		return q.String()
+	case timeType, metaTimeType, microTimeType:
+		t, _ := timeOf(v)
+		return t
+	case durationType, metaDurationType:
+		d, _ := durationOf(v)
+		return d
+	}
+	if v.Type().Implements(jsonMarshalerType) || reflect.PtrTo(v.Type()).Implements(jsonMarshalerType) {
+		return jsonValue(addressOf(v))
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return v.Uint()
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			bytes := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(bytes), v)
+			return bytes
+		}
+		list := make([]interface{}, v.Len())
+		for i := range list {
+			list[i] = c.value(v.Index(i))
+		}
+		return list
+	case reflect.Map:
+		m := make(map[string]interface{}, v.Len())
+		for _, key := range v.MapKeys() {
+			m[fmt.Sprint(key.Interface())] = c.value(v.MapIndex(key))
+		}
+		return m
+	case reflect.Struct:
+		m := map[string]interface{}{}
+		for name, field := range jsonFields(v.Type()) {
+			fieldValue := fieldByIndex(v, field.Index)
+			if !isMissing(fieldValue, hasOption(jsonOptions(field), "omitempty")) {
+				m[name] = c.value(fieldValue)
+			}
+		}
+		return m
+	}
+	return nil
+}
+
+// jsonValue converts a value with its own json encoding to maps, lists and scalars. Whole numbers become integers.
+func jsonValue(v interface{}) interface{} {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return nil
+	}
+	return wholeNumbers(decoded)
+}
+
+func wholeNumbers(v interface{}) interface{} {
+	switch value := v.(type) {
+	case float64:
+		if value == float64(int64(value)) {
+			return int64(value)
+		}
+	case []interface{}:
+		for i := range value {
+			value[i] = wholeNumbers(value[i])
+		}
+	case map[string]interface{}:
+		for key := range value {
+			value[key] = wholeNumbers(value[key])
+		}
+	}
+	return v
+}
+
+func describeCEL(d *CELPredicateDescriptor) string {
+	if d.Message != "" {
+		return d.Message
+	}
+	return fmt.Sprintf("rule `%s`", d.Rule)
+}
@@ -0,0 +1,107 @@
+package predicates
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+const probePortRule = `!has(self.livenessProbe) || !has(self.livenessProbe.tcpSocket) ||
+	self.ports.exists(p, p.containerPort == self.livenessProbe.tcpSocket.port)`
+
+func TestCEL(t *testing.T) {
+	pred, err := NewPredicateFactory(v1.Pod{}).Build(All("spec.containers", CEL(probePortRule)))
+	require.NoError(t, err)
+
+	probe := &v1.Probe{Handler: v1.Handler{TCPSocket: &v1.TCPSocketAction{Port: intstr.FromInt(8080)}}}
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{
+		{Name: "plain"},
+		{Name: "declared", LivenessProbe: probe, Ports: []v1.ContainerPort{{ContainerPort: 8080}}},
+		{Name: "undeclared", LivenessProbe: probe, Ports: []v1.ContainerPort{{ContainerPort: 9090}}},
+	}}}
+	err = pred(pod)
+	require.Error(t, err)
+	violations := err.(*Report).Violations
+	require.Len(t, violations, 1)
+	assert.Equal(t, "spec.containers[2]", violations[0].Path)
+
+	pod.Spec.Containers[2].Ports[0].ContainerPort = 8080
+	assert.NoError(t, pred(pod))
+}
+
+func TestCELVariables(t *testing.T) {
+	pf := NewPredicateFactory(v1.Pod{})
+	pred, err := pf.Build(All("spec.containers", &PredicateDescriptor{CEL: &CELPredicateDescriptor{
+		Rule:    `self.name.startsWith(object.metadata.name)`,
+		Message: "container names start with the pod name",
+	}}))
+	require.NoError(t, err)
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web"},
+		Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "web-app"}, {Name: "sidecar"}}},
+	}
+	err = pred(pod)
+	require.Error(t, err)
+	violations := err.(*Report).Violations
+	require.Len(t, violations, 1)
+	assert.Equal(t, "spec.containers[1]", violations[0].Path)
+	assert.Contains(t, violations[0].String(), "container names start with the pod name")
+
+	// Timestamps and durations have their CEL types.
+	pred, err = pf.Build(CEL(`!has(self.metadata.creationTimestamp) ||
+		self.metadata.creationTimestamp > timestamp("2020-01-01T00:00:00Z")`))
+	require.NoError(t, err)
+	pod.CreationTimestamp = metav1.NewTime(time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.Error(t, pred(pod))
+	pod.CreationTimestamp = metav1.NewTime(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC))
+	assert.NoError(t, pred(pod))
+}
+
+func TestCELErrors(t *testing.T) {
+	pf := NewPredicateFactory(v1.Pod{})
+	for _, rule := range []string{
+		`self.spec.hostNetwrk`,
+		`self.spec.priority + 1`,
+		`self.spec.hostname > 1`,
+		`self.spec.(`,
+	} {
+		_, err := pf.Build(CEL(rule))
+		assert.Error(t, err, rule)
+	}
+
+	_, err := pf.Build(Field("spec.containers", CEL(`self.size() > 0`)))
+	assert.NoError(t, err)
+
+	// Rules that fail at runtime are violations, with the error.
+	pred, err := pf.Build(CEL(`self.spec.hostname.size() > 0`))
+	require.NoError(t, err)
+	err = pred(&v1.Pod{})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "no such key")
+}
+
+func TestCELDescriptor(t *testing.T) {
+	d := All("spec.containers", &PredicateDescriptor{CEL: &CELPredicateDescriptor{
+		Rule: "self.name != ''", Message: "containers are named",
+	}})
+	parsed, err := ParseDescriptor([]byte(`{quantifier: {kind: all, path: spec.containers,
+		predicate: {cel: {rule: "self.name != ''", message: containers are named}}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, d, parsed)
+
+	expression, err := FormatExpression(All("spec.containers", CEL("self.name != ''")))
+	require.NoError(t, err)
+	assert.Equal(t, `all(spec.containers, @ satisfies "self.name != ''")`, expression)
+	parsed, err = ParseExpression(`all(spec.containers, @ satisfies "self.name != ''" message "containers are named")`)
+	require.NoError(t, err)
+	assert.Equal(t, "all(spec.containers, containers are named)", describe(parsed))
+
+	warnings := Lint(v1.Pod{}, Field("spec", CEL("self.hostNetwrk")))
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0].String(), "undefined field 'hostNetwrk'")
+}
@@ -0,0 +1,113 @@
+package predicates
+
+import (
+	"fmt"
+	"strings"
+)
+
+// describe renders the constraint a descriptor places on a value, for use in violations.
+func describe(d *PredicateDescriptor) string {
+	if d == nil {
+		return "<nil>"
+	}
+	if d.Field != nil {
+		return fmt.Sprintf("%s %s", d.Field.Path, describe(d.Field.Descriptor))
+	} else if d.Quantifier != nil {
+		return describeQuantifier(d.Quantifier)
+	} else if d.Presence != nil {
+		path := d.Presence.Path
+		if path == "" {
+			path = "@"
+		}
+		return fmt.Sprintf("%s %s", path, d.Presence.Kind)
+	} else if len(d.And) != 0 {
+		return describeAll(d.And, " and ")
+	} else if len(d.Or) != 0 {
+		return describeAll(d.Or, " or ")
+	} else if d.Negate != nil {
+		return fmt.Sprintf("NOT %s", describe(d.Negate))
+	} else if d.Base != nil {
+		return describeBase(d.Base)
+	} else if d.Image != nil {
+		return describeImage(d.Image)
+	} else if d.CEL != nil {
+		return describeCEL(d.CEL)
+	} else if d.Ref != "" {
+		return fmt.Sprintf("ref(%s)", d.Ref)
+	}
+	return "<empty>"
+}
+
+func describeQuantifier(q *QuantifierPredicateDescriptor) string {
+	path := q.Path
+	if path == "" {
+		path = "@"
+	}
+	if q.Keys {
+		path = fmt.Sprintf("keys(%s)", path)
+	}
+	switch q.Kind {
+	case AT_LEAST_QUANTIFIER, AT_MOST_QUANTIFIER:
+		return fmt.Sprintf("%s(%d, %s, %s)", q.Kind, q.Count, path, describe(q.Descriptor))
+	default:
+		return fmt.Sprintf("%s(%s, %s)", q.Kind, path, describe(q.Descriptor))
+	}
+}
+
+func describeAll(ds []*PredicateDescriptor, sep string) string {
+	if len(ds) == 1 {
+		return describe(ds[0])
+	}
+	parts := make([]string, 0, len(ds))
+	for _, d := range ds {
+		parts = append(parts, describe(d))
+	}
+	return fmt.Sprintf("(%s)", strings.Join(parts, sep))
+}
+
+func describeBase(base *BasePredicateDescriptor) string {
+	op, operand := splitOperator(base.Value)
+	if base.Reference != "" {
+		return fmt.Sprintf("%s %s %s", base.Type, op, base.Reference)
+	}
+	if op == "" && operand == "" {
+		return fmt.Sprintf("any %s", base.Type)
+	}
+	switch base.Type {
+	case STRING_FIELD, URI_FIELD:
+		prefix := ""
+		if base.Type == URI_FIELD {
+			prefix = "uri "
+		}
+		switch op {
+		case "", opMatch:
+			return fmt.Sprintf("%smatching `%s`", prefix, operand)
+		case opNotMatch:
+			return fmt.Sprintf("%snot matching `%s`", prefix, operand)
+		case opEqual:
+			return fmt.Sprintf("%sequal to `%s`", prefix, operand)
+		case opNotEqual:
+			return fmt.Sprintf("%snot equal to `%s`", prefix, operand)
+		}
+	case BOOLEAN_FIELD:
+		if op == "" {
+			op = opEqual
+		}
+	}
+	if op == "" {
+		return fmt.Sprintf("%s %s", base.Type, operand)
+	}
+	return fmt.Sprintf("%s %s %s", base.Type, op, operand)
+}
+
+func describeImage(image *ImagePredicateDescriptor) string {
+	checks, err := compileImageChecks(image)
+	if err != nil || len(checks) == 0 {
+		return "any image"
+	}
+	parts := make([]string, 0, len(checks))
+	for _, c := range checks {
+		parts = append(parts, c.expected)
+	}
+	return strings.Join(parts, " and ")
+}
@@ -0,0 +1,495 @@
+package predicates
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Descriptors are stored as JSON or YAML documents. Each predicate is an object holding exactly one of these keys:
+//
+//	and:        [predicate, ...]                 every predicate must hold
+//	or:         [predicate, ...]                 at least one predicate must hold
+//	not:        predicate                        the predicate must not hold
+//	field:      {path, predicate}                the predicate must hold for the value at the json path
+//	quantifier: {kind, count, path, keys,        kind is one of all, any, none, atLeast or atMost, and keys
+//	             predicate}                      applies the predicate to the keys of a map instead of its values
+//	presence:   {kind, path}                     kind is one of exists, missing or zero
+//	value:      {type, value, reference}         type is one of string, uri, number, datetime,
+//	                                             boolean, quantity or duration
+//	image:      {registries, repository,         constraints on the parts of a container image reference
+//	             forbiddenTags, tagPattern,
+//	             requireSemver, requireDigest}
+//	cel:        {rule, message}                  a CEL rule the value must satisfy, see CELPredicateDescriptor
+//	ref:        name[@version]                   the registered descriptor of that name, see Registry
+//
+// For example, a policy requiring every container to set a numeric liveness probe delay is written in YAML as:
+//
+//	quantifier:
+//	  kind: all
+//	  path: spec.containers
+//	  predicate:
+//	    field:
+//	      path: livenessProbe.initialDelaySeconds
+//	      predicate:
+//	        value: {type: number, value: ">=0"}
+//
+// Paths are json field names separated by dots. Map keys may also be written in brackets as double-quoted strings,
+// which is needed for keys containing dots or slashes, e.g. metadata.labels["app.kubernetes.io/name"].
+//
+// Descriptors are written with encoding/json or gopkg.in/yaml.v3, and read back with ParseDescriptor, which accepts
+// either format. Documents embedding descriptors, JSON ones included, are best read with gopkg.in/yaml.v3: it decodes
+// each descriptor from its node in the document, so errors give positions in the whole document. encoding/json only
+// hands a descriptor its own bytes, so errors found through it carry no position.
+
+// DescriptorError reports an invalid descriptor document, and where in the document the problem was found. Line and
+// Column are zero if the position is unknown.
+type DescriptorError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *DescriptorError) Error() string {
+	if e.Line == 0 {
+		return "invalid predicate: " + e.Message
+	}
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// ParseDescriptor reads a JSON or YAML predicate descriptor, and validates its structure and base values.
+func ParseDescriptor(data []byte) (*PredicateDescriptor, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, &DescriptorError{Line: 1, Column: 1, Message: "empty document"}
+	}
+	return decodeDescriptor(doc.Content[0])
+}
+
+// UnmarshalJSON reads a descriptor with the same validation as ParseDescriptor. The data is only the descriptor's part
+// of the document, so errors do not give a position: a position within the part would be mistaken for one in the
+// document.
+func (d *PredicateDescriptor) UnmarshalJSON(data []byte) error {
+	parsed, err := ParseDescriptor(data)
+	if descErr, ok := err.(*DescriptorError); ok {
+		return &DescriptorError{Message: descErr.Message}
+	} else if err != nil {
+		return err
+	}
+	*d = *parsed
+	return nil
+}
+
+// UnmarshalYAML reads a descriptor with the same validation as ParseDescriptor. Errors carry the line numbers of the
+// enclosing document.
+func (d *PredicateDescriptor) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := decodeDescriptor(node)
+	if err != nil {
+		return err
+	}
+	*d = *parsed
+	return nil
+}
+
+// Node decoding.
+/////////////////
+
+func nodeError(node *yaml.Node, format string, args ...interface{}) error {
+	return &DescriptorError{Line: node.Line, Column: node.Column, Message: fmt.Sprintf(format, args...)}
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+func decodeDescriptor(node *yaml.Node) (*PredicateDescriptor, error) {
+	node = resolveAlias(node)
+	if node.Kind != yaml.MappingNode {
+		return nil, nodeError(node, "expected a predicate object")
+	}
+	if len(node.Content) == 0 {
+		return nil, nodeError(node, "empty predicate")
+	}
+	if len(node.Content) > 2 {
+		return nil, nodeError(node.Content[2], "predicate has both %q and %q, expected exactly one",
+			node.Content[0].Value, node.Content[2].Value)
+	}
+	key, value := node.Content[0], node.Content[1]
+	d := &PredicateDescriptor{}
+	var err error
+	switch key.Value {
+	case "and":
+		d.And, err = decodeDescriptorList(value)
+	case "or":
+		d.Or, err = decodeDescriptorList(value)
+	case "not":
+		d.Negate, err = decodeDescriptor(value)
+	case "field":
+		d.Field, err = decodeField(value)
+	case "quantifier":
+		d.Quantifier, err = decodeQuantifier(value)
+	case "presence":
+		d.Presence, err = decodePresence(value)
+	case "value":
+		d.Base, err = decodeBase(value)
+	case "image":
+		d.Image, err = decodeImage(value)
+	case "cel":
+		d.CEL, err = decodeCEL(value)
+	case "ref":
+		err = stringDecoder(&d.Ref)(value)
+		if err == nil && d.Ref == "" {
+			err = nodeError(resolveAlias(value), "empty reference")
+		}
+	default:
+		return nil, nodeError(key, "unknown predicate %q, expected one of and, or, not, field, quantifier, presence, value, image, cel or ref", key.Value)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func decodeDescriptorList(node *yaml.Node) ([]*PredicateDescriptor, error) {
+	node = resolveAlias(node)
+	if node.Kind != yaml.SequenceNode {
+		return nil, nodeError(node, "expected a list of predicates")
+	}
+	if len(node.Content) == 0 {
+		return nil, nodeError(node, "empty list of predicates")
+	}
+	ds := make([]*PredicateDescriptor, 0, len(node.Content))
+	for _, item := range node.Content {
+		d, err := decodeDescriptor(item)
+		if err != nil {
+			return nil, err
+		}
+		ds = append(ds, d)
+	}
+	return ds, nil
+}
+
+func decodeField(node *yaml.Node) (*FieldPathPredicateDescriptor, error) {
+	f := &FieldPathPredicateDescriptor{}
+	err := decodeObject(node, map[string]func(*yaml.Node) error{
+		"path":      stringDecoder(&f.Path),
+		"predicate": descriptorDecoder(&f.Descriptor),
+	}, "path", "predicate")
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func decodeQuantifier(node *yaml.Node) (*QuantifierPredicateDescriptor, error) {
+	q := &QuantifierPredicateDescriptor{}
+	err := decodeObject(node, map[string]func(*yaml.Node) error{
+		"kind":      textDecoder(&q.Kind),
+		"count":     intDecoder(&q.Count),
+		"path":      stringDecoder(&q.Path),
+		"keys":      boolDecoder(&q.Keys),
+		"predicate": descriptorDecoder(&q.Descriptor),
+	}, "kind", "predicate")
+	if err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func decodePresence(node *yaml.Node) (*PresencePredicateDescriptor, error) {
+	p := &PresencePredicateDescriptor{}
+	err := decodeObject(node, map[string]func(*yaml.Node) error{
+		"kind": textDecoder(&p.Kind),
+		"path": stringDecoder(&p.Path),
+	}, "kind")
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func decodeBase(node *yaml.Node) (*BasePredicateDescriptor, error) {
+	b := &BasePredicateDescriptor{}
+	var valueNode *yaml.Node
+	err := decodeObject(node, map[string]func(*yaml.Node) error{
+		"type": textDecoder(&b.Type),
+		"value": func(n *yaml.Node) error {
+			valueNode = n
+			return stringDecoder(&b.Value)(n)
+		},
+		"reference": stringDecoder(&b.Reference),
+	}, "type")
+	if err != nil {
+		return nil, err
+	}
+	if hasParameters(b.Value) || hasParameters(b.Reference) {
+		// Template parameters are checked once they are filled in.
+		return b, nil
+	}
+	if b.Reference != "" {
+		_, err = parseValueComparator(b.Type, b.Value)
+	} else {
+		_, err = parseValueMatcher(b.Type, b.Value, time.Now)
+	}
+	if err != nil {
+		if valueNode == nil {
+			valueNode = resolveAlias(node)
+		}
+		return nil, nodeError(valueNode, "invalid %s value %q: %v", b.Type, b.Value, err)
+	}
+	return b, nil
+}
+
+func decodeImage(node *yaml.Node) (*ImagePredicateDescriptor, error) {
+	image := &ImagePredicateDescriptor{}
+	err := decodeObject(node, map[string]func(*yaml.Node) error{
+		"registries":    stringListDecoder(&image.Registries),
+		"repository":    stringDecoder(&image.Repository),
+		"forbiddenTags": stringListDecoder(&image.ForbiddenTags),
+		"tagPattern":    stringDecoder(&image.TagPattern),
+		"requireSemver": boolDecoder(&image.RequireSemver),
+		"requireDigest": boolDecoder(&image.RequireDigest),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if hasParameters(image.Repository) || hasParameters(image.TagPattern) {
+		return image, nil
+	}
+	if _, err := compileImageChecks(image); err != nil {
+		return nil, nodeError(resolveAlias(node), "invalid image predicate: %v", err)
+	}
+	return image, nil
+}
+
+func decodeCEL(node *yaml.Node) (*CELPredicateDescriptor, error) {
+	cel := &CELPredicateDescriptor{}
+	err := decodeObject(node, map[string]func(*yaml.Node) error{
+		"rule":    stringDecoder(&cel.Rule),
+		"message": stringDecoder(&cel.Message),
+	}, "rule")
+	if err != nil {
+		return nil, err
+	}
+	return cel, nil
+}
+
+// decodeObject decodes each key of a mapping node with the matching decoder, rejecting unknown and duplicate keys and
+// checking that the required keys are present.
+func decodeObject(node *yaml.Node, decoders map[string]func(*yaml.Node) error, required ...string) error {
+	node = resolveAlias(node)
+	if node.Kind != yaml.MappingNode {
+		return nodeError(node, "expected an object")
+	}
+	seen := map[string]bool{}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		decode, ok := decoders[key.Value]
+		if !ok {
+			known := make([]string, 0, len(decoders))
+			for k := range decoders {
+				known = append(known, k)
+			}
+			sort.Strings(known)
+			return nodeError(key, "unknown key %q, expected one of %s", key.Value, strings.Join(known, ", "))
+		}
+		if seen[key.Value] {
+			return nodeError(key, "duplicate key %q", key.Value)
+		}
+		seen[key.Value] = true
+		if err := decode(value); err != nil {
+			return err
+		}
+	}
+	for _, key := range required {
+		if !seen[key] {
+			return nodeError(node, "missing required key %q", key)
+		}
+	}
+	return nil
+}
+
+func stringDecoder(to *string) func(*yaml.Node) error {
+	return func(node *yaml.Node) error {
+		node = resolveAlias(node)
+		if node.Kind != yaml.ScalarNode {
+			return nodeError(node, "expected a string")
+		}
+		*to = node.Value
+		return nil
+	}
+}
+
+func intDecoder(to *int) func(*yaml.Node) error {
+	return func(node *yaml.Node) error {
+		node = resolveAlias(node)
+		n, err := strconv.Atoi(node.Value)
+		if node.Kind != yaml.ScalarNode || err != nil {
+			return nodeError(node, "expected an integer")
+		}
+		*to = n
+		return nil
+	}
+}
+
+func boolDecoder(to *bool) func(*yaml.Node) error {
+	return func(node *yaml.Node) error {
+		node = resolveAlias(node)
+		b, err := strconv.ParseBool(node.Value)
+		if node.Kind != yaml.ScalarNode || err != nil {
+			return nodeError(node, "expected a boolean")
+		}
+		*to = b
+		return nil
+	}
+}
+
+func stringListDecoder(to *[]string) func(*yaml.Node) error {
+	return func(node *yaml.Node) error {
+		node = resolveAlias(node)
+		if node.Kind != yaml.SequenceNode {
+			return nodeError(node, "expected a list of strings")
+		}
+		list := make([]string, 0, len(node.Content))
+		for _, item := range node.Content {
+			var s string
+			if err := stringDecoder(&s)(item); err != nil {
+				return err
+			}
+			list = append(list, s)
+		}
+		*to = list
+		return nil
+	}
+}
+
+type textUnmarshaler interface {
+	UnmarshalText(text []byte) error
+}
+
+func textDecoder(to textUnmarshaler) func(*yaml.Node) error {
+	return func(node *yaml.Node) error {
+		node = resolveAlias(node)
+		if node.Kind != yaml.ScalarNode {
+			return nodeError(node, "expected a string")
+		}
+		if err := to.UnmarshalText([]byte(node.Value)); err != nil {
+			return nodeError(node, "%v", err)
+		}
+		return nil
+	}
+}
+
+func descriptorDecoder(to **PredicateDescriptor) func(*yaml.Node) error {
+	return func(node *yaml.Node) error {
+		d, err := decodeDescriptor(node)
+		if err != nil {
+			return err
+		}
+		*to = d
+		return nil
+	}
+}
+
+// Enum names.
+//////////////
+
+// enum lists the values of an enum type, and names them by their String form in text encodings.
+type enum struct {
+	kind   string
+	values []fmt.Stringer
+}
+
+func (e *enum) marshal(value fmt.Stringer) ([]byte, error) {
+	for _, known := range e.values {
+		if value == known {
+			return []byte(value.String()), nil
+		}
+	}
+	return nil, fmt.Errorf("unknown %s %d", e.kind, value)
+}
+
+func (e *enum) unmarshal(text []byte) (fmt.Stringer, error) {
+	var names []string
+	for _, known := range e.values {
+		if string(text) == known.String() {
+			return known, nil
+		}
+		names = append(names, known.String())
+	}
+	return nil, fmt.Errorf("unknown %s %q, expected one of %s", e.kind, text, strings.Join(names, ", "))
+}
+
+var fieldTypes = &enum{"field type", []fmt.Stringer{
+	STRING_FIELD, URI_FIELD, NUMERICAL_FIELD, DATETIME_FIELD, BOOLEAN_FIELD, QUANTITY_FIELD, DURATION_FIELD,
+}}
+
+func (t FieldType) MarshalText() ([]byte, error) { return fieldTypes.marshal(t) }
+
+func (t *FieldType) UnmarshalText(text []byte) error {
+	known, err := fieldTypes.unmarshal(text)
+	if err == nil {
+		*t = known.(FieldType)
+	}
+	return err
+}
+
+var quantifierKinds = &enum{"quantifier kind", []fmt.Stringer{
+	ALL_QUANTIFIER, ANY_QUANTIFIER, NONE_QUANTIFIER, AT_LEAST_QUANTIFIER, AT_MOST_QUANTIFIER,
+}}
+
+func (k QuantifierKind) MarshalText() ([]byte, error) { return quantifierKinds.marshal(k) }
+
+func (k *QuantifierKind) UnmarshalText(text []byte) error {
+	known, err := quantifierKinds.unmarshal(text)
+	if err == nil {
+		*k = known.(QuantifierKind)
+	}
+	return err
+}
+
+var presenceKinds = &enum{"presence kind", []fmt.Stringer{EXISTS_PRESENCE, MISSING_PRESENCE, ZERO_PRESENCE}}
+
+func (k PresenceKind) MarshalText() ([]byte, error) { return presenceKinds.marshal(k) }
+
+func (k *PresenceKind) UnmarshalText(text []byte) error {
+	known, err := presenceKinds.unmarshal(text)
+	if err == nil {
+		*k = known.(PresenceKind)
+	}
+	return err
+}
+
+var severities = &enum{"severity", []fmt.Stringer{INFO_SEVERITY, WARNING_SEVERITY, ERROR_SEVERITY, CRITICAL_SEVERITY}}
+
+func (s Severity) MarshalText() ([]byte, error) { return severities.marshal(s) }
+
+func (s *Severity) UnmarshalText(text []byte) error {
+	known, err := severities.unmarshal(text)
+	if err == nil {
+		*s = known.(Severity)
+	}
+	return err
+}
+
+var patchTypes = &enum{"patch type", []fmt.Stringer{JSON_PATCH, STRATEGIC_MERGE_PATCH}}
+
+func (t PatchType) MarshalText() ([]byte, error) { return patchTypes.marshal(t) }
+
+func (t *PatchType) UnmarshalText(text []byte) error {
+	known, err := patchTypes.unmarshal(text)
+	if err == nil {
+		*t = known.(PatchType)
+	}
+	return err
+}
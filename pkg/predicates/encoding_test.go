@@ -0,0 +1,141 @@
+package predicates
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestDescriptorRoundTrip(t *testing.T) {
+	d := Conjunction(
+		Field("metadata", RequiredLabels("app.kubernetes.io/name", "team")),
+		Disjunction(Field("spec.priority", NumberValue(">=5")), Not(Missing("spec.nodeName"))),
+		All("spec.containers", Conjunction(
+			Field("image", ImageValue(ImagePredicateDescriptor{Registries: []string{"gcr.io"}, ForbiddenTags: []string{"latest"}})),
+			Field("resources.limits.memory", QuantityValue("<=1Gi")),
+		)),
+		CountAtMost(1, "spec.containers", IsZero("livenessProbe")),
+		NoKey("metadata.annotations", StringValue("=~^debug/")),
+		Field("spec", CompareField(NUMERICAL_FIELD, "<=", "terminationGracePeriodSeconds")),
+		CEL("self.spec.containers.size() < 10"),
+		&PredicateDescriptor{Ref: "org/labels@2"},
+	)
+
+	encoded, err := json.Marshal(d)
+	require.NoError(t, err)
+	parsed, err := ParseDescriptor(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, d, parsed)
+	decoded := &PredicateDescriptor{}
+	require.NoError(t, json.Unmarshal(encoded, decoded))
+	assert.Equal(t, d, decoded)
+
+	encoded, err = yaml.Marshal(d)
+	require.NoError(t, err)
+	parsed, err = ParseDescriptor(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, d, parsed)
+	decoded = &PredicateDescriptor{}
+	require.NoError(t, yaml.Unmarshal(encoded, decoded))
+	assert.Equal(t, d, decoded)
+
+	// YAML aliases are resolved.
+	parsed, err = ParseDescriptor([]byte(`{or: [&labels {ref: org/labels}, {not: *labels}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, Disjunction(&PredicateDescriptor{Ref: "org/labels"}, Not(&PredicateDescriptor{Ref: "org/labels"})), parsed)
+}
+
+func TestParseDescriptorErrors(t *testing.T) {
+	for doc, expected := range map[string]string{
+		``:                   "line 1, column 1: empty document",
+		`[]`:                 "line 1, column 1: expected a predicate object",
+		`{}`:                 "line 1, column 1: empty predicate",
+		`{and: [], or: []}`:  "line 1, column 11: predicate has both \"and\" and \"or\", expected exactly one",
+		`{nand: []}`:         "line 1, column 2: unknown predicate \"nand\", expected one of and, or, not, field, quantifier, presence, value, image, cel or ref",
+		`{and: []}`:          "line 1, column 7: empty list of predicates",
+		`{and: {}}`:          "line 1, column 7: expected a list of predicates",
+		`{not: {ref: ""}}`:   "line 1, column 13: empty reference",
+		`{field: {path: a}}`: "line 1, column 9: missing required key \"predicate\"",
+		`{field: {path: [a], predicate: {ref: x}}}`:                       "line 1, column 16: expected a string",
+		`{field: {path: a, pat: b, predicate: {ref: x}}}`:                 "line 1, column 19: unknown key \"pat\", expected one of path, predicate",
+		`{presence: {kind: exists, kind: missing}}`:                       "line 1, column 27: duplicate key \"kind\"",
+		`{presence: {kind: there}}`:                                       "line 1, column 19: unknown presence kind \"there\", expected one of exists, missing, zero",
+		`{quantifier: {kind: atLeast, count: many, predicate: {ref: x}}}`: "line 1, column 37: expected an integer",
+		`{quantifier: {kind: all, keys: sure, predicate: {ref: x}}}`:      "line 1, column 32: expected a boolean",
+		`{value: {type: number, value: ">>5"}}`:                           "line 1, column 31: invalid number value \">>5\": strconv.ParseFloat: parsing \">5\": invalid syntax",
+		`{value: {type: number, value: "~", reference: a}}`:               "line 1, column 31: invalid number value \"~\": expected only an operator when comparing to a field, found \"~\"",
+		`{image: {registries: gcr.io}}`:                                   "line 1, column 22: expected a list of strings",
+		`{image: {tagPattern: "("}}`:                                      "line 1, column 9: invalid image predicate: error parsing regexp: missing closing ): `(`",
+		`{cel: {message: m}}`:                                             "line 1, column 7: missing required key \"rule\"",
+	} {
+		_, err := ParseDescriptor([]byte(doc))
+		if assert.IsType(t, &DescriptorError{}, err, doc) {
+			assert.EqualError(t, err, expected, doc)
+		}
+	}
+}
+
+// Errors give positions in the whole document, whichever format it is written in.
+func TestDescriptorErrorPositions(t *testing.T) {
+	for _, c := range []struct {
+		doc    string
+		column int
+	}{{
+		doc: `name: no-latest
+predicate:
+  field:
+    path: spec.containers.image
+    predicate: {value: {type: string, value: "=~("}}
+`,
+		column: 46,
+	}, {
+		doc: `{
+  "name": "no-latest",
+  "predicate": {"field": {
+    "path": "spec.containers.image",
+    "predicate": {"value": {"type": "string", "value": "=~("}}
+  }}
+}`,
+		column: 56,
+	}} {
+		_, err := ParsePolicy([]byte(c.doc))
+		assert.Equal(t, &DescriptorError{
+			Line:    5,
+			Column:  c.column,
+			Message: "invalid string value \"=~(\": error parsing regexp: missing closing ): `(`",
+		}, err, c.doc)
+	}
+
+	// encoding/json hands the descriptor only its own bytes, so its errors leave out the position.
+	var policy Policy
+	err := json.Unmarshal([]byte(`{"name": "n",
+		"predicate": {"presence": {"kind": "there"}}}`), &policy)
+	assert.Equal(t, &DescriptorError{Message: `unknown presence kind "there", expected one of exists, missing, zero`}, err)
+	assert.EqualError(t, err, `invalid predicate: unknown presence kind "there", expected one of exists, missing, zero`)
+}
+
+func TestEnumText(t *testing.T) {
+	for _, e := range []*enum{fieldTypes, quantifierKinds, presenceKinds, severities, patchTypes} {
+		for _, value := range e.values {
+			text, err := e.marshal(value)
+			require.NoError(t, err)
+			parsed, err := e.unmarshal(text)
+			require.NoError(t, err)
+			assert.Equal(t, value, parsed)
+		}
+	}
+
+	var severity Severity
+	require.NoError(t, severity.UnmarshalText([]byte("critical")))
+	assert.Equal(t, CRITICAL_SEVERITY, severity)
+	assert.EqualError(t, severity.UnmarshalText([]byte("fatal")),
+		`unknown severity "fatal", expected one of info, warning, error, critical`)
+	assert.Equal(t, CRITICAL_SEVERITY, severity)
+	_, err := Severity(9).MarshalText()
+	assert.EqualError(t, err, "unknown severity 9")
+	_, err = json.Marshal(Field("spec", &PredicateDescriptor{Base: &BasePredicateDescriptor{Type: FieldType(99)}}))
+	assert.Error(t, err)
+}
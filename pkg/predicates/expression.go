@@ -0,0 +1,881 @@
+package predicates
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Predicates can also be written in a small expression language, which is easier to read and write by hand than the
+// JSON and YAML forms. For example:
+//
+//	all(spec.containers, livenessProbe exists and (livenessProbe.httpGet.port >= 0 or livenessProbe.exec.command matches "\w"))
+//	  and not spec.hostNetwork == true
+//
+// The grammar is:
+//
+//	expr      := term ("or" term)*
+//	term      := unary ("and" unary)*
+//	unary     := "not" unary | primary
+//	primary   := "(" expr ")"
+//	           | ("all" | "any" | "none") "(" elements "," expr ")"
+//	           | ("atLeast" | "atMost") "(" integer "," elements "," expr ")"
+//	           | "ref" "(" string ")"           the registered descriptor a name refers to, e.g. "port-validator@v2"
+//	           | path "{" expr "}"              the expression must hold for the value at path
+//	           | path ("exists" | "missing" | "zero")
+//	           | path "is" type                 the value at path is any value of the type
+//	           | path "is" "image" ["(" image ("," image)* ")"]
+//	                                            the value at path is an image reference meeting every constraint
+//	           | path ("olderThan" | "newerThan") string
+//	                                            the datetime at path is older or newer than an age, e.g. "30d"
+//	           | path "satisfies" string ["message" string]
+//	                                            the value at path satisfies a CEL rule, see CELPredicateDescriptor
+//	           | path operator literal
+//	elements  := path | "keys" "(" path ")"     the elements of a list, or the values or keys of a map
+//	path      := "@" | (name | "[" string "]") ("." name | "[" string "]")*
+//	                                            "@" is the current value, and brackets select map keys
+//	operator  := "==" | "!=" | "<" | "<=" | ">" | ">=" | "=~" | "!~" | "matches"
+//	literal   := number | "true" | "false" | string | type "(" (string | number) ")" | reference
+//	           | type "(" reference ")"
+//	reference := "ref" "(" path ")"             the value of another field, compared as a number unless typed
+//	type      := "string" | "uri" | "number" | "datetime" | "boolean" | "quantity" | "duration"
+//	image     := "registry" string | "repository" string | "forbidTag" string | "tagPattern" string
+//	           | "semver" | "digest"
+//
+// Image constraints are those of ImagePredicateDescriptor; registry and forbidTag may be repeated. For example:
+//
+//	all(spec.containers, image is image(registry "gcr.io", repository "team/**", forbidTag "latest", digest))
+//
+// Both sides of a comparison to a reference are resolved from the same value, so in
+//
+//	all(spec.containers, livenessProbe.initialDelaySeconds >= ref(readinessProbe.initialDelaySeconds))
+//
+// each container's liveness probe delay is compared to the same container's readiness probe delay.
+//
+// Strings are written in double quotes, where \" stands for a quote and every other character is taken literally, or
+// in backquotes with no escapes at all. Numbers and booleans compare as number and boolean values, strings compare as
+// string values, and other types are written with their type name, e.g. datetime("2020-01-01T00:00:00.000Z") or
+// quantity("512Mi").
+
+// ParseExpression compiles an expression into a descriptor. Errors are *DescriptorError values giving the position of
+// the problem.
+func ParseExpression(expression string) (*PredicateDescriptor, error) {
+	tokens, err := tokenize(expression)
+	if err != nil {
+		return nil, err
+	}
+	p := &expressionParser{tokens: tokens}
+	d, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if next := p.peek(); next.kind != eofToken {
+		return nil, next.errorf("unexpected %s after expression", next)
+	}
+	return d, nil
+}
+
+// FormatExpression renders a descriptor in the expression language. ParseExpression reads the result back into an
+// equivalent descriptor.
+func FormatExpression(d *PredicateDescriptor) (string, error) {
+	return formatExpression(d, orPrecedence)
+}
+
+// Tokens.
+//////////
+
+type tokenKind int
+
+const (
+	eofToken tokenKind = iota
+	nameToken
+	numberToken
+	stringToken
+	operatorToken
+	punctuationToken
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	value  string
+	line   int
+	column int
+}
+
+func (t token) String() string {
+	if t.kind == eofToken {
+		return "end of expression"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+func (t token) is(kind tokenKind, text string) bool {
+	return t.kind == kind && t.text == text
+}
+
+func (t token) errorf(format string, args ...interface{}) error {
+	return &DescriptorError{Line: t.line, Column: t.column, Message: fmt.Sprintf(format, args...)}
+}
+
+func tokenize(expression string) ([]token, error) {
+	runes := []rune(expression)
+	var tokens []token
+	line, column := 1, 1
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := token{line: line, column: column}
+		length := 1
+		switch {
+		case r == '\n':
+			line, column = line+1, 1
+			i++
+			continue
+		case unicode.IsSpace(r):
+			i, column = i+1, column+1
+			continue
+		case unicode.IsLetter(r) || r == '_' || r == '$':
+			for length < len(runes)-i && isNameRune(runes[i+length]) {
+				length++
+			}
+			start.kind = nameToken
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			for length < len(runes)-i && (unicode.IsDigit(runes[i+length]) || strings.ContainsRune(".eE+-", runes[i+length])) {
+				length++
+			}
+			start.kind = numberToken
+		case r == '"' || r == '`':
+			value, n, err := scanString(runes[i:])
+			if err != nil {
+				return nil, start.errorf("%v", err)
+			}
+			start.kind, start.value, length = stringToken, value, n
+		case strings.ContainsRune("=!<>", r):
+			if i+1 < len(runes) && strings.ContainsRune("=~", runes[i+1]) {
+				length = 2
+			}
+			start.kind = operatorToken
+		case strings.ContainsRune("(){}[],.@", r):
+			start.kind = punctuationToken
+		default:
+			return nil, start.errorf("unexpected character %q", r)
+		}
+		start.text = string(runes[i : i+length])
+		if start.kind == operatorToken && !isOperator(start.text) {
+			return nil, start.errorf("unknown operator %q", start.text)
+		}
+		if start.kind != stringToken {
+			start.value = start.text
+		}
+		tokens = append(tokens, start)
+		i, column = i+length, column+length
+	}
+	return append(tokens, token{kind: eofToken, line: line, column: column}), nil
+}
+
+func isNameRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '$'
+}
+
+func isOperator(text string) bool {
+	for _, op := range operators {
+		if op == text {
+			return true
+		}
+	}
+	return false
+}
+
+// scanString reads a quoted string from the start of runes, returning its value and how many runes it spans.
+func scanString(runes []rune) (string, int, error) {
+	quote := runes[0]
+	var value []rune
+	for i := 1; i < len(runes); i++ {
+		switch {
+		case runes[i] == quote:
+			return string(value), i + 1, nil
+		case quote == '"' && runes[i] == '\\' && i+1 < len(runes) && runes[i+1] == '"':
+			value = append(value, '"')
+			i++
+		default:
+			value = append(value, runes[i])
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string")
+}
+
+// Parsing.
+///////////
+
+var quantifierNames = map[string]QuantifierKind{
+	"all":     ALL_QUANTIFIER,
+	"any":     ANY_QUANTIFIER,
+	"none":    NONE_QUANTIFIER,
+	"atLeast": AT_LEAST_QUANTIFIER,
+	"atMost":  AT_MOST_QUANTIFIER,
+}
+
+var presenceNames = map[string]PresenceKind{
+	"exists":  EXISTS_PRESENCE,
+	"missing": MISSING_PRESENCE,
+	"zero":    ZERO_PRESENCE,
+}
+
+type expressionParser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *expressionParser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *expressionParser) peekAt(offset int) token {
+	if p.pos+offset >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
+	}
+	return p.tokens[p.pos+offset]
+}
+
+func (p *expressionParser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != eofToken {
+		p.pos++
+	}
+	return t
+}
+
+func (p *expressionParser) expect(kind tokenKind, text string) error {
+	if t := p.next(); !t.is(kind, text) {
+		return t.errorf("expected %q, found %s", text, t)
+	}
+	return nil
+}
+
+func (p *expressionParser) parseOr() (*PredicateDescriptor, error) {
+	return p.parseList("or", p.parseAnd, Disjunction)
+}
+
+func (p *expressionParser) parseAnd() (*PredicateDescriptor, error) {
+	return p.parseList("and", p.parseUnary, Conjunction)
+}
+
+func (p *expressionParser) parseList(
+	keyword string,
+	parseOperand func() (*PredicateDescriptor, error),
+	combine func(...*PredicateDescriptor) *PredicateDescriptor,
+) (*PredicateDescriptor, error) {
+	first, err := parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	operands := []*PredicateDescriptor{first}
+	for p.peek().is(nameToken, keyword) {
+		p.next()
+		operand, err := parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, operand)
+	}
+	if len(operands) == 1 {
+		return first, nil
+	}
+	return combine(operands...), nil
+}
+
+func (p *expressionParser) parseUnary() (*PredicateDescriptor, error) {
+	if p.peek().is(nameToken, "not") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return Not(operand), nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *expressionParser) parsePrimary() (*PredicateDescriptor, error) {
+	t := p.peek()
+	if t.is(punctuationToken, "(") {
+		p.next()
+		d, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(punctuationToken, ")"); err != nil {
+			return nil, err
+		}
+		return d, nil
+	}
+	if kind, ok := quantifierNames[t.text]; ok && t.kind == nameToken && p.peekAt(1).is(punctuationToken, "(") {
+		return p.parseQuantifier(kind)
+	}
+	if t.is(nameToken, "ref") && p.peekAt(1).is(punctuationToken, "(") {
+		p.next()
+		p.next()
+		ref := p.next()
+		if ref.kind != stringToken || ref.value == "" {
+			return nil, ref.errorf("expected the name of a registered descriptor, found %s", ref)
+		}
+		if err := p.expect(punctuationToken, ")"); err != nil {
+			return nil, err
+		}
+		return Ref(ref.value), nil
+	}
+	pathToken := p.peek()
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	t = p.next()
+	if t.is(punctuationToken, "{") {
+		if path == "" {
+			return nil, pathToken.errorf("expected a field path before \"{\"")
+		}
+		d, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(punctuationToken, "}"); err != nil {
+			return nil, err
+		}
+		return Field(path, d), nil
+	}
+	if kind, ok := presenceNames[t.text]; ok && t.kind == nameToken {
+		return presence(kind, path), nil
+	}
+	var base *PredicateDescriptor
+	if t.is(nameToken, "is") && p.peek().is(nameToken, "image") {
+		p.next()
+		if base, err = p.parseImage(); err != nil {
+			return nil, err
+		}
+	} else if t.is(nameToken, "is") {
+		typeToken := p.next()
+		fType, err := parseTypeName(typeToken)
+		if err != nil {
+			return nil, err
+		}
+		base = &PredicateDescriptor{Base: &BasePredicateDescriptor{Type: fType}}
+	} else if t.is(nameToken, olderThan) || t.is(nameToken, newerThan) {
+		ageToken := p.next()
+		if ageToken.kind != stringToken {
+			return nil, ageToken.errorf("expected an age such as \"30d\", found %s", ageToken)
+		}
+		value := fmt.Sprintf("%s %s", t.text, ageToken.value)
+		if _, err := parseValueMatcher(DATETIME_FIELD, value, time.Now); err != nil {
+			return nil, ageToken.errorf("invalid age: %v", err)
+		}
+		base = DateTimeValue(value)
+	} else if t.is(nameToken, "satisfies") {
+		if base, err = p.parseCEL(); err != nil {
+			return nil, err
+		}
+	} else if t.kind == operatorToken || t.is(nameToken, "matches") {
+		if base, err = p.parseComparison(t); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, t.errorf("expected an operator, \"{\", exists, missing, zero, is or satisfies after %s, found %s", displayPath(path), t)
+	}
+	if path == "" {
+		return base, nil
+	}
+	return Field(path, base), nil
+}
+
+func (p *expressionParser) parseCEL() (*PredicateDescriptor, error) {
+	ruleToken := p.next()
+	if ruleToken.kind != stringToken {
+		return nil, ruleToken.errorf("expected a CEL rule, found %s", ruleToken)
+	}
+	cel := &CELPredicateDescriptor{Rule: ruleToken.value}
+	if p.peek().is(nameToken, "message") {
+		p.next()
+		messageToken := p.next()
+		if messageToken.kind != stringToken {
+			return nil, messageToken.errorf("expected a message, found %s", messageToken)
+		}
+		cel.Message = messageToken.value
+	}
+	return &PredicateDescriptor{CEL: cel}, nil
+}
+
+func (p *expressionParser) parseImage() (*PredicateDescriptor, error) {
+	image := ImagePredicateDescriptor{}
+	if !p.peek().is(punctuationToken, "(") {
+		return ImageValue(image), nil
+	}
+	start := p.next()
+	for {
+		t := p.next()
+		if t.kind != nameToken {
+			return nil, t.errorf("expected an image constraint, found %s", t)
+		}
+		switch t.text {
+		case "semver":
+			image.RequireSemver = true
+		case "digest":
+			image.RequireDigest = true
+		case "registry", "repository", "forbidTag", "tagPattern":
+			arg := p.next()
+			if arg.kind != stringToken {
+				return nil, arg.errorf("expected a string after %s, found %s", t.text, arg)
+			}
+			switch t.text {
+			case "registry":
+				image.Registries = append(image.Registries, arg.value)
+			case "repository":
+				image.Repository = arg.value
+			case "forbidTag":
+				image.ForbiddenTags = append(image.ForbiddenTags, arg.value)
+			case "tagPattern":
+				image.TagPattern = arg.value
+			}
+		default:
+			return nil, t.errorf("unknown image constraint %s, expected registry, repository, forbidTag, tagPattern, semver or digest", t)
+		}
+		if !p.peek().is(punctuationToken, ",") {
+			break
+		}
+		p.next()
+	}
+	if err := p.expect(punctuationToken, ")"); err != nil {
+		return nil, err
+	}
+	if _, err := compileImageChecks(&image); err != nil {
+		return nil, start.errorf("invalid image predicate: %v", err)
+	}
+	return ImageValue(image), nil
+}
+
+func (p *expressionParser) parseQuantifier(kind QuantifierKind) (*PredicateDescriptor, error) {
+	p.next()
+	if err := p.expect(punctuationToken, "("); err != nil {
+		return nil, err
+	}
+	count := 0
+	if kind == AT_LEAST_QUANTIFIER || kind == AT_MOST_QUANTIFIER {
+		t := p.next()
+		n, err := strconv.Atoi(t.text)
+		if t.kind != numberToken || err != nil || n < 0 {
+			return nil, t.errorf("expected a count, found %s", t)
+		}
+		count = n
+		if err := p.expect(punctuationToken, ","); err != nil {
+			return nil, err
+		}
+	}
+	keys := p.peek().is(nameToken, "keys") && p.peekAt(1).is(punctuationToken, "(")
+	if keys {
+		p.next()
+		p.next()
+	}
+	path, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	if keys {
+		if err := p.expect(punctuationToken, ")"); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(punctuationToken, ","); err != nil {
+		return nil, err
+	}
+	d, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(punctuationToken, ")"); err != nil {
+		return nil, err
+	}
+	q := quantifier(kind, count, path, d)
+	q.Quantifier.Keys = keys
+	return q, nil
+}
+
+// parsePath reads a dotted field path, returning the empty path for "@".
+func (p *expressionParser) parsePath() (string, error) {
+	if p.peek().is(punctuationToken, "@") {
+		p.next()
+		return "", nil
+	}
+	path := ""
+	for {
+		t := p.peek()
+		if path == "" && t.kind == nameToken {
+			p.next()
+			path = t.text
+		} else if path != "" && t.is(punctuationToken, ".") {
+			p.next()
+			t = p.next()
+			if t.kind != nameToken {
+				return "", t.errorf("expected a field name, found %s", t)
+			}
+			path = fmt.Sprintf("%s.%s", path, t.text)
+		} else if t.is(punctuationToken, "[") {
+			p.next()
+			t = p.next()
+			if t.kind != stringToken {
+				return "", t.errorf("expected a quoted key, found %s", t)
+			}
+			if err := p.expect(punctuationToken, "]"); err != nil {
+				return "", err
+			}
+			path = fmt.Sprintf("%s[%s]", path, strconv.Quote(t.value))
+		} else if path == "" {
+			return "", t.errorf("expected a field path, found %s", t)
+		} else {
+			return path, nil
+		}
+	}
+}
+
+func (p *expressionParser) parseComparison(opToken token) (*PredicateDescriptor, error) {
+	op := opToken.text
+	t := p.next()
+	fType, operand := STRING_FIELD, t.value
+	var reference string
+	switch {
+	case t.is(nameToken, "ref") && p.peek().is(punctuationToken, "("):
+		fType = NUMERICAL_FIELD
+		var err error
+		if reference, err = p.parseReference(t); err != nil {
+			return nil, err
+		}
+	case t.kind == numberToken:
+		fType = NUMERICAL_FIELD
+	case t.is(nameToken, "true") || t.is(nameToken, "false"):
+		fType = BOOLEAN_FIELD
+	case t.kind == stringToken:
+	case t.kind == nameToken && p.peek().is(punctuationToken, "("):
+		var err error
+		if fType, err = parseTypeName(t); err != nil {
+			return nil, err
+		}
+		p.next()
+		t = p.next()
+		if t.is(nameToken, "ref") && p.peek().is(punctuationToken, "(") {
+			if reference, err = p.parseReference(t); err != nil {
+				return nil, err
+			}
+		} else if t.kind == stringToken || t.kind == numberToken {
+			operand = t.value
+		} else {
+			return nil, t.errorf("expected a string, number or reference, found %s", t)
+		}
+		if err := p.expect(punctuationToken, ")"); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, t.errorf("expected a value, found %s", t)
+	}
+	if reference != "" {
+		if _, err := parseValueComparator(fType, op); err != nil {
+			return nil, opToken.errorf("invalid %s comparison: %v", fType, err)
+		}
+		return CompareField(fType, op, reference), nil
+	}
+	value := op + operand
+	if op == "matches" || op == opMatch {
+		// Plain patterns are stored without an operator, unless they would be mistaken for one.
+		if leading, _ := splitOperator(operand); leading == "" && strings.TrimSpace(operand) == operand {
+			value = operand
+		} else {
+			value = opMatch + operand
+		}
+	}
+	if _, err := parseValueMatcher(fType, value, time.Now); err != nil {
+		return nil, opToken.errorf("invalid %s comparison: %v", fType, err)
+	}
+	return &PredicateDescriptor{Base: &BasePredicateDescriptor{Type: fType, Value: value}}, nil
+}
+
+// parseReference reads the path of a ref(...) literal, whose name has already been read.
+func (p *expressionParser) parseReference(refToken token) (string, error) {
+	p.next()
+	pathToken := p.peek()
+	path, err := p.parsePath()
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return "", pathToken.errorf("expected a field path to refer to")
+	}
+	if err := p.expect(punctuationToken, ")"); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+func parseTypeName(t token) (FieldType, error) {
+	var fType FieldType
+	if t.kind != nameToken || fType.UnmarshalText([]byte(t.text)) != nil {
+		return 0, t.errorf("expected a type name, found %s", t)
+	}
+	return fType, nil
+}
+
+// Formatting.
+//////////////
+
+const (
+	orPrecedence = iota
+	andPrecedence
+	unaryPrecedence
+)
+
+func formatExpression(d *PredicateDescriptor, precedence int) (string, error) {
+	if d == nil {
+		return "", fmt.Errorf("received a nil descriptor")
+	}
+	if d.Field != nil {
+		path, err := expressionPath(d.Field.Path)
+		if err != nil {
+			return "", err
+		}
+		if d.Field.Descriptor != nil && d.Field.Descriptor.Base != nil {
+			return formatBase(path, d.Field.Descriptor.Base)
+		}
+		if d.Field.Descriptor != nil && d.Field.Descriptor.Image != nil {
+			return formatImage(path, d.Field.Descriptor.Image)
+		}
+		if d.Field.Descriptor != nil && d.Field.Descriptor.CEL != nil {
+			return formatCEL(path, d.Field.Descriptor.CEL)
+		}
+		child, err := formatExpression(d.Field.Descriptor, orPrecedence)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s { %s }", path, child), nil
+	} else if d.Quantifier != nil {
+		q := d.Quantifier
+		child, err := formatExpression(q.Descriptor, orPrecedence)
+		if err != nil {
+			return "", err
+		}
+		path, err := expressionPath(q.Path)
+		if err != nil {
+			return "", err
+		}
+		path = formatPath(path)
+		if q.Keys {
+			path = fmt.Sprintf("keys(%s)", path)
+		}
+		if q.Kind == AT_LEAST_QUANTIFIER || q.Kind == AT_MOST_QUANTIFIER {
+			return fmt.Sprintf("%s(%d, %s, %s)", q.Kind, q.Count, path, child), nil
+		}
+		return fmt.Sprintf("%s(%s, %s)", q.Kind, path, child), nil
+	} else if d.Presence != nil {
+		path, err := expressionPath(d.Presence.Path)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s", formatPath(path), d.Presence.Kind), nil
+	} else if len(d.And) != 0 {
+		return formatList(d.And, "and", andPrecedence, precedence)
+	} else if len(d.Or) != 0 {
+		return formatList(d.Or, "or", orPrecedence, precedence)
+	} else if d.Negate != nil {
+		child, err := formatExpression(d.Negate, unaryPrecedence)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("not %s", child), nil
+	} else if d.Base != nil {
+		return formatBase("", d.Base)
+	} else if d.Image != nil {
+		return formatImage("", d.Image)
+	} else if d.CEL != nil {
+		return formatCEL("", d.CEL)
+	} else if d.Ref != "" {
+		name, err := quoteString(d.Ref)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("ref(%s)", name), nil
+	}
+	return "", fmt.Errorf("cannot format an empty descriptor")
+}
+
+func formatList(ds []*PredicateDescriptor, keyword string, listPrecedence, precedence int) (string, error) {
+	if len(ds) == 1 {
+		return formatExpression(ds[0], precedence)
+	}
+	parts := make([]string, 0, len(ds))
+	for _, d := range ds {
+		// Operands of the same precedence are parenthesized so that nesting is preserved.
+		part, err := formatExpression(d, listPrecedence+1)
+		if err != nil {
+			return "", err
+		}
+		parts = append(parts, part)
+	}
+	joined := strings.Join(parts, fmt.Sprintf(" %s ", keyword))
+	if precedence > listPrecedence {
+		return fmt.Sprintf("(%s)", joined), nil
+	}
+	return joined, nil
+}
+
+func formatPath(path string) string {
+	if path == "" {
+		return "@"
+	}
+	return path
+}
+
+// expressionPath renders a json path in the expression syntax. Steps that cannot be read as a name, such as
+// `my-label`, are written as quoted keys, as is a leading step that would read as the "not" keyword.
+func expressionPath(jsonPath string) (string, error) {
+	if jsonPath == "" {
+		return "", nil
+	}
+	segments, err := splitJSONPath(jsonPath)
+	if err != nil {
+		return "", err
+	}
+	var path strings.Builder
+	for i, segment := range segments {
+		if plainKeyRegexp.MatchString(segment.name) && (i != 0 || segment.name != "not") {
+			if i != 0 {
+				path.WriteString(".")
+			}
+			path.WriteString(segment.name)
+			continue
+		}
+		key, err := quoteString(segment.name)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&path, "[%s]", key)
+	}
+	return path.String(), nil
+}
+
+func formatBase(path string, base *BasePredicateDescriptor) (string, error) {
+	op, operand := splitOperator(base.Value)
+	if base.Reference != "" {
+		reference, err := expressionPath(base.Reference)
+		if err != nil {
+			return "", err
+		}
+		if base.Type == NUMERICAL_FIELD {
+			return fmt.Sprintf("%s %s ref(%s)", formatPath(path), op, reference), nil
+		}
+		return fmt.Sprintf("%s %s %s(ref(%s))", formatPath(path), op, base.Type, reference), nil
+	}
+	if op == "" && operand == "" {
+		return fmt.Sprintf("%s is %s", formatPath(path), base.Type), nil
+	}
+	if relation, age, ok := splitRelativeDate(base.Value); ok && base.Type == DATETIME_FIELD {
+		quoted, err := quoteString(age)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s %s", formatPath(path), relation, quoted), nil
+	}
+	var literal string
+	switch base.Type {
+	case NUMERICAL_FIELD:
+		if _, err := parseNum(operand); err == nil {
+			literal = operand
+		}
+	case BOOLEAN_FIELD:
+		if op == "" {
+			op = opEqual
+		}
+		if _, err := strconv.ParseBool(operand); err == nil {
+			literal = strings.ToLower(operand)
+		}
+	case STRING_FIELD:
+		quoted, err := quoteString(operand)
+		if err != nil {
+			return "", err
+		}
+		literal = quoted
+	}
+	if literal == "" {
+		quoted, err := quoteString(operand)
+		if err != nil {
+			return "", err
+		}
+		literal = fmt.Sprintf("%s(%s)", base.Type, quoted)
+	}
+	if op == "" || op == opMatch {
+		op = "matches"
+	}
+	return fmt.Sprintf("%s %s %s", formatPath(path), op, literal), nil
+}
+
+func formatImage(path string, image *ImagePredicateDescriptor) (string, error) {
+	var constraints []string
+	quoted := func(keyword, value string) error {
+		q, err := quoteString(value)
+		if err != nil {
+			return err
+		}
+		constraints = append(constraints, fmt.Sprintf("%s %s", keyword, q))
+		return nil
+	}
+	for _, registry := range image.Registries {
+		if err := quoted("registry", registry); err != nil {
+			return "", err
+		}
+	}
+	if image.Repository != "" {
+		if err := quoted("repository", image.Repository); err != nil {
+			return "", err
+		}
+	}
+	for _, tag := range image.ForbiddenTags {
+		if err := quoted("forbidTag", tag); err != nil {
+			return "", err
+		}
+	}
+	if image.TagPattern != "" {
+		if err := quoted("tagPattern", image.TagPattern); err != nil {
+			return "", err
+		}
+	}
+	if image.RequireSemver {
+		constraints = append(constraints, "semver")
+	}
+	if image.RequireDigest {
+		constraints = append(constraints, "digest")
+	}
+	if len(constraints) == 0 {
+		return fmt.Sprintf("%s is image", formatPath(path)), nil
+	}
+	return fmt.Sprintf("%s is image(%s)", formatPath(path), strings.Join(constraints, ", ")), nil
+}
+
+func quoteString(s string) (string, error) {
+	if !strings.Contains(s, `"`) && !strings.HasSuffix(s, `\`) {
+		return fmt.Sprintf(`"%s"`, s), nil
+	}
+	if !strings.Contains(s, "`") {
+		return fmt.Sprintf("`%s`", s), nil
+	}
+	return "", fmt.Errorf("cannot quote string containing both quotes and backquotes: %s", s)
+}
+
+func formatCEL(path string, cel *CELPredicateDescriptor) (string, error) {
+	rule, err := quoteString(cel.Rule)
+	if err != nil {
+		return "", err
+	}
+	if cel.Message == "" {
+		return fmt.Sprintf("%s satisfies %s", formatPath(path), rule), nil
+	}
+	message, err := quoteString(cel.Message)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s satisfies %s message %s", formatPath(path), rule, message), nil
+}
@@ -0,0 +1,215 @@
+package predicates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestParseExpression(t *testing.T) {
+	for expression, expected := range map[string]*PredicateDescriptor{
+		`spec.hostname == "a"`:                             Field("spec.hostname", StringValue("==a")),
+		"spec.hostname != `say \"hi\"`":                    Field("spec.hostname", StringValue(`!=say "hi"`)),
+		`spec.hostname == "say \"hi\""`:                    Field("spec.hostname", StringValue(`==say "hi"`)),
+		`spec.hostname matches "^a"`:                       Field("spec.hostname", StringValue("^a")),
+		`spec.hostname =~ ">a"`:                            Field("spec.hostname", StringValue("=~>a")),
+		`spec.hostname !~ "^a"`:                            Field("spec.hostname", StringValue("!~^a")),
+		`spec.priority >= -5`:                              Field("spec.priority", NumberValue(">=-5")),
+		`spec.hostNetwork == true`:                         Field("spec.hostNetwork", BooleanValue("==true")),
+		`@ < quantity("1Gi")`:                              QuantityValue("<1Gi"),
+		`spec.priority is number`:                          Field("spec.priority", &PredicateDescriptor{Base: &BasePredicateDescriptor{Type: NUMERICAL_FIELD}}),
+		`metadata.labels["app.kubernetes.io/name"] exists`: Exists(`metadata.labels["app.kubernetes.io/name"]`),
+		`spec.nodeName missing`:                            Missing("spec.nodeName"),
+		`@ zero`:                                           IsZero(""),
+		`metadata.creationTimestamp olderThan "30d"`:       Field("metadata.creationTimestamp", DateTimeValue("olderThan 30d")),
+		`metadata.creationTimestamp newerThan "1h"`:        Field("metadata.creationTimestamp", DateTimeValue("newerThan 1h")),
+		`spec.priority <= ref(spec.maxPriority)`:           Field("spec.priority", CompareField(NUMERICAL_FIELD, "<=", "spec.maxPriority")),
+		`spec.deadline < datetime(ref(metadata.expires))`:  Field("spec.deadline", CompareField(DATETIME_FIELD, "<", "metadata.expires")),
+		`spec { hostname == "a" }`:                         Field("spec", Field("hostname", StringValue("==a"))),
+		`spec.containers satisfies "self.size() < 3" message "too many"`: Field("spec.containers",
+			&PredicateDescriptor{CEL: &CELPredicateDescriptor{Rule: "self.size() < 3", Message: "too many"}}),
+		`image is image`: Field("image", ImageValue(ImagePredicateDescriptor{})),
+		`image is image(registry "gcr.io", registry "ghcr.io", repository "team/**", forbidTag "latest", tagPattern "^v", semver, digest)`: Field("image",
+			ImageValue(ImagePredicateDescriptor{
+				Registries:    []string{"gcr.io", "ghcr.io"},
+				Repository:    "team/**",
+				ForbiddenTags: []string{"latest"},
+				TagPattern:    "^v",
+				RequireSemver: true,
+				RequireDigest: true,
+			})),
+		`ref("org/labels@2")`:                             Ref("org/labels@2"),
+		`all(spec.containers, name exists)`:               All("spec.containers", Exists("name")),
+		`any(@, @ == "a")`:                                Any("", StringValue("==a")),
+		`none(keys(metadata.labels), @ matches "^debug")`: NoKey("metadata.labels", StringValue("^debug")),
+		`atLeast(2, spec.containers, name exists)`:        CountAtLeast(2, "spec.containers", Exists("name")),
+		`atMost(0, keys(metadata.labels), @ == "x")`: func() *PredicateDescriptor {
+			d := CountAtMost(0, "metadata.labels", StringValue("==x"))
+			d.Quantifier.Keys = true
+			return d
+		}(),
+		"a exists\n\tand not b exists": Conjunction(Exists("a"), Not(Exists("b"))),
+	} {
+		d, err := ParseExpression(expression)
+		if assert.NoError(t, err, expression) {
+			assert.Equal(t, expected, d, expression)
+		}
+	}
+}
+
+func TestExpressionPrecedence(t *testing.T) {
+	a, b, c := Exists("a"), Exists("b"), Exists("c")
+	for expression, expected := range map[string]*PredicateDescriptor{
+		// not binds tighter than and, which binds tighter than or.
+		`a exists or b exists and c exists`:        Disjunction(a, Conjunction(b, c)),
+		`a exists and b exists or c exists`:        Disjunction(Conjunction(a, b), c),
+		`not a exists and b exists`:                Conjunction(Not(a), b),
+		`not not a exists`:                         Not(Not(a)),
+		`not (a exists or b exists)`:               Not(Disjunction(a, b)),
+		`(a exists or b exists) and c exists`:      Conjunction(Disjunction(a, b), c),
+		`a exists and (b exists and c exists)`:     Conjunction(a, Conjunction(b, c)),
+		`a exists or b exists or c exists`:         Disjunction(a, b, c),
+		`all(x, a exists or b exists) or c exists`: Disjunction(All("x", Disjunction(a, b)), c),
+	} {
+		d, err := ParseExpression(expression)
+		if assert.NoError(t, err, expression) {
+			assert.Equal(t, expected, d, expression)
+		}
+	}
+}
+
+func TestFormatExpression(t *testing.T) {
+	for _, c := range []struct {
+		d          *PredicateDescriptor
+		expression string
+	}{
+		{Field("spec.hostname", StringValue("==a")), `spec.hostname == "a"`},
+		{Field("spec.hostname", StringValue(`==say "hi"`)), "spec.hostname == `say \"hi\"`"},
+		{Field("spec.hostname", StringValue("^a")), `spec.hostname matches "^a"`},
+		{Field("spec.priority", NumberValue(">=5")), `spec.priority >= 5`},
+		{Field("spec.hostNetwork", BooleanValue("==true")), `spec.hostNetwork == true`},
+		{QuantityValue("<1Gi"), `@ < quantity("1Gi")`},
+		{Field("metadata.creationTimestamp", DateTimeValue("olderThan 30d")), `metadata.creationTimestamp olderThan "30d"`},
+		{Field("spec.priority", CompareField(NUMERICAL_FIELD, "<=", "spec.maxPriority")), `spec.priority <= ref(spec.maxPriority)`},
+		{Field("spec.deadline", CompareField(DATETIME_FIELD, "<", "metadata.expires")), `spec.deadline < datetime(ref(metadata.expires))`},
+		{Field("spec", Conjunction(Exists("hostname"), Missing("nodeName"))), `spec { hostname exists and nodeName missing }`},
+		{Field("image", ImageValue(ImagePredicateDescriptor{Registries: []string{"gcr.io"}, RequireDigest: true})), `image is image(registry "gcr.io", digest)`},
+		{CEL("self.size() < 3"), `@ satisfies "self.size() < 3"`},
+		{NoKey("metadata.labels", StringValue("^debug")), `none(keys(metadata.labels), @ matches "^debug")`},
+		{CountAtMost(1, "spec.containers", IsZero("")), `atMost(1, spec.containers, @ zero)`},
+		{Ref("org/labels@2"), `ref("org/labels@2")`},
+		// Steps that are not names are written as quoted keys.
+		{Field(`metadata.labels["app.kubernetes.io/name"]`, StringValue("==web")), `metadata.labels["app.kubernetes.io/name"] == "web"`},
+		{Field("metadata.labels", Exists(`["app.kubernetes.io/name"]`)), `metadata.labels { ["app.kubernetes.io/name"] exists }`},
+		{Field("spec.priority", CompareField(NUMERICAL_FIELD, "<=", `metadata.annotations["max-priority"]`)), `spec.priority <= ref(metadata.annotations["max-priority"])`},
+		{Exists(`["not"].a`), `["not"].a exists`},
+		// Nesting is kept with parentheses wherever precedence alone would lose it.
+		{Conjunction(Disjunction(Exists("a"), Exists("b")), Exists("c")), `(a exists or b exists) and c exists`},
+		{Disjunction(Conjunction(Exists("a"), Exists("b")), Exists("c")), `a exists and b exists or c exists`},
+		{Conjunction(Exists("a"), Conjunction(Exists("b"), Exists("c"))), `a exists and (b exists and c exists)`},
+		{Not(Conjunction(Exists("a"), Exists("b"))), `not (a exists and b exists)`},
+		{Not(Not(Exists("a"))), `not not a exists`},
+	} {
+		expression, err := FormatExpression(c.d)
+		if !assert.NoError(t, err, c.expression) {
+			continue
+		}
+		assert.Equal(t, c.expression, expression)
+		parsed, err := ParseExpression(expression)
+		if assert.NoError(t, err, expression) {
+			assert.Equal(t, c.d, parsed, expression)
+		}
+	}
+
+	for _, d := range []*PredicateDescriptor{nil, {}, Field("a", StringValue("`\"")), Ref("`\"")} {
+		_, err := FormatExpression(d)
+		assert.Error(t, err)
+	}
+}
+
+func TestFormatExpressionPaths(t *testing.T) {
+	// Dotted steps that are not names come back as quoted keys, which select the same values.
+	d := Field("metadata.labels.my-label", StringValue("==a"))
+	expression, err := FormatExpression(d)
+	require.NoError(t, err)
+	assert.Equal(t, `metadata.labels["my-label"] == "a"`, expression)
+	parsed, err := ParseExpression(expression)
+	require.NoError(t, err)
+	assert.Equal(t, Field(`metadata.labels["my-label"]`, StringValue("==a")), parsed)
+
+	factory := NewPredicateFactory(v1.Pod{})
+	original, err := factory.Build(d)
+	require.NoError(t, err)
+	reparsed, err := factory.Build(parsed)
+	require.NoError(t, err)
+	for _, labels := range []map[string]string{nil, {"my-label": "a"}, {"my-label": "b"}} {
+		pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Labels: labels}}
+		assert.Equal(t, original(pod) == nil, reparsed(pod) == nil)
+	}
+}
+
+// The policies shipped with the package are formatted and read back unchanged.
+func TestFormatExpressionRoundTrip(t *testing.T) {
+	policies := PodSecurityRestrictedPolicies
+	require.NotEmpty(t, policies)
+	for _, policy := range policies {
+		expression, err := FormatExpression(policy.Descriptor)
+		if !assert.NoError(t, err, policy.Name) {
+			continue
+		}
+		parsed, err := ParseExpression(expression)
+		if assert.NoError(t, err, expression) {
+			assert.Equal(t, policy.Descriptor, parsed, expression)
+		}
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	for expression, expected := range map[string]string{
+		``:                                               `line 1, column 1: expected a field path, found end of expression`,
+		`spec.hostname`:                                  `line 1, column 14: expected an operator, "{", exists, missing, zero, is or satisfies after spec.hostname, found end of expression`,
+		`spec.hostname == "a" and`:                       `line 1, column 25: expected a field path, found end of expression`,
+		`spec.hostname == "a")`:                          `line 1, column 21: unexpected ")" after expression`,
+		`(spec.hostname == "a"`:                          `line 1, column 22: expected ")", found end of expression`,
+		`spec.hostname # "a"`:                            `line 1, column 15: unexpected character '#'`,
+		`spec.hostname =! "a"`:                           `line 1, column 15: unknown operator "="`,
+		`spec.hostname == "a`:                            `line 1, column 18: unterminated string`,
+		`spec.hostname == and`:                           `line 1, column 18: expected a value, found "and"`,
+		`spec. == "a"`:                                   `line 1, column 7: expected a field name, found "=="`,
+		`spec["a] == "a"`:                                `line 1, column 15: unterminated string`,
+		`spec[a] == "a"`:                                 `line 1, column 6: expected a quoted key, found "a"`,
+		`spec["a" == "a"`:                                `line 1, column 10: expected "]", found "=="`,
+		`@ { @ exists }`:                                 `line 1, column 1: expected a field path before "{"`,
+		`spec.priority is integer`:                       `line 1, column 18: expected a type name, found "integer"`,
+		`spec.priority == number(x)`:                     `line 1, column 25: expected a string, number or reference, found "x"`,
+		`spec.priority == integer("5")`:                  `line 1, column 18: expected a type name, found "integer"`,
+		`spec.priority >> 5`:                             `line 1, column 16: expected a value, found ">"`,
+		`spec.priority == ref(@)`:                        `line 1, column 22: expected a field path to refer to`,
+		`spec.priority =~ ref(spec.x)`:                   `line 1, column 15: invalid number comparison: incorrectly formatted comparison: =~`,
+		`metadata.creationTimestamp olderThan 30`:        `line 1, column 38: expected an age such as "30d", found "30"`,
+		`metadata.creationTimestamp olderThan "a month"`: `line 1, column 38: invalid age: time: invalid duration "a month"`,
+		`@ satisfies self`:                               `line 1, column 13: expected a CEL rule, found "self"`,
+		`@ satisfies "self" message m`:                   `line 1, column 28: expected a message, found "m"`,
+		`image is image(latest)`:                         `line 1, column 16: unknown image constraint "latest", expected registry, repository, forbidTag, tagPattern, semver or digest`,
+		`image is image(registry gcr.io)`:                `line 1, column 25: expected a string after registry, found "gcr"`,
+		`image is image(tagPattern "(")`:                 "line 1, column 15: invalid image predicate: error parsing regexp: missing closing ): `(`",
+		`image is image(semver digest)`:                  `line 1, column 23: expected ")", found "digest"`,
+		`ref()`:                                          `line 1, column 5: expected the name of a registered descriptor, found ")"`,
+		`ref("")`:                                        `line 1, column 5: expected the name of a registered descriptor, found "\"\""`,
+		`all(spec.containers name exists)`:               `line 1, column 21: expected ",", found "name"`,
+		`all(keys(metadata.labels, @ exists)`:            `line 1, column 25: expected ")", found ","`,
+		`atLeast(x, spec.containers, name exists)`:       `line 1, column 9: expected a count, found "x"`,
+		`atMost(-1, spec.containers, name exists)`:       `line 1, column 8: expected a count, found "-1"`,
+		// Positions count lines and columns across the whole expression.
+		"spec.hostname == \"a\" and\n  spec.subdomain":            `line 2, column 17: expected an operator, "{", exists, missing, zero, is or satisfies after spec.subdomain, found end of expression`,
+		"spec.hostname == \"a\"\n  or (spec.subdomain ==\n  5 5)": `line 3, column 5: expected ")", found "5"`,
+	} {
+		_, err := ParseExpression(expression)
+		if assert.IsType(t, &DescriptorError{}, err, expression) {
+			assert.EqualError(t, err, expected, expression)
+		}
+	}
+}
@@ -0,0 +1,387 @@
+package predicates
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fieldVisitor receives each value found by an extractor, along with where it was found.
+type fieldVisitor func(value reflect.Value, at location)
+
+// extractor finds the values at a resolved field path. Values that are missing because a pointer or map entry along the
+// path is nil are visited as an invalid reflect.Value. The zero extractor finds its input unchanged.
+type extractor struct {
+	steps []fieldStep
+	// fanOut is set if the path crosses a list, and so may find any number of values.
+	fanOut bool
+}
+
+type stepKind int
+
+const (
+	// structStep selects a struct field by its index chain, which is longer than one for inlined structs.
+	structStep stepKind = iota
+	// mapStep selects the entry of a map with a given key.
+	mapStep
+	// elementsStep fans out over the elements of a list.
+	elementsStep
+)
+
+// fieldStep is one resolved step of a json path.
+type fieldStep struct {
+	kind      stepKind
+	name      string
+	index     []int
+	key       reflect.Value
+	omitEmpty bool
+}
+
+// identityExtractor finds its input unchanged.
+var identityExtractor = extractor{}
+
+func newExtractor(steps []fieldStep) extractor {
+	e := extractor{steps: steps}
+	for _, step := range steps {
+		if step.kind == elementsStep {
+			e.fanOut = true
+		}
+	}
+	return e
+}
+
+// each visits every value found at the path.
+func (e extractor) each(input reflect.Value, at location, visit fieldVisitor) {
+	walkSteps(input, at, e.steps, visit)
+}
+
+// single returns the one value found at a path that does not fan out, without the cost of a visitor.
+func (e extractor) single(input reflect.Value, at location) (reflect.Value, location) {
+	value := input
+	for i, step := range e.steps {
+		value = indirect(value)
+		if !value.IsValid() {
+			return reflect.Value{}, missingLocation(at, e.steps[i:])
+		}
+		if step.kind == structStep {
+			value = fieldByIndex(value, step.index)
+			at = at.field(step.name)
+		} else {
+			value = value.MapIndex(step.key)
+			at = at.key(step.name)
+		}
+	}
+	return value, at
+}
+
+// check applies a predicate to every value found at the path, and collects the violations.
+func (e extractor) check(input reflect.Value, at location, pred internalPredicate) []*Violation {
+	if !e.fanOut {
+		return pred(e.single(input, at))
+	}
+	var violations []*Violation
+	e.each(input, at, func(value reflect.Value, valueAt location) {
+		violations = append(violations, pred(value, valueAt)...)
+	})
+	return violations
+}
+
+func walkSteps(value reflect.Value, at location, steps []fieldStep, visit fieldVisitor) {
+	for i, step := range steps {
+		value = indirect(value)
+		if !value.IsValid() {
+			visit(reflect.Value{}, missingLocation(at, steps[i:]))
+			return
+		}
+		switch step.kind {
+		case structStep:
+			value = fieldByIndex(value, step.index)
+			at = at.field(step.name)
+		case mapStep:
+			value = value.MapIndex(step.key)
+			at = at.key(step.name)
+		case elementsStep:
+			for elem := 0; elem < value.Len(); elem++ {
+				walkSteps(value.Index(elem), at.index(elem), steps[i+1:], visit)
+			}
+			return
+		}
+	}
+	visit(value, at)
+}
+
+// fieldByIndex is reflect.Value.FieldByIndex, except that nil embedded pointers produce an invalid value.
+func fieldByIndex(value reflect.Value, index []int) reflect.Value {
+	if len(index) == 1 {
+		return value.Field(index[0])
+	}
+	for i, fieldIndex := range index {
+		if i > 0 {
+			if value = indirect(value); !value.IsValid() {
+				return value
+			}
+		}
+		value = value.Field(fieldIndex)
+	}
+	return value
+}
+
+// missingLocation extends a location with the names of steps that could not be taken.
+func missingLocation(at location, steps []fieldStep) location {
+	for _, step := range steps {
+		switch step.kind {
+		case structStep:
+			at = at.field(step.name)
+		case mapStep:
+			at = at.key(step.name)
+		}
+	}
+	return at
+}
+
+// pathSegment is one step of a json path as written: a name after a dot, or a quoted map key in brackets.
+type pathSegment struct {
+	name    string
+	bracket bool
+}
+
+// splitJSONPath splits a json path such as metadata.labels["app.kubernetes.io/name"] into its steps. Bracketed keys
+// are double-quoted Go strings, and may contain dots.
+func splitJSONPath(jsonPath string) ([]pathSegment, error) {
+	var segments []pathSegment
+	for i := 0; i < len(jsonPath); {
+		if jsonPath[i] == '[' {
+			end := i + 1
+			if end >= len(jsonPath) || jsonPath[end] != '"' {
+				return nil, fmt.Errorf("expected a quoted key after \"[\" at offset %d in json path %q", i, jsonPath)
+			}
+			for end++; end < len(jsonPath) && jsonPath[end] != '"'; end++ {
+				if jsonPath[end] == '\\' {
+					end++
+				}
+			}
+			if end+1 >= len(jsonPath) || jsonPath[end+1] != ']' {
+				return nil, fmt.Errorf("unterminated key at offset %d in json path %q", i, jsonPath)
+			}
+			key, err := strconv.Unquote(jsonPath[i+1 : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid key %s in json path %q", jsonPath[i+1:end+1], jsonPath)
+			}
+			segments = append(segments, pathSegment{name: key, bracket: true})
+			i = end + 2
+		} else {
+			if len(segments) != 0 {
+				if jsonPath[i] != '.' {
+					return nil, fmt.Errorf("expected \".\" or \"[\" at offset %d in json path %q", i, jsonPath)
+				}
+				i++
+			}
+			end := i
+			for end < len(jsonPath) && jsonPath[end] != '.' && jsonPath[end] != '[' {
+				end++
+			}
+			if end == i {
+				return nil, fmt.Errorf("empty step in json path %q", jsonPath)
+			}
+			segments = append(segments, pathSegment{name: jsonPath[i:end]})
+			i = end
+		}
+	}
+	return segments, nil
+}
+
+// plainKeyRegexp matches the map keys that can be written after a dot in a json path.
+var plainKeyRegexp = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// formatKey renders a map key as a json path step: `.key` where possible, and `["key"]` otherwise.
+func formatKey(path, key string) string {
+	if plainKeyRegexp.MatchString(key) {
+		return joinPath(path, key)
+	}
+	return fmt.Sprintf("%s[%s]", path, strconv.Quote(key))
+}
+
+// resolveStep finds the json field name in the given struct or map type.
+func resolveStep(currentPath string, currentType reflect.Type, name string) (fieldStep, reflect.Type, error) {
+	switch currentType.Kind() {
+	case reflect.Struct:
+		fields := jsonFields(currentType)
+		if field, ok := fields[name]; ok {
+			step := fieldStep{kind: structStep, name: name, index: field.Index, omitEmpty: hasOption(jsonOptions(field), "omitempty")}
+			return step, field.Type, nil
+		}
+		names := make([]string, 0, len(fields))
+		for fieldName := range fields {
+			names = append(names, fieldName)
+		}
+		if suggestions := suggest(name, names); len(suggestions) != 0 {
+			return fieldStep{}, nil, fmt.Errorf("no field %q in %s at path %s, did you mean %s?",
+				name, typeName(currentType), displayPath(currentPath), strings.Join(suggestions, " or "))
+		}
+		return fieldStep{}, nil, fmt.Errorf("no field %q in %s at path %s", name, typeName(currentType), displayPath(currentPath))
+	case reflect.Map:
+		if currentType.Key().Kind() != reflect.String {
+			return fieldStep{}, nil, fmt.Errorf("cannot select key %q of %s at path %s: keys are not strings",
+				name, typeName(currentType), displayPath(currentPath))
+		}
+		key := reflect.ValueOf(name).Convert(currentType.Key())
+		return fieldStep{kind: mapStep, name: name, key: key}, currentType.Elem(), nil
+	default:
+		return fieldStep{}, nil, fmt.Errorf("cannot select field %q of %s at path %s", name, typeName(currentType), displayPath(currentPath))
+	}
+}
+
+// jsonFields lists the fields of a struct type by the name they are serialized under, following the rules of
+// encoding/json: untagged embedded structs and `inline` fields are flattened into their parent, and `-` is skipped.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, options := tag, ""
+		if comma := strings.Index(tag, ","); comma >= 0 {
+			name, options = tag[:comma], tag[comma+1:]
+		}
+		if name == "" && (field.Anonymous || hasOption(options, "inline")) {
+			if embedded := derefType(field.Type); embedded.Kind() == reflect.Struct {
+				for embeddedName, embeddedField := range jsonFields(embedded) {
+					if _, shadowed := fields[embeddedName]; shadowed {
+						continue
+					}
+					embeddedField.Index = append([]int{i}, embeddedField.Index...)
+					fields[embeddedName] = embeddedField
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			// Unexported.
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field
+	}
+	return fields
+}
+
+func jsonOptions(field reflect.StructField) string {
+	tag := field.Tag.Get("json")
+	if comma := strings.Index(tag, ","); comma >= 0 {
+		return tag[comma+1:]
+	}
+	return ""
+}
+
+func hasOption(options, option string) bool {
+	for _, o := range strings.Split(options, ",") {
+		if o == option {
+			return true
+		}
+	}
+	return false
+}
+
+// typeName names a type in error messages. Struct types built from a schema have no name, and are shown as objects.
+func typeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + typeName(t.Elem())
+	case reflect.Slice:
+		return "[]" + typeName(t.Elem())
+	case reflect.Map:
+		return fmt.Sprintf("map[%s]%s", typeName(t.Key()), typeName(t.Elem()))
+	case reflect.Struct:
+		if t.Name() == "" {
+			return "object"
+		}
+	}
+	return t.String()
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+func joinPath(path, step string) string {
+	if path == "" {
+		return step
+	}
+	return fmt.Sprintf("%s.%s", path, step)
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "<root>"
+	}
+	return path
+}
+
+// suggest returns the names closest to the one requested, for use in error messages.
+func suggest(name string, names []string) []string {
+	const maxSuggestions = 3
+	maxDistance := len(name)/3 + 1
+	type candidate struct {
+		name     string
+		distance int
+	}
+	var candidates []candidate
+	for _, n := range names {
+		distance := editDistance(strings.ToLower(name), strings.ToLower(n))
+		if distance <= maxDistance {
+			candidates = append(candidates, candidate{name: n, distance: distance})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].name < candidates[j].name
+	})
+	var suggestions []string
+	for i := 0; i < len(candidates) && i < maxSuggestions; i++ {
+		suggestions = append(suggestions, fmt.Sprintf("%q", candidates[i].name))
+	}
+	return suggestions
+}
+
+// editDistance is the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min3(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,127 @@
+package predicates
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitJSONPath(t *testing.T) {
+	for path, expected := range map[string][]pathSegment{
+		"spec.containers": {{name: "spec"}, {name: "containers"}},
+		`metadata.labels["app.kubernetes.io/name"]`: {{name: "metadata"}, {name: "labels"}, {name: "app.kubernetes.io/name", bracket: true}},
+		`data["a\"b"]["c"].d`:                       {{name: "data"}, {name: `a"b`, bracket: true}, {name: "c", bracket: true}, {name: "d"}},
+	} {
+		segments, err := splitJSONPath(path)
+		if assert.NoError(t, err, path) {
+			assert.Equal(t, expected, segments, path)
+		}
+	}
+	for _, path := range []string{"a..b", "a.", `a[`, `a["b"`, `a[b]`, `a["b"]c`} {
+		_, err := splitJSONPath(path)
+		assert.Error(t, err, path)
+	}
+}
+
+func TestFormatKey(t *testing.T) {
+	assert.Equal(t, "metadata.labels.team", formatKey("metadata.labels", "team"))
+	assert.Equal(t, `metadata.labels["app.kubernetes.io/name"]`, formatKey("metadata.labels", "app.kubernetes.io/name"))
+	assert.Equal(t, `["cost-center"]`, formatKey("", "cost-center"))
+}
+
+type FieldPathEmbedded struct {
+	Region string `json:"region"`
+}
+
+type fieldPathElement struct {
+	Port int `json:"port"`
+}
+
+type fieldPathExample struct {
+	Name     string `json:"name"`
+	Renamed  string `json:"displayName,omitempty"`
+	Skipped  string `json:"-"`
+	Untagged string
+	FieldPathEmbedded
+	Inline fieldPathElement   `json:",inline"`
+	Ptr    *fieldPathElement  `json:"ptr,omitempty"`
+	Items  []fieldPathElement `json:"items"`
+	Labels map[string]string  `json:"labels"`
+	hidden string
+}
+
+// visits lists the paths and values an extractor finds.
+func visits(e extractor, input interface{}) []string {
+	var found []string
+	e.each(reflect.ValueOf(input), location{}, func(value reflect.Value, at location) {
+		found = append(found, fmt.Sprintf("%s=%s", at.path, formatValue(value)))
+	})
+	return found
+}
+
+func TestFieldExtractor(t *testing.T) {
+	example := fieldPathExample{
+		Name:              "web",
+		Renamed:           "Web",
+		Untagged:          "u",
+		FieldPathEmbedded: FieldPathEmbedded{Region: "eu"},
+		Inline:            fieldPathElement{Port: 80},
+		Items:             []fieldPathElement{{Port: 8080}, {Port: 8443}},
+		Labels:            map[string]string{"team": "a", "app.kubernetes.io/name": "web"},
+		hidden:            "h",
+	}
+	for _, c := range []struct {
+		jsonPath string
+		path     string
+		typ      reflect.Type
+		found    []string
+	}{
+		{"name", "name", reflect.TypeOf(""), []string{`name="web"`}},
+		{"displayName", "displayName", reflect.TypeOf(""), []string{`displayName="Web"`}},
+		{"Untagged", "Untagged", reflect.TypeOf(""), []string{`Untagged="u"`}},
+		// Embedded and inline structs are flattened into their parent, as encoding/json does.
+		{"region", "region", reflect.TypeOf(""), []string{`region="eu"`}},
+		{"port", "port", reflect.TypeOf(0), []string{`port=80`}},
+		// Nil pointers on the way are visited as a missing value at the full path.
+		{"ptr.port", "ptr.port", reflect.TypeOf(0), []string{`ptr.port=<unset>`}},
+		{"items.port", "items.port", reflect.TypeOf(0), []string{`items[0].port=8080`, `items[1].port=8443`}},
+		{"labels.team", "labels.team", reflect.TypeOf(""), []string{`labels.team="a"`}},
+		{`labels["app.kubernetes.io/name"]`, `labels["app.kubernetes.io/name"]`, reflect.TypeOf(""),
+			[]string{`labels["app.kubernetes.io/name"]="web"`}},
+		{"labels.missing", "labels.missing", reflect.TypeOf(""), []string{`labels.missing=<unset>`}},
+	} {
+		path, typ, e, err := fieldExtractor("", reflect.TypeOf(example), c.jsonPath)
+		if !assert.NoError(t, err, c.jsonPath) {
+			continue
+		}
+		assert.Equal(t, c.path, path, c.jsonPath)
+		assert.Equal(t, c.typ, typ, c.jsonPath)
+		assert.Equal(t, c.found, visits(e, &example), c.jsonPath)
+	}
+
+	// An empty list is crossed without visiting anything.
+	_, _, e, err := fieldExtractor("", reflect.TypeOf(example), "items.port")
+	require.NoError(t, err)
+	assert.Empty(t, visits(e, fieldPathExample{}))
+}
+
+func TestFieldExtractorErrors(t *testing.T) {
+	for jsonPath, expected := range map[string]string{
+		"nmae":       `no field "nmae" in predicates.fieldPathExample at path <root>, did you mean "name"?`,
+		"item.port":  `no field "item" in predicates.fieldPathExample at path <root>, did you mean "items"?`,
+		"items.prot": `no field "prot" in predicates.fieldPathElement at path items, did you mean "port"?`,
+		// Fields are selected by their json names only.
+		"Renamed":   `no field "Renamed" in predicates.fieldPathExample at path <root>, did you mean "name"?`,
+		"Skipped":   `no field "Skipped" in predicates.fieldPathExample at path <root>`,
+		"hidden":    `no field "hidden" in predicates.fieldPathExample at path <root>`,
+		"name.x":    `cannot select field "x" of string at path name`,
+		`name["x"]`: `cannot select key "x" of string at path name: not a map`,
+		"":          `empty json path for field after: `,
+	} {
+		_, _, _, err := fieldExtractor("", reflect.TypeOf(fieldPathExample{}), jsonPath)
+		assert.EqualError(t, err, expected, jsonPath)
+	}
+}
@@ -7,36 +7,80 @@ var PortValidator = Conjunction(
 	NumberValue(`<=9999 `),
 )
 
-// HasLivenessProbe is a predicate that determines if a pod has a liveness probe configured correctly.
-var HasLivenessProbe = func() Predicate {
-	pred, err := NewPredicateFactory(v1.Pod{}).Build(
-		Field("spec.containers.livenessprobe",
-			Conjunction(
-				Disjunction(
-					Field("exec",
-						Conjunction(
-							Field("command", StringValue(`\w`)),
-						),
-					),
-					Field("httpGet",
-						Conjunction(
-							Field("port", PortValidator),
-						),
-					),
-					Field("tcpSocket",
-						Conjunction(
-							Field("port", PortValidator),
-						),
-					),
+// PortRangeTemplate is PortValidator with a configurable range of ports.
+var PortRangeTemplate = &Template{
+	Parameters: []*TemplateParameter{
+		{Name: "minPort", Type: NUMERICAL_FIELD, Default: 0},
+		{Name: "maxPort", Type: NUMERICAL_FIELD, Default: 9999},
+	},
+	Descriptor: Conjunction(
+		NumberValue(`>=${minPort}`),
+		NumberValue(`<=${maxPort}`),
+	),
+}
+
+// LivenessProbeDescriptor requires every container of a pod to have a liveness probe configured correctly.
+var LivenessProbeDescriptor = All("spec.containers", Field("livenessProbe",
+	Conjunction(
+		Disjunction(
+			Field("exec",
+				Conjunction(
+					Field("command", StringValue(`\w`)),
+				),
+			),
+			Field("httpGet",
+				Conjunction(
+					Field("port", PortValidator),
+				),
+			),
+			Field("tcpSocket",
+				Conjunction(
+					Field("port", PortValidator),
 				),
-				Field("initialDelaySeconds", NumberValue("")),
-				Field("periodSeconds", NumberValue("")),
 			),
 		),
-	)
+		Field("initialDelaySeconds", NumberValue("")),
+		Field("periodSeconds", NumberValue("")),
+	),
+))
+
+// LivenessProbePolicy explains LivenessProbeDescriptor, so that the pods violating it can be triaged.
+var LivenessProbePolicy = &Policy{
+	PolicyMetadata: PolicyMetadata{
+		ID:          policyID("liveness-probe"),
+		Name:        "liveness-probe",
+		Severity:    WARNING_SEVERITY,
+		Category:    "reliability",
+		Description: "Containers need a liveness probe, so that the kubelet restarts them when they stop responding.",
+		Remediation: "Add a livenessProbe with an exec command, or an httpGet or tcpSocket check of a port below 10000, " +
+			"and set its initialDelaySeconds and periodSeconds.",
+		DocURL: "https://kubernetes.io/docs/tasks/configure-pod-container/configure-liveness-readiness-startup-probes/",
+	},
+	Descriptor: LivenessProbeDescriptor,
+	Fix: &RemediationTemplate{
+		Type:    JSON_PATCH,
+		ForEach: "spec.containers",
+		// The probe checks the first port PortValidator accepts. Containers with a probe that is misconfigured, or
+		// without such a port, are left for a person to fix.
+		Patch: `{{ $port := 0.0 }}{{ range .Item.ports }}
+{{ if and (eq $port 0.0) (le .containerPort 9999.0) }}{{ $port = .containerPort }}{{ end }}
+{{ end }}
+{{ if and (not .Item.livenessProbe) (ne $port 0.0) }}
+- op: add
+  path: /spec/containers/{{ $.Index }}/livenessProbe
+  value:
+    tcpSocket: {port: {{ $port }}}
+    initialDelaySeconds: 10
+    periodSeconds: 10
+{{ end }}`,
+	},
+}
+
+// HasLivenessProbe is a predicate that determines if a pod has a liveness probe configured correctly.
+var HasLivenessProbe = func() Predicate {
+	pred, err := BuildPolicy(NewPredicateFactory(v1.Pod{}), LivenessProbePolicy)
 	if err != nil {
 		panic(err)
 	}
 	return pred
 }()
-
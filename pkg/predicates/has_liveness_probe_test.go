@@ -0,0 +1,103 @@
+package predicates
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// syntheticPods builds n pods with a mix of probe configurations. Roughly one pod in eight fails HasLivenessProbe.
+func syntheticPods(n int) []*v1.Pod {
+	pods := make([]*v1.Pod, 0, n)
+	for i := 0; i < n; i++ {
+		var containers []v1.Container
+		for c := 0; c < 1+i%3; c++ {
+			probe := &v1.Probe{InitialDelaySeconds: 5, PeriodSeconds: 10}
+			switch (i + c) % 3 {
+			case 0:
+				probe.Handler.HTTPGet = &v1.HTTPGetAction{Path: "/healthz", Port: intstr.FromInt(8080)}
+			case 1:
+				probe.Handler.TCPSocket = &v1.TCPSocketAction{Port: intstr.FromInt(5432)}
+			case 2:
+				probe.Handler.Exec = &v1.ExecAction{Command: []string{"cat", "/tmp/healthy"}}
+			}
+			if i%8 == 7 && c == 0 {
+				probe = nil
+			}
+			containers = append(containers, v1.Container{
+				Name:          fmt.Sprintf("container-%d", c),
+				Image:         "nginx:1.17",
+				LivenessProbe: probe,
+			})
+		}
+		pods = append(pods, &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: fmt.Sprintf("pod-%d", i), Namespace: "default"},
+			Spec:       v1.PodSpec{Containers: containers},
+		})
+	}
+	return pods
+}
+
+func TestHasLivenessProbe(t *testing.T) {
+	failures := 0
+	for _, pod := range syntheticPods(800) {
+		if err := HasLivenessProbe(pod); err != nil {
+			failures++
+		}
+	}
+	if failures != 100 {
+		t.Errorf("expected 100 of 800 pods to fail, got %d", failures)
+	}
+}
+
+// BenchmarkHasLivenessProbe measures the compiled predicate, which decides each pod without building paths, and only
+// builds a report for the pods that fail.
+func BenchmarkHasLivenessProbe(b *testing.B) {
+	pods := syntheticPods(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, pod := range pods {
+			_ = HasLivenessProbe(pod)
+		}
+	}
+}
+
+// BenchmarkHasLivenessProbeByValue measures the compiled predicate on pods passed by value, as scanners do, which are
+// copied once per evaluation so that their ports and quantities can be read in place.
+func BenchmarkHasLivenessProbeByValue(b *testing.B) {
+	var pods []v1.Pod
+	for _, pod := range syntheticPods(10000) {
+		pods = append(pods, *pod)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, pod := range pods {
+			_ = HasLivenessProbe(pod)
+		}
+	}
+}
+
+// BenchmarkHasLivenessProbeReporting measures the same predicate when every evaluation builds paths and violations, as
+// all evaluations did before predicates were compiled.
+func BenchmarkHasLivenessProbeReporting(b *testing.B) {
+	pf := &predicateFactoryImpl{clock: time.Now}
+	internal, err := pf.parsePredicate("", reflect.TypeOf(v1.Pod{}), LivenessProbeDescriptor)
+	if err != nil {
+		b.Fatal(err)
+	}
+	pods := syntheticPods(10000)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, pod := range pods {
+			_ = internal(reflect.ValueOf(pod), location{})
+		}
+	}
+}
@@ -0,0 +1,213 @@
+package predicates
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// ImagePredicateDescriptor constrains the parts of a container image reference, such as
+// `gcr.io/team/app:1.2.3@sha256:...`, separately. Constraints left empty are not checked.
+type ImagePredicateDescriptor struct {
+	// Registries lists the registry hosts images may be pulled from. Images without a host come from docker.io.
+	Registries []string `json:"registries,omitempty" yaml:"registries,omitempty"`
+	// Repository is a glob the repository path must match. `*` matches within one path segment, and `**` matches
+	// across segments. Official images on docker.io live under `library/`.
+	Repository string `json:"repository,omitempty" yaml:"repository,omitempty"`
+	// ForbiddenTags lists tags that may not be used. Images without a tag or digest use the `latest` tag.
+	ForbiddenTags []string `json:"forbiddenTags,omitempty" yaml:"forbiddenTags,omitempty"`
+	// TagPattern is a regular expression the tag must match.
+	TagPattern string `json:"tagPattern,omitempty" yaml:"tagPattern,omitempty"`
+	// RequireSemver requires the tag to be a semantic version, e.g. `1.2.3` or `v1.2.3-rc.1`.
+	RequireSemver bool `json:"requireSemver,omitempty" yaml:"requireSemver,omitempty"`
+	// RequireDigest requires the image to be pinned with an `@sha256:` digest.
+	RequireDigest bool `json:"requireDigest,omitempty" yaml:"requireDigest,omitempty"`
+}
+
+const (
+	defaultRegistry = "docker.io"
+	defaultTag      = "latest"
+)
+
+var (
+	repositoryComponentRegexp = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*$`)
+	tagRegexp                 = regexp.MustCompile(`^[\w][\w.-]{0,127}$`)
+	digestRegexp              = regexp.MustCompile(`^sha256:[a-f0-9]{64}$`)
+	semverRegexp              = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-[0-9A-Za-z.-]+)?(?:\+[0-9A-Za-z.-]+)?$`)
+)
+
+// imageReference is a parsed Docker or OCI image reference.
+type imageReference struct {
+	registry   string
+	repository string
+	tag        string
+	digest     string
+}
+
+// parseImageReference splits an image reference into its parts, filling in the defaults the container runtime uses.
+func parseImageReference(image string) (imageReference, error) {
+	ref := imageReference{}
+	rest := image
+	if at := strings.Index(rest, "@"); at >= 0 {
+		rest, ref.digest = rest[:at], rest[at+1:]
+		if !digestRegexp.MatchString(ref.digest) {
+			return ref, fmt.Errorf("invalid digest %q in image %q", ref.digest, image)
+		}
+	}
+	if colon := strings.LastIndex(rest, ":"); colon > strings.LastIndex(rest, "/") {
+		rest, ref.tag = rest[:colon], rest[colon+1:]
+		if !tagRegexp.MatchString(ref.tag) {
+			return ref, fmt.Errorf("invalid tag %q in image %q", ref.tag, image)
+		}
+	}
+	ref.registry, ref.repository = defaultRegistry, rest
+	if slash := strings.Index(rest, "/"); slash >= 0 {
+		host := rest[:slash]
+		if strings.ContainsAny(host, ".:") || host == "localhost" {
+			ref.registry, ref.repository = host, rest[slash+1:]
+		}
+	}
+	if ref.registry == "index.docker.io" {
+		ref.registry = defaultRegistry
+	}
+	if ref.registry == defaultRegistry && !strings.Contains(ref.repository, "/") {
+		ref.repository = "library/" + ref.repository
+	}
+	for _, component := range strings.Split(ref.repository, "/") {
+		if !repositoryComponentRegexp.MatchString(component) {
+			return ref, fmt.Errorf("invalid repository %q in image %q", ref.repository, image)
+		}
+	}
+	if ref.tag == "" && ref.digest == "" {
+		ref.tag = defaultTag
+	}
+	return ref, nil
+}
+
+// imageCheck is one compiled constraint of an image descriptor.
+type imageCheck struct {
+	expected string
+	holds    func(ref imageReference) bool
+}
+
+func compileImageChecks(d *ImagePredicateDescriptor) ([]imageCheck, error) {
+	var checks []imageCheck
+	if len(d.Registries) != 0 {
+		allowed := map[string]bool{}
+		for _, registry := range d.Registries {
+			if registry == "index.docker.io" {
+				registry = defaultRegistry
+			}
+			allowed[registry] = true
+		}
+		checks = append(checks, imageCheck{
+			expected: fmt.Sprintf("image from registry %s", strings.Join(d.Registries, " or ")),
+			holds:    func(ref imageReference) bool { return allowed[ref.registry] },
+		})
+	}
+	if d.Repository != "" {
+		glob, err := compileGlob(d.Repository)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, imageCheck{
+			expected: fmt.Sprintf("image repository matching `%s`", d.Repository),
+			holds:    func(ref imageReference) bool { return glob.MatchString(ref.repository) },
+		})
+	}
+	if len(d.ForbiddenTags) != 0 {
+		forbidden := map[string]bool{}
+		for _, tag := range d.ForbiddenTags {
+			forbidden[tag] = true
+		}
+		checks = append(checks, imageCheck{
+			expected: fmt.Sprintf("image tag other than %s", strings.Join(d.ForbiddenTags, " or ")),
+			holds:    func(ref imageReference) bool { return !forbidden[ref.tag] },
+		})
+	}
+	if d.TagPattern != "" {
+		re, err := regexp.Compile(d.TagPattern)
+		if err != nil {
+			return nil, err
+		}
+		checks = append(checks, imageCheck{
+			expected: fmt.Sprintf("image tag matching `%s`", d.TagPattern),
+			holds:    func(ref imageReference) bool { return re.MatchString(ref.tag) },
+		})
+	}
+	if d.RequireSemver {
+		checks = append(checks, imageCheck{
+			expected: "image tag that is a semantic version",
+			holds:    func(ref imageReference) bool { return semverRegexp.MatchString(ref.tag) },
+		})
+	}
+	if d.RequireDigest {
+		checks = append(checks, imageCheck{
+			expected: "image pinned by digest",
+			holds:    func(ref imageReference) bool { return ref.digest != "" },
+		})
+	}
+	return checks, nil
+}
+
+// compileGlob translates a repository glob into a regular expression.
+func compileGlob(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch {
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			b.WriteString("[^/]*")
+		case glob[i] == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+func (pf *predicateFactoryImpl) parseImagePredicate(currentPath string, currentType reflect.Type, d *ImagePredicateDescriptor) (internalPredicate, error) {
+	checks, err := compileImageChecks(d)
+	if err != nil {
+		return nil, fmt.Errorf("invalid image predicate at path %s: %v", currentPath, err)
+	}
+	var check internalPredicate
+	check = func(input reflect.Value, at location) []*Violation {
+		value := indirect(input)
+		if value.IsValid() && isCollection(value) {
+			if value.Len() == 0 {
+				return []*Violation{at.violation("an image reference", input)}
+			}
+			var violations []*Violation
+			for i := 0; i < value.Len(); i++ {
+				violations = append(violations, check(value.Index(i), at.index(i))...)
+			}
+			return violations
+		}
+		image, ok := "", false
+		if value.IsValid() {
+			image, ok = stringOf(value)
+		}
+		if !ok {
+			return []*Violation{at.violation("an image reference", input)}
+		}
+		ref, err := parseImageReference(image)
+		if err != nil {
+			return []*Violation{at.violation(fmt.Sprintf("a valid image reference (%v)", err), input)}
+		}
+		var violations []*Violation
+		for _, c := range checks {
+			if !c.holds(ref) {
+				violations = append(violations, at.violation(c.expected, input))
+			}
+		}
+		return violations
+	}
+	return check, nil
+}
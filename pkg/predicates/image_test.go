@@ -0,0 +1,65 @@
+package predicates
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseImageReference(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("ab", 32)
+	for image, expected := range map[string]imageReference{
+		"nginx":                            {registry: "docker.io", repository: "library/nginx", tag: "latest"},
+		"nginx:1.17":                       {registry: "docker.io", repository: "library/nginx", tag: "1.17"},
+		"bitnami/redis":                    {registry: "docker.io", repository: "bitnami/redis", tag: "latest"},
+		"index.docker.io/library/busybox":  {registry: "docker.io", repository: "library/busybox", tag: "latest"},
+		"localhost:5000/team/app:dev":      {registry: "localhost:5000", repository: "team/app", tag: "dev"},
+		"gcr.io/team/app@" + digest:        {registry: "gcr.io", repository: "team/app", digest: digest},
+		"gcr.io/team/app:v1.2.3@" + digest: {registry: "gcr.io", repository: "team/app", tag: "v1.2.3", digest: digest},
+	} {
+		ref, err := parseImageReference(image)
+		if assert.NoError(t, err, image) {
+			assert.Equal(t, expected, ref, image)
+		}
+	}
+	for _, image := range []string{"", "Nginx", "nginx:", "nginx@sha256:abc", "gcr.io/team//app"} {
+		_, err := parseImageReference(image)
+		assert.Error(t, err, image)
+	}
+}
+
+func TestImageValue(t *testing.T) {
+	digest := "sha256:" + strings.Repeat("ab", 32)
+	for _, c := range []struct {
+		image    ImagePredicateDescriptor
+		input    string
+		failures int
+	}{
+		{ImagePredicateDescriptor{}, "nginx", 0},
+		{ImagePredicateDescriptor{Registries: []string{"gcr.io", "quay.io"}}, "quay.io/team/app", 0},
+		{ImagePredicateDescriptor{Registries: []string{"gcr.io"}}, "nginx", 1},
+		{ImagePredicateDescriptor{Registries: []string{"docker.io"}}, "nginx", 0},
+		{ImagePredicateDescriptor{Repository: "team/*"}, "gcr.io/team/app", 0},
+		{ImagePredicateDescriptor{Repository: "team/*"}, "gcr.io/team/app/worker", 1},
+		{ImagePredicateDescriptor{Repository: "team/**"}, "gcr.io/team/app/worker", 0},
+		{ImagePredicateDescriptor{ForbiddenTags: []string{"latest"}}, "nginx", 1},
+		{ImagePredicateDescriptor{ForbiddenTags: []string{"latest"}}, "nginx:latest", 1},
+		{ImagePredicateDescriptor{ForbiddenTags: []string{"latest"}}, "nginx@" + digest, 0},
+		{ImagePredicateDescriptor{TagPattern: `^1\.`}, "nginx:1.17", 0},
+		{ImagePredicateDescriptor{RequireSemver: true}, "nginx:1.17", 1},
+		{ImagePredicateDescriptor{RequireSemver: true}, "nginx:v1.17.3-alpine", 0},
+		{ImagePredicateDescriptor{RequireDigest: true}, "nginx:1.17", 1},
+		{ImagePredicateDescriptor{RequireDigest: true}, "nginx:1.17@" + digest, 0},
+		{ImagePredicateDescriptor{Registries: []string{"gcr.io"}, RequireDigest: true}, "nginx", 2},
+		{ImagePredicateDescriptor{}, "Not An Image", 1},
+	} {
+		pf := &predicateFactoryImpl{}
+		check, err := pf.parseImagePredicate("", reflect.TypeOf(""), &c.image)
+		if !assert.NoError(t, err) {
+			continue
+		}
+		assert.Len(t, check(reflect.ValueOf(c.input), location{}), c.failures, "%+v against %q", c.image, c.input)
+	}
+}
@@ -0,0 +1,702 @@
+package predicates
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LintWarning describes a part of a descriptor that is likely wrong: it cannot be built, it can never hold, it always
+// holds, or it repeats itself.
+type LintWarning struct {
+	// Path is the field path the offending node applies to.
+	Path string `json:"path"`
+	// Branch lists the And/Or branches leading to the node, as in violations.
+	Branch  string `json:"branch,omitempty"`
+	Message string `json:"message"`
+}
+
+func (w *LintWarning) String() string {
+	if w.Branch == "" {
+		return fmt.Sprintf("%s: %s", displayPath(w.Path), w.Message)
+	}
+	return fmt.Sprintf("%s: %s (branch %s)", displayPath(w.Path), w.Message, w.Branch)
+}
+
+// Lint checks a descriptor against the type of an example object, and returns warnings for the nodes that cannot be
+// built, that contradict each other (`>=10 and <=5`), that always hold, that repeat a sibling, that Simplify would merge
+// into their parent, or whose value type does not fit the field it is applied to.
+func Lint(example interface{}, d *PredicateDescriptor) []*LintWarning {
+	l := &linter{pf: &predicateFactoryImpl{example: example, clock: time.Now}}
+	l.lint(d, reflect.TypeOf(example), location{})
+	return l.warnings
+}
+
+type linter struct {
+	// pf type-checks CEL rules.
+	pf       *predicateFactoryImpl
+	warnings []*LintWarning
+}
+
+func (l *linter) warn(at location, format string, args ...interface{}) {
+	l.warnings = append(l.warnings, &LintWarning{Path: at.path, Branch: at.branch, Message: fmt.Sprintf(format, args...)})
+}
+
+// descriptorKind names the node a descriptor is built as, following the precedence of parsePredicate.
+func descriptorKind(d *PredicateDescriptor) string {
+	switch {
+	case d == nil:
+		return ""
+	case d.Field != nil:
+		return "field"
+	case d.Quantifier != nil:
+		return "quantifier"
+	case d.Presence != nil:
+		return "presence"
+	case len(d.And) != 0:
+		return "and"
+	case len(d.Or) != 0:
+		return "or"
+	case d.Negate != nil:
+		return "not"
+	case d.Base != nil:
+		return "value"
+	case d.Image != nil:
+		return "image"
+	case d.CEL != nil:
+		return "cel"
+	case d.Ref != "":
+		return "ref"
+	}
+	return ""
+}
+
+func (l *linter) lint(d *PredicateDescriptor, t reflect.Type, at location) {
+	switch descriptorKind(d) {
+	case "field":
+		if child := d.Field.Descriptor; child != nil && child.Base != nil && child.Base.Reference != "" {
+			l.lintReference(d.Field.Path, child.Base, t, at)
+			return
+		}
+		newPath, newType, _, err := resolveFieldPath(at.path, t, d.Field.Path)
+		if err != nil {
+			l.warn(at, "%v", err)
+			return
+		}
+		l.lint(d.Field.Descriptor, newType, location{path: newPath, branch: at.branch})
+	case "quantifier":
+		l.lintQuantifier(d.Quantifier, t, at)
+	case "presence":
+		if d.Presence.Path != "" {
+			if _, _, _, err := resolveFieldPath(at.path, t, d.Presence.Path); err != nil {
+				l.warn(at, "%v", err)
+			}
+		}
+	case "and":
+		l.lintJunction(d.And, "and", t, at)
+	case "or":
+		l.lintJunction(d.Or, "or", t, at)
+	case "not":
+		if descriptorKind(d.Negate) == "not" {
+			l.warn(at, "double negation of %s", describe(d.Negate.Negate))
+		}
+		l.lint(d.Negate, t, at.enter("not"))
+	case "value":
+		if d.Base.Reference != "" {
+			l.lintReference("", d.Base, t, at)
+			return
+		}
+		if _, err := parseValueMatcher(d.Base.Type, d.Base.Value, time.Now); err != nil {
+			l.warn(at, "invalid %s value %q: %v", d.Base.Type, d.Base.Value, err)
+			return
+		}
+		l.checkValueType(d.Base.Type, t, at)
+		if op, operand := splitOperator(d.Base.Value); d.Base.Type == STRING_FIELD && (op == "" || op == opMatch) && matchesAnything(operand) {
+			l.warn(at, "`%s` matches any string", operand)
+		}
+	case "image":
+		if _, err := compileImageChecks(d.Image); err != nil {
+			l.warn(at, "invalid image predicate: %v", err)
+			return
+		}
+		l.checkValueType(STRING_FIELD, t, at)
+	case "cel":
+		if _, err := l.pf.parseCELPredicate(at.path, t, d.CEL); err != nil {
+			l.warn(at, "%v", err)
+		}
+	case "ref":
+		resolved, err := DefaultRegistry.Resolve(d)
+		if err != nil {
+			l.warn(at, "cannot resolve %s: %v", d.Ref, err)
+			return
+		}
+		l.lint(resolved, t, at)
+	default:
+		l.warn(at, "empty descriptor")
+	}
+}
+
+func (l *linter) lintReference(jsonPath string, base *BasePredicateDescriptor, t reflect.Type, at location) {
+	if t = derefType(t); t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		// Both sides are resolved from the same element of a list.
+		l.lintReference(jsonPath, base, t.Elem(), location{path: at.path + "[]", branch: at.branch})
+		return
+	}
+	fieldAt, fieldType := at, t
+	if jsonPath != "" {
+		newPath, newType, _, err := resolveFieldPath(at.path, t, jsonPath)
+		if err != nil {
+			l.warn(at, "%v", err)
+			return
+		}
+		fieldAt, fieldType = location{path: newPath, branch: at.branch}, newType
+	}
+	if _, err := parseValueComparator(base.Type, base.Value); err != nil {
+		l.warn(fieldAt, "invalid %s comparison %q: %v", base.Type, base.Value, err)
+		return
+	}
+	refPath, refType, refSteps, err := resolveFieldPath(at.path, t, base.Reference)
+	if err != nil {
+		l.warn(fieldAt, "%v", err)
+		return
+	}
+	for _, step := range refSteps {
+		if step.kind == elementsStep {
+			l.warn(fieldAt, "reference %s crosses a list, and must resolve to a single value", refPath)
+			return
+		}
+	}
+	l.checkValueType(base.Type, fieldType, fieldAt)
+	l.checkValueType(base.Type, refType, location{path: refPath, branch: at.branch})
+}
+
+func (l *linter) lintQuantifier(q *QuantifierPredicateDescriptor, t reflect.Type, at location) {
+	newPath, newType := at.path, derefType(t)
+	if q.Path != "" {
+		var err error
+		if newPath, newType, _, err = resolveFieldPath(at.path, t, q.Path); err != nil {
+			l.warn(at, "%v", err)
+			return
+		}
+		newType = derefType(newType)
+	}
+	quantifierAt := location{path: newPath, branch: at.branch}
+	var elemType reflect.Type
+	switch newType.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		elemType = newType.Elem()
+	default:
+		l.warn(quantifierAt, "cannot apply %s quantifier to %s", q.Kind, typeName(newType))
+		return
+	}
+	if q.Keys {
+		if newType.Kind() != reflect.Map {
+			l.warn(quantifierAt, "cannot apply %s quantifier to the keys of %s", q.Kind, typeName(newType))
+			return
+		}
+		elemType = newType.Key()
+	}
+	if q.Kind == AT_LEAST_QUANTIFIER && q.Count == 0 {
+		l.warn(quantifierAt, "%s always holds", describeQuantifier(q))
+	}
+	l.lint(q.Descriptor, elemType, location{path: newPath + "[]", branch: at.enter(q.Kind.String()).branch})
+}
+
+// lintJunction checks the children of an And or Or against each other, then each child on its own.
+func (l *linter) lintJunction(children []*PredicateDescriptor, kind string, t reflect.Type, at location) {
+	and := kind == "and"
+	enter := at.or
+	if and {
+		enter = at.and
+	}
+	for i, child := range children {
+		if descriptorKind(child) == kind {
+			l.warn(enter(i), "nested %s can be merged into its parent", kind)
+		}
+		for j := 0; j < i; j++ {
+			if reflect.DeepEqual(child, children[j]) {
+				l.warn(enter(i), "duplicate of %s[%d]", kind, j)
+				break
+			}
+			// Negations are pushed to the leaves, so a negated list means that no element matches rather than that
+			// some element does not, and a condition and its negation can both hold or both fail.
+			if (isNegationOf(child, children[j]) || isNegationOf(children[j], child)) && !crossesList(child, t) {
+				if and {
+					l.warn(at, "never holds: %s[%d] negates %s[%d]", kind, i, kind, j)
+				} else {
+					l.warn(at, "always holds: %s[%d] negates %s[%d]", kind, i, kind, j)
+				}
+			}
+		}
+	}
+	var found []constraint
+	for i, child := range children {
+		start := len(found)
+		if and {
+			found = conjuncts([]*PredicateDescriptor{child}, "", found)
+		} else {
+			found = disjuncts([]*PredicateDescriptor{child}, found)
+		}
+		for k := start; k < len(found); k++ {
+			found[k].child = i
+		}
+	}
+	if and {
+		l.checkConjunction(found, at)
+	} else {
+		l.checkDisjunction(found, at)
+	}
+	for i, child := range children {
+		l.lint(child, t, enter(i))
+	}
+}
+
+func isNegationOf(d, other *PredicateDescriptor) bool {
+	return descriptorKind(d) == "not" && reflect.DeepEqual(d.Negate, other)
+}
+
+// crossesList reports whether a negation of d, applied to a value of type t, would reach a leaf through a list, where
+// it is applied to each element. Paths that cannot be resolved are reported by the linter elsewhere.
+func crossesList(d *PredicateDescriptor, t reflect.Type) bool {
+	switch descriptorKind(d) {
+	case "field":
+		if child := d.Field.Descriptor; child == nil || (child.Base != nil && child.Base.Reference != "") {
+			return false
+		}
+		newType, ok := pathCrossesList(d.Field.Path, t)
+		return ok || crossesList(d.Field.Descriptor, newType)
+	case "quantifier":
+		q := d.Quantifier
+		newType := derefType(t)
+		if q.Path != "" {
+			var ok bool
+			if newType, ok = pathCrossesList(q.Path, t); ok {
+				return true
+			}
+			newType = derefType(newType)
+		}
+		switch {
+		case newType.Kind() == reflect.Map && q.Keys:
+			return crossesList(q.Descriptor, newType.Key())
+		case newType.Kind() == reflect.Slice || newType.Kind() == reflect.Array || newType.Kind() == reflect.Map:
+			return crossesList(q.Descriptor, newType.Elem())
+		}
+	case "presence":
+		if d.Presence.Path != "" {
+			newType, ok := pathCrossesList(d.Presence.Path, t)
+			return ok || (d.Presence.Kind == ZERO_PRESENCE && isListType(newType))
+		}
+	case "and", "or":
+		for _, child := range append(d.And, d.Or...) {
+			if crossesList(child, t) {
+				return true
+			}
+		}
+	case "not":
+		return crossesList(d.Negate, t)
+	case "value":
+		return d.Base.Reference == "" && isListType(t)
+	case "image":
+		return isListType(t)
+	}
+	return false
+}
+
+// pathCrossesList resolves a json path against t, and reports whether it crosses a list or ends at one.
+func pathCrossesList(jsonPath string, t reflect.Type) (reflect.Type, bool) {
+	_, newType, steps, err := resolveFieldPath("", t, jsonPath)
+	if err != nil {
+		return t, false
+	}
+	for _, step := range steps {
+		if step.kind == elementsStep {
+			return newType, true
+		}
+	}
+	return newType, false
+}
+
+func isListType(t reflect.Type) bool {
+	t = derefType(t)
+	return (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8
+}
+
+// constraint is a literal value condition found among the children of an And or Or, with the field path, relative to
+// the And or Or, that it applies to.
+type constraint struct {
+	path  string
+	base  *BasePredicateDescriptor
+	child int
+}
+
+// conjuncts collects the literal value conditions that must all hold, from nested Ands and from fields.
+func conjuncts(ds []*PredicateDescriptor, path string, found []constraint) []constraint {
+	for _, d := range ds {
+		switch descriptorKind(d) {
+		case "and":
+			found = conjuncts(d.And, path, found)
+		case "field":
+			found = conjuncts([]*PredicateDescriptor{d.Field.Descriptor}, appendPath(path, d.Field.Path), found)
+		case "value":
+			if d.Base.Reference == "" {
+				found = append(found, constraint{path: path, base: d.Base})
+			}
+		}
+	}
+	return found
+}
+
+// disjuncts collects the literal value conditions of which one must hold, from nested Ors. Fields are left out, since
+// a field that crosses a list or is missing does not hold just because one of the values would.
+func disjuncts(ds []*PredicateDescriptor, found []constraint) []constraint {
+	for _, d := range ds {
+		switch descriptorKind(d) {
+		case "or":
+			found = disjuncts(d.Or, found)
+		case "value":
+			if d.Base.Reference == "" {
+				found = append(found, constraint{base: d.Base})
+			}
+		}
+	}
+	return found
+}
+
+func appendPath(path, step string) string {
+	if step == "" || strings.HasPrefix(step, "[") {
+		return path + step
+	}
+	return joinPath(path, step)
+}
+
+// groupConstraints groups conditions by the path and type they apply to, in the order they were found. Groups found
+// within a single child are left for that child to check.
+func groupConstraints(found []constraint) [][]constraint {
+	var groups [][]constraint
+	index := map[string]int{}
+	for _, c := range found {
+		key := fmt.Sprintf("%s/%s", c.path, c.base.Type)
+		if i, ok := index[key]; ok {
+			groups[i] = append(groups[i], c)
+			continue
+		}
+		index[key] = len(groups)
+		groups = append(groups, []constraint{c})
+	}
+	var spanning [][]constraint
+	for _, group := range groups {
+		for _, c := range group {
+			if c.child != group[0].child {
+				spanning = append(spanning, group)
+				break
+			}
+		}
+	}
+	return spanning
+}
+
+func describeConstraints(group []constraint, sep string) string {
+	parts := make([]string, 0, len(group))
+	for _, c := range group {
+		parts = append(parts, describeBase(c.base))
+	}
+	return strings.Join(parts, sep)
+}
+
+func (l *linter) checkConjunction(found []constraint, at location) {
+	for _, group := range groupConstraints(found) {
+		groupAt := location{path: appendPath(at.path, group[0].path), branch: at.branch}
+		if group[0].base.Type == NUMERICAL_FIELD {
+			allowed, known := []interval{everything}, true
+			for _, c := range group {
+				ranges, ok := numberIntervals(c.base.Value)
+				known = known && ok
+				if ok {
+					allowed = intersectIntervals(allowed, ranges)
+				}
+			}
+			if known && len(allowed) == 0 {
+				l.warn(groupAt, "contradiction: %s cannot all hold", describeConstraints(group, " and "))
+			}
+			continue
+		}
+		equal, notEqual := map[string]bool{}, map[string]bool{}
+		for _, c := range group {
+			if op, operand, ok := equality(c.base); ok && op == opEqual {
+				equal[operand] = true
+			} else if ok {
+				notEqual[operand] = true
+			}
+		}
+		contradiction := len(equal) > 1
+		for operand := range equal {
+			contradiction = contradiction || notEqual[operand]
+		}
+		if contradiction {
+			l.warn(groupAt, "contradiction: %s cannot all hold", describeConstraints(group, " and "))
+		}
+	}
+}
+
+func (l *linter) checkDisjunction(found []constraint, at location) {
+	for _, group := range groupConstraints(found) {
+		switch group[0].base.Type {
+		case NUMERICAL_FIELD:
+			var allowed []interval
+			for _, c := range group {
+				if ranges, ok := numberIntervals(c.base.Value); ok {
+					allowed = append(allowed, ranges...)
+				}
+			}
+			if coversEverything(allowed) {
+				l.warn(at, "always holds for numbers: %s", describeConstraints(group, " or "))
+			}
+		case BOOLEAN_FIELD, STRING_FIELD:
+			equal, notEqual := map[string]bool{}, map[string]bool{}
+			for _, c := range group {
+				if op, operand, ok := equality(c.base); ok && op == opEqual {
+					equal[operand] = true
+				} else if ok {
+					notEqual[operand] = true
+				}
+			}
+			always := group[0].base.Type == BOOLEAN_FIELD && equal["true"] && equal["false"]
+			for operand := range notEqual {
+				always = always || equal[operand] || len(notEqual) > 1
+			}
+			if always {
+				l.warn(at, "always holds for %ss: %s", group[0].base.Type, describeConstraints(group, " or "))
+			}
+		}
+	}
+}
+
+// equality reads an == or != condition on strings or booleans, with the operand in canonical form.
+func equality(base *BasePredicateDescriptor) (string, string, bool) {
+	op, operand := splitOperator(base.Value)
+	switch base.Type {
+	case BOOLEAN_FIELD:
+		if op == "" {
+			op = opEqual
+		}
+		b, err := strconv.ParseBool(operand)
+		if err != nil {
+			return "", "", false
+		}
+		operand = strconv.FormatBool(b)
+	case STRING_FIELD:
+	default:
+		return "", "", false
+	}
+	if op != opEqual && op != opNotEqual {
+		return "", "", false
+	}
+	return op, operand, true
+}
+
+// interval is a range of numbers. Infinite bounds are open.
+type interval struct {
+	lo, hi         float64
+	loOpen, hiOpen bool
+}
+
+var everything = interval{lo: math.Inf(-1), hi: math.Inf(1), loOpen: true, hiOpen: true}
+
+// numberIntervals reads the numbers a number condition allows.
+func numberIntervals(value string) ([]interval, bool) {
+	op, operand := splitOperator(value)
+	if op == "" && operand == "" {
+		return []interval{everything}, true
+	}
+	n, err := parseNum(operand)
+	if err != nil {
+		return nil, false
+	}
+	switch op {
+	case "", opEqual:
+		return []interval{{lo: n, hi: n}}, true
+	case opNotEqual:
+		return []interval{{lo: everything.lo, hi: n, loOpen: true, hiOpen: true}, {lo: n, hi: everything.hi, loOpen: true, hiOpen: true}}, true
+	case opLess:
+		return []interval{{lo: everything.lo, hi: n, loOpen: true, hiOpen: true}}, true
+	case opLessEqual:
+		return []interval{{lo: everything.lo, hi: n, loOpen: true}}, true
+	case opGreater:
+		return []interval{{lo: n, hi: everything.hi, loOpen: true, hiOpen: true}}, true
+	case opGreaterEqual:
+		return []interval{{lo: n, hi: everything.hi, hiOpen: true}}, true
+	}
+	return nil, false
+}
+
+func (i interval) empty() bool {
+	return i.lo > i.hi || (i.lo == i.hi && (i.loOpen || i.hiOpen))
+}
+
+func intersectIntervals(a, b []interval) []interval {
+	var out []interval
+	for _, x := range a {
+		for _, y := range b {
+			i := x
+			if y.lo > i.lo || (y.lo == i.lo && y.loOpen) {
+				i.lo, i.loOpen = y.lo, y.loOpen
+			}
+			if y.hi < i.hi || (y.hi == i.hi && y.hiOpen) {
+				i.hi, i.hiOpen = y.hi, y.hiOpen
+			}
+			if !i.empty() {
+				out = append(out, i)
+			}
+		}
+	}
+	return out
+}
+
+func coversEverything(intervals []interval) bool {
+	if len(intervals) == 0 {
+		return false
+	}
+	sorted := append([]interval(nil), intervals...)
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].lo != sorted[j].lo {
+			return sorted[i].lo < sorted[j].lo
+		}
+		return !sorted[i].loOpen && sorted[j].loOpen
+	})
+	if !math.IsInf(sorted[0].lo, -1) {
+		return false
+	}
+	hi, hiOpen := sorted[0].hi, sorted[0].hiOpen
+	for _, i := range sorted[1:] {
+		if i.lo > hi || (i.lo == hi && i.loOpen && hiOpen) {
+			return false
+		}
+		if i.hi > hi || (i.hi == hi && !i.hiOpen) {
+			hi, hiOpen = i.hi, i.hiOpen
+		}
+	}
+	return math.IsInf(hi, 1)
+}
+
+// matchesAnything reports whether a regular expression obviously matches every string.
+func matchesAnything(pattern string) bool {
+	switch pattern {
+	case ".*", "^.*", ".*$", "^.*$", "(?s).*", "(?s)^.*$":
+		return true
+	}
+	return false
+}
+
+// checkValueType warns if values of a field's type are never, or only sometimes, read as the given field type.
+func (l *linter) checkValueType(fType FieldType, t reflect.Type, at location) {
+	t = derefType(t)
+	for (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) && t.Elem().Kind() != reflect.Uint8 {
+		// Values are applied to each element of a list.
+		t = derefType(t.Elem())
+	}
+	if t.Kind() == reflect.Interface {
+		return
+	}
+	if fits(fType, t) {
+		return
+	}
+	if t.Kind() == reflect.String {
+		l.warn(at, "%s value applied to a string field only holds for strings that parse as a %s", fType, fType)
+		return
+	}
+	l.warn(at, "%s value applied to %s never holds", fType, typeName(t))
+}
+
+// fits reports whether values of a type are always read by the given field type.
+func fits(fType FieldType, t reflect.Type) bool {
+	kind := t.Kind()
+	isInt := kind >= reflect.Int && kind <= reflect.Int64
+	isNumber := isInt || (kind >= reflect.Uint && kind <= reflect.Float64)
+	switch fType {
+	case STRING_FIELD:
+		return kind == reflect.String || t == intOrStringType || (kind == reflect.Slice && t.Elem().Kind() == reflect.Uint8)
+	case URI_FIELD:
+		return kind == reflect.String
+	case NUMERICAL_FIELD:
+		return isNumber || t == intOrStringType
+	case DATETIME_FIELD:
+		return t == timeType || t == metaTimeType || t == microTimeType
+	case BOOLEAN_FIELD:
+		return kind == reflect.Bool
+	case QUANTITY_FIELD:
+		return t == quantityType || t == intOrStringType || kind == reflect.String || isInt
+	case DURATION_FIELD:
+		return t == durationType || t == metaDurationType || kind == reflect.String || isInt
+	}
+	return false
+}
+
+// Simplify returns a copy of a descriptor with nested Ands and Ors merged into their parents, Ands and Ors of a single
+// condition replaced by it, repeated conditions of an And or Or removed, and double negations dropped. Double negations
+// cancel out even across lists, as negations are pushed to the leaves, see Not. The simplified descriptor holds for the
+// same inputs, but the branches reported in its violations may differ.
+func Simplify(d *PredicateDescriptor) *PredicateDescriptor {
+	switch descriptorKind(d) {
+	case "field":
+		return &PredicateDescriptor{Field: &FieldPathPredicateDescriptor{Path: d.Field.Path, Descriptor: Simplify(d.Field.Descriptor)}}
+	case "quantifier":
+		q := *d.Quantifier
+		q.Descriptor = Simplify(q.Descriptor)
+		return &PredicateDescriptor{Quantifier: &q}
+	case "presence":
+		return &PredicateDescriptor{Presence: d.Presence}
+	case "and":
+		children := simplifyJunction(d.And, "and", nil)
+		if len(children) == 1 {
+			return children[0]
+		}
+		return &PredicateDescriptor{And: children}
+	case "or":
+		children := simplifyJunction(d.Or, "or", nil)
+		if len(children) == 1 {
+			return children[0]
+		}
+		return &PredicateDescriptor{Or: children}
+	case "not":
+		negated := Simplify(d.Negate)
+		if descriptorKind(negated) == "not" {
+			return negated.Negate
+		}
+		return &PredicateDescriptor{Negate: negated}
+	case "value":
+		return &PredicateDescriptor{Base: d.Base}
+	case "image":
+		return &PredicateDescriptor{Image: d.Image}
+	case "cel":
+		return &PredicateDescriptor{CEL: d.CEL}
+	case "ref":
+		return &PredicateDescriptor{Ref: d.Ref}
+	}
+	return d
+}
+
+func simplifyJunction(ds []*PredicateDescriptor, kind string, out []*PredicateDescriptor) []*PredicateDescriptor {
+	for _, d := range ds {
+		simplified := Simplify(d)
+		if descriptorKind(simplified) == kind {
+			grandchildren := simplified.And
+			if kind == "or" {
+				grandchildren = simplified.Or
+			}
+			out = simplifyJunction(grandchildren, kind, out)
+			continue
+		}
+		duplicate := false
+		for _, existing := range out {
+			duplicate = duplicate || reflect.DeepEqual(existing, simplified)
+		}
+		if !duplicate {
+			out = append(out, simplified)
+		}
+	}
+	return out
+}
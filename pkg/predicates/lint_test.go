@@ -0,0 +1,149 @@
+package predicates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+)
+
+func lintMessages(warnings []*LintWarning) []string {
+	var messages []string
+	for _, w := range warnings {
+		messages = append(messages, w.String())
+	}
+	return messages
+}
+
+func TestLint(t *testing.T) {
+	assert.Empty(t, Lint(v1.Pod{}, LivenessProbeDescriptor))
+
+	for _, test := range []struct {
+		name     string
+		d        *PredicateDescriptor
+		expected []string
+	}{{
+		name: "contradiction",
+		d: Conjunction(
+			Field("spec.containers.ports.containerPort", NumberValue(">=10")),
+			Field("spec.containers.ports.containerPort", NumberValue("<=5")),
+		),
+		expected: []string{"spec.containers.ports.containerPort: contradiction: number >= 10 and number <= 5 cannot all hold"},
+	}, {
+		name:     "contradiction under a field",
+		d:        Field("spec.hostname", Conjunction(StringValue("==a"), Not(StringValue("=~b")), StringValue("!=a"))),
+		expected: []string{"spec.hostname: contradiction: equal to `a` and not equal to `a` cannot all hold"},
+	}, {
+		name:     "satisfiable",
+		d:        Field("spec.priority", Conjunction(NumberValue(">=5"), NumberValue("<=5"), NumberValue("!=4"))),
+		expected: nil,
+	}, {
+		name:     "duplicate branch",
+		d:        Field("spec.hostname", Disjunction(StringValue("==a"), StringValue("==b"), StringValue("==a"))),
+		expected: []string{"spec.hostname: duplicate of or[0] (branch or[2])"},
+	}, {
+		name:     "always true",
+		d:        Field("spec.priority", Disjunction(NumberValue("<5"), NumberValue(">=5"))),
+		expected: []string{"spec.priority: always holds for numbers: number < 5 or number >= 5"},
+	}, {
+		name:     "gap",
+		d:        Field("spec.priority", Disjunction(NumberValue("<5"), NumberValue(">5"))),
+		expected: nil,
+	}, {
+		name:     "negation",
+		d:        Disjunction(Exists("spec.hostname"), Not(Exists("spec.hostname"))),
+		expected: []string{"<root>: always holds: or[1] negates or[0]"},
+	}, {
+		name: "negation of a field",
+		d: Conjunction(
+			Field("spec.hostname", StringValue("==app")),
+			Not(Field("spec.hostname", StringValue("==app"))),
+		),
+		expected: []string{"<root>: never holds: and[1] negates and[0]"},
+	}, {
+		// No container is named app, or each is: both fail for a pod with containers app and sidecar.
+		name: "negation across a list",
+		d: Disjunction(
+			Field("spec.containers.name", StringValue("==app")),
+			Not(Field("spec.containers.name", StringValue("==app"))),
+		),
+		expected: nil,
+	}, {
+		name:     "negation of a list value",
+		d:        Field("spec.containers.args", Conjunction(StringValue("==-v"), Not(StringValue("==-v")))),
+		expected: nil,
+	}, {
+		name:     "any string",
+		d:        Field("spec.hostname", StringValue(".*")),
+		expected: []string{"spec.hostname: `.*` matches any string"},
+	}, {
+		name:     "count",
+		d:        CountAtLeast(0, "spec.containers", Exists("name")),
+		expected: []string{"spec.containers: atLeast(0, spec.containers, name exists) always holds"},
+	}, {
+		name: "type mismatch",
+		d: Conjunction(
+			Field("spec.containers.name", NumberValue(">1")),
+			Field("spec.containers.livenessProbe", StringValue("x")),
+		),
+		expected: []string{
+			"spec.containers.name: number value applied to a string field only holds for strings that parse as a number (branch and[0])",
+			"spec.containers.livenessProbe: string value applied to v1.Probe never holds (branch and[1])",
+		},
+	}, {
+		name: "nesting",
+		d:    Conjunction(Conjunction(Exists("spec.hostname"), Exists("spec.subdomain")), Not(Not(Exists("spec.nodeName")))),
+		expected: []string{
+			"<root>: nested and can be merged into its parent (branch and[0])",
+			"<root>: double negation of spec.nodeName exists (branch and[1])",
+		},
+	}, {
+		name:     "unknown field",
+		d:        Field("spec.containers.livenesProbe", Exists("")),
+		expected: []string{`<root>: no field "livenesProbe" in v1.Container at path spec.containers, did you mean "livenessProbe"?`},
+	}, {
+		name:     "invalid value",
+		d:        Field("spec.priority", NumberValue(">=ten")),
+		expected: []string{`spec.priority: invalid number value ">=ten": strconv.ParseFloat: parsing "ten": invalid syntax`},
+	}} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, lintMessages(Lint(v1.Pod{}, test.d)))
+		})
+	}
+
+	named := Field("spec.containers.name", StringValue("==app"))
+	pod := v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app"}, {Name: "sidecar"}}}}
+	predicate, err := NewPredicateFactory(v1.Pod{}).Build(Disjunction(named, Not(named)))
+	assert.NoError(t, err)
+	assert.Len(t, predicate(pod).(*Report).Violations, 2)
+}
+
+func TestSimplify(t *testing.T) {
+	d := Conjunction(
+		Conjunction(Exists("a"), Conjunction(Exists("b"))),
+		Not(Not(Disjunction(Disjunction(Exists("c"), Exists("d")), Exists("c")))),
+		Exists("a"),
+	)
+	assert.Equal(t, Conjunction(Exists("a"), Exists("b"), Disjunction(Exists("c"), Exists("d"))), Simplify(d))
+	assert.Equal(t, Exists("a"), Simplify(Disjunction(Conjunction(Exists("a")))))
+
+	// Negations are pushed to the leaves, so a double negation holds where its operand does, even across a list.
+	named := Field("spec.containers.name", StringValue("==app"))
+	assert.Equal(t, named, Simplify(Not(Not(named))))
+	factory := NewPredicateFactory(v1.Pod{})
+	for _, containers := range [][]v1.Container{nil, {{Name: "app"}}, {{Name: "app"}, {Name: "sidecar"}}} {
+		pod := v1.Pod{Spec: v1.PodSpec{Containers: containers}}
+		doubled, err := factory.Build(Not(Not(named)))
+		assert.NoError(t, err)
+		single, err := factory.Build(named)
+		assert.NoError(t, err)
+		assert.Equal(t, single(pod) == nil, doubled(pod) == nil)
+	}
+
+	// The single-condition Ands of the liveness probe are unwrapped, without changing its outcomes.
+	simplified, err := NewPredicateFactory(v1.Pod{}).Build(Simplify(LivenessProbeDescriptor))
+	assert.NoError(t, err)
+	for _, pod := range syntheticPods(64) {
+		assert.Equal(t, HasLivenessProbe(pod) == nil, simplified(pod) == nil)
+	}
+}
@@ -0,0 +1,209 @@
+package predicates
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The Pod Security Standards, as policies that can audit the pods already running in a cluster. Pod Security
+// Admission only checks pods as they are admitted.
+//
+// The baseline profile prevents known privilege escalations, and the restricted profile adds the hardening best
+// practices on top of it. The SELinux and /proc mount type checks of the baseline profile are not implemented. The API
+// version in use predates the seccompProfile fields, so seccomp profiles are read from their annotations, as are
+// AppArmor profiles.
+
+const podSecurityDocURL = "https://kubernetes.io/docs/concepts/security/pod-security-standards/"
+
+// eachContainerList requires a descriptor to hold for every container of each of the container lists of a pod.
+func eachContainerList(d *PredicateDescriptor) []*PredicateDescriptor {
+	return []*PredicateDescriptor{
+		All("spec.containers", d),
+		All("spec.initContainers", d),
+		All("spec.ephemeralContainers", d),
+	}
+}
+
+// allContainers requires a descriptor to hold for every container, init container and ephemeral container of a pod.
+func allContainers(d *PredicateDescriptor) *PredicateDescriptor {
+	return Conjunction(eachContainerList(d)...)
+}
+
+// celRule builds a CEL descriptor whose violations show a message instead of the rule.
+func celRule(rule, message string) *PredicateDescriptor {
+	return &PredicateDescriptor{CEL: &CELPredicateDescriptor{Rule: rule, Message: message}}
+}
+
+func podSecurityPolicy(name string, profile string, severity Severity, description, remediation string, d *PredicateDescriptor) *Policy {
+	p := NewPolicy("pss-"+name, severity, d)
+	p.Category = "pod-security-" + profile
+	p.Description = description
+	p.Remediation = remediation
+	p.DocURL = podSecurityDocURL
+	return p
+}
+
+// HostNamespacesPolicy forbids sharing the host's network, process and IPC namespaces.
+var HostNamespacesPolicy = podSecurityPolicy("host-namespaces", "baseline", ERROR_SEVERITY,
+	"Pods sharing the host namespaces can see and reach the host's processes and network.",
+	"Remove hostNetwork, hostPID and hostIPC from the pod spec, or set them to false.",
+	Conjunction(
+		Field("spec.hostNetwork", BooleanValue("==false")),
+		Field("spec.hostPID", BooleanValue("==false")),
+		Field("spec.hostIPC", BooleanValue("==false")),
+	),
+)
+
+// PrivilegedContainersPolicy forbids privileged containers.
+var PrivilegedContainersPolicy = podSecurityPolicy("privileged-containers", "baseline", ERROR_SEVERITY,
+	"Privileged containers have all the capabilities of the host's root user.",
+	"Remove securityContext.privileged from every container, or set it to false.",
+	allContainers(Not(Field("securityContext.privileged", BooleanValue("==true")))),
+)
+
+// baselineCapabilities are the capabilities containers may add under the baseline profile.
+const baselineCapabilities = `^(AUDIT_WRITE|CHOWN|DAC_OVERRIDE|FOWNER|FSETID|KILL|MKNOD|NET_BIND_SERVICE|SETFCAP|SETGID|SETPCAP|SETUID|SYS_CHROOT)$`
+
+// BaselineCapabilitiesPolicy only lets containers add the capabilities the container runtimes grant by default.
+var BaselineCapabilitiesPolicy = podSecurityPolicy("baseline-capabilities", "baseline", ERROR_SEVERITY,
+	"Capabilities beyond the runtime defaults, such as SYS_ADMIN or NET_RAW, grant parts of root's privileges.",
+	"Remove the capabilities outside the runtime defaults from securityContext.capabilities.add.",
+	allContainers(All("securityContext.capabilities.add", StringValue(baselineCapabilities))),
+)
+
+// HostPathVolumesPolicy forbids hostPath volumes.
+var HostPathVolumesPolicy = podSecurityPolicy("host-path-volumes", "baseline", ERROR_SEVERITY,
+	"hostPath volumes give containers access to the host's file system.",
+	"Replace hostPath volumes with persistent volume claims, config maps, secrets or emptyDir volumes.",
+	None("spec.volumes", Exists("hostPath")),
+)
+
+// HostPortsPolicy forbids binding container ports to the host.
+var HostPortsPolicy = podSecurityPolicy("host-ports", "baseline", ERROR_SEVERITY,
+	"Host ports expose containers on the node's network, bypassing network policies.",
+	"Remove hostPort from the container ports, and expose them with a service instead.",
+	allContainers(None("ports", Field("hostPort", NumberValue("!=0")))),
+)
+
+// AppArmorPolicy forbids overriding the default AppArmor profile with one other than a local profile.
+var AppArmorPolicy = podSecurityPolicy("apparmor", "baseline", ERROR_SEVERITY,
+	"Disabling AppArmor removes the mandatory access control the runtime applies to containers.",
+	"Set the container.apparmor.security.beta.kubernetes.io annotations to runtime/default or a localhost/ profile, "+
+		"or remove them.",
+	celRule(`!has(self.metadata.annotations) || self.metadata.annotations.all(k,
+		!k.startsWith("container.apparmor.security.beta.kubernetes.io/") ||
+		self.metadata.annotations[k] == "runtime/default" || self.metadata.annotations[k].startsWith("localhost/"))`,
+		"AppArmor profiles of runtime/default or localhost/*"),
+)
+
+// BaselineSeccompPolicy forbids disabling seccomp.
+var BaselineSeccompPolicy = podSecurityPolicy("baseline-seccomp", "baseline", ERROR_SEVERITY,
+	"Unconfined containers can make any system call, including those the runtime's default profile blocks.",
+	"Remove the seccomp.security.alpha.kubernetes.io annotations set to unconfined.",
+	celRule(`!has(self.metadata.annotations) || self.metadata.annotations.all(k,
+		!(k == "seccomp.security.alpha.kubernetes.io/pod" || k.startsWith("container.seccomp.security.alpha.kubernetes.io/")) ||
+		self.metadata.annotations[k] != "unconfined")`,
+		"no unconfined seccomp profile"),
+)
+
+// safeSysctls are the sysctls pods may set under the baseline profile.
+const safeSysctls = `^(kernel\.shm_rmid_forced|net\.ipv4\.ip_local_port_range|net\.ipv4\.ip_unprivileged_port_start|net\.ipv4\.tcp_syncookies|net\.ipv4\.ping_group_range)$`
+
+// SysctlsPolicy only lets pods set the sysctls that are isolated from other pods.
+var SysctlsPolicy = podSecurityPolicy("sysctls", "baseline", ERROR_SEVERITY,
+	"Unsafe sysctls can affect other pods on the node, or the node itself.",
+	"Remove the sysctls other than the safe set from securityContext.sysctls.",
+	All("spec.securityContext.sysctls", Field("name", StringValue(safeSysctls))),
+)
+
+// VolumeTypesPolicy only allows the volume types that do not reach outside the pod's own storage.
+var VolumeTypesPolicy = podSecurityPolicy("volume-types", "restricted", WARNING_SEVERITY,
+	"Volume types other than persistent volume claims and the ones Kubernetes projects can reach node or cluster storage directly.",
+	"Replace the volume with a persistentVolumeClaim, or a configMap, csi, downwardAPI, emptyDir, projected or secret volume.",
+	All("spec.volumes", Disjunction(
+		Exists("configMap"),
+		Exists("csi"),
+		Exists("downwardAPI"),
+		Exists("emptyDir"),
+		Exists("persistentVolumeClaim"),
+		Exists("projected"),
+		Exists("secret"),
+	)),
+)
+
+// PrivilegeEscalationPolicy requires containers to forbid privilege escalation explicitly.
+var PrivilegeEscalationPolicy = podSecurityPolicy("privilege-escalation", "restricted", WARNING_SEVERITY,
+	"Containers allowed to escalate privileges can gain more than their parent process, e.g. through setuid binaries.",
+	"Set securityContext.allowPrivilegeEscalation to false in every container.",
+	allContainers(Field("securityContext.allowPrivilegeEscalation", BooleanValue("==false"))),
+)
+
+// RunAsNonRootPolicy requires containers to run as a non-root user, set for the pod or for every container.
+var RunAsNonRootPolicy = podSecurityPolicy("run-as-non-root", "restricted", WARNING_SEVERITY,
+	"Containers running as root are one kernel or runtime vulnerability away from root on the node.",
+	"Set securityContext.runAsNonRoot to true in the pod spec, and do not set it to false in any container.",
+	Disjunction(
+		Conjunction(append(
+			[]*PredicateDescriptor{Field("spec.securityContext.runAsNonRoot", BooleanValue("==true"))},
+			eachContainerList(Not(Field("securityContext.runAsNonRoot", BooleanValue("==false"))))...,
+		)...),
+		allContainers(Field("securityContext.runAsNonRoot", BooleanValue("==true"))),
+	),
+)
+
+// restrictedSeccompRule requires every container to have an allowed seccomp profile annotation, or to inherit an
+// allowed one from the pod annotation.
+var restrictedSeccompRule = func() string {
+	check := `has(self.metadata.annotations) && (
+		("container.seccomp.security.alpha.kubernetes.io/" + c.name) in self.metadata.annotations ?
+			self.metadata.annotations["container.seccomp.security.alpha.kubernetes.io/" + c.name] :
+			("seccomp.security.alpha.kubernetes.io/pod" in self.metadata.annotations ?
+				self.metadata.annotations["seccomp.security.alpha.kubernetes.io/pod"] : "")
+	).matches("^(runtime/default|docker/default|localhost/.+)$")`
+	var rules []string
+	for _, list := range []string{"containers", "initContainers", "ephemeralContainers"} {
+		rules = append(rules, fmt.Sprintf("(!has(self.spec.%s) || self.spec.%s.all(c, %s))", list, list, check))
+	}
+	return strings.Join(rules, " && ")
+}()
+
+// RestrictedSeccompPolicy requires a seccomp profile, the runtime's default or a local one, for the pod or for every
+// container.
+var RestrictedSeccompPolicy = podSecurityPolicy("restricted-seccomp", "restricted", WARNING_SEVERITY,
+	"Without a seccomp profile, containers can make system calls that are rarely needed and often exploited.",
+	"Set the seccomp.security.alpha.kubernetes.io/pod annotation to runtime/default.",
+	celRule(restrictedSeccompRule, "a seccomp profile of runtime/default, docker/default or localhost/* for every container"),
+)
+
+// RestrictedCapabilitiesPolicy requires containers to drop all capabilities, and only lets them add NET_BIND_SERVICE
+// back.
+var RestrictedCapabilitiesPolicy = podSecurityPolicy("restricted-capabilities", "restricted", WARNING_SEVERITY,
+	"Containers only need the capabilities they use, and NET_BIND_SERVICE is the only one commonly needed.",
+	"Add ALL to securityContext.capabilities.drop in every container, and only add NET_BIND_SERVICE back.",
+	allContainers(Conjunction(
+		Any("securityContext.capabilities.drop", StringValue("==ALL")),
+		All("securityContext.capabilities.add", StringValue("==NET_BIND_SERVICE")),
+	)),
+)
+
+// PodSecurityBaselinePolicies implement the baseline profile of the Pod Security Standards.
+var PodSecurityBaselinePolicies = []*Policy{
+	HostNamespacesPolicy,
+	PrivilegedContainersPolicy,
+	BaselineCapabilitiesPolicy,
+	HostPathVolumesPolicy,
+	HostPortsPolicy,
+	AppArmorPolicy,
+	BaselineSeccompPolicy,
+	SysctlsPolicy,
+}
+
+// PodSecurityRestrictedPolicies implement the restricted profile of the Pod Security Standards, which includes the
+// baseline profile.
+var PodSecurityRestrictedPolicies = append(PodSecurityBaselinePolicies[:len(PodSecurityBaselinePolicies):len(PodSecurityBaselinePolicies)],
+	VolumeTypesPolicy,
+	PrivilegeEscalationPolicy,
+	RunAsNonRootPolicy,
+	RestrictedSeccompPolicy,
+	RestrictedCapabilitiesPolicy,
+)
@@ -0,0 +1,65 @@
+package predicates
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestPodSecurityPolicies(t *testing.T) {
+	// Each policy has its own cases in testdata/policies/pod-security, which TestPolicyFiles runs.
+	for _, p := range PodSecurityRestrictedPolicies {
+		assert.Empty(t, Lint(v1.Pod{}, p.Descriptor), p.Name)
+		_, err := os.Stat(filepath.Join("testdata/policies/pod-security", p.Name+".test.yaml"))
+		assert.NoError(t, err, p.Name)
+	}
+	for _, p := range PodSecurityBaselinePolicies {
+		assert.Equal(t, "pod-security-baseline", p.Category, p.Name)
+	}
+
+	// A pod sharing the host's process namespace, with no security settings, fails these policies at these paths.
+	pod := &v1.Pod{Spec: v1.PodSpec{HostPID: true, Containers: []v1.Container{{Name: "app"}}}}
+	expected := map[string][]string{
+		"pss-host-namespaces":         {"spec.hostPID"},
+		"pss-privilege-escalation":    {"spec.containers[0].securityContext.allowPrivilegeEscalation"},
+		"pss-run-as-non-root":         {"spec.securityContext.runAsNonRoot", "spec.containers[0].securityContext.runAsNonRoot"},
+		"pss-restricted-seccomp":      {""},
+		"pss-restricted-capabilities": {"spec.containers[0].securityContext.capabilities.drop"},
+	}
+	var baselinePaths, restrictedPaths []string
+	for i, p := range PodSecurityRestrictedPolicies {
+		pred, err := BuildPolicy(NewPredicateFactory(v1.Pod{}), p)
+		require.NoError(t, err, p.Name)
+		var paths []string
+		if report, ok := pred(pod).(*Report); ok {
+			assert.Equal(t, p.Name, report.Policy.Name)
+			paths = violationPaths(report)
+		}
+		assert.Equal(t, expected[p.Name], paths, p.Name)
+		if i < len(PodSecurityBaselinePolicies) {
+			baselinePaths = append(baselinePaths, paths...)
+		}
+		restrictedPaths = append(restrictedPaths, paths...)
+	}
+
+	// The registered bundles report the violations of the policies they include, in order.
+	for name, paths := range map[string][]string{"pss-baseline": baselinePaths, "pss-restricted": restrictedPaths} {
+		bundle, err := NewPredicateFactory(v1.Pod{}).Build(Ref(name))
+		require.NoError(t, err)
+		report, ok := bundle(pod).(*Report)
+		require.True(t, ok, name)
+		assert.Equal(t, paths, violationPaths(report), name)
+	}
+}
+
+func violationPaths(report *Report) []string {
+	var paths []string
+	for _, v := range report.Violations {
+		paths = append(paths, v.Path)
+	}
+	return paths
+}
@@ -0,0 +1,115 @@
+package predicates
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"gopkg.in/yaml.v3"
+)
+
+// policyNamespace is the namespace of the name-based UUIDs given to policies without an explicit ID.
+var policyNamespace = uuid.MustParse("5c0b6f4e-3f5a-4d56-9a8e-2c7c1f0b9d41")
+
+// PolicyMetadata identifies a policy and explains it. It is carried by every report the policy produces, so that
+// violations can be triaged.
+type PolicyMetadata struct {
+	// ID is stable across releases. Policies created with NewPolicy, or parsed without an ID, get one derived from
+	// their name.
+	ID          uuid.UUID `json:"id" yaml:"id"`
+	Name        string    `json:"name" yaml:"name"`
+	Severity    Severity  `json:"severity" yaml:"severity"`
+	Category    string    `json:"category,omitempty" yaml:"category,omitempty"`
+	Description string    `json:"description,omitempty" yaml:"description,omitempty"`
+	Remediation string    `json:"remediation,omitempty" yaml:"remediation,omitempty"`
+	DocURL      string    `json:"docURL,omitempty" yaml:"docURL,omitempty"`
+}
+
+// Policy is a descriptor with an identity and the information needed to act on its violations, optionally including a
+// patch that fixes them.
+type Policy struct {
+	PolicyMetadata `yaml:",inline"`
+
+	Descriptor *PredicateDescriptor `json:"predicate" yaml:"predicate"`
+	Fix        *RemediationTemplate `json:"fix,omitempty" yaml:"fix,omitempty"`
+}
+
+// Severity indicates how urgently violations of a policy need attention.
+type Severity int32
+
+const (
+	INFO_SEVERITY Severity = iota
+	WARNING_SEVERITY
+	ERROR_SEVERITY
+	CRITICAL_SEVERITY
+)
+
+func (s Severity) String() string {
+	switch s {
+	case INFO_SEVERITY:
+		return "info"
+	case WARNING_SEVERITY:
+		return "warning"
+	case ERROR_SEVERITY:
+		return "error"
+	case CRITICAL_SEVERITY:
+		return "critical"
+	default:
+		return fmt.Sprintf("Severity(%d)", int32(s))
+	}
+}
+
+// NewPolicy creates a policy with an ID derived from its name.
+func NewPolicy(name string, severity Severity, d *PredicateDescriptor) *Policy {
+	return &Policy{
+		PolicyMetadata: PolicyMetadata{
+			ID:       policyID(name),
+			Name:     name,
+			Severity: severity,
+		},
+		Descriptor: d,
+	}
+}
+
+func policyID(name string) uuid.UUID {
+	return uuid.NewSHA1(policyNamespace, []byte(name))
+}
+
+// ParsePolicy reads a JSON or YAML policy. The descriptor is validated as by ParseDescriptor.
+func ParsePolicy(data []byte) (*Policy, error) {
+	p := &Policy{}
+	if err := yaml.Unmarshal(data, p); err != nil {
+		return nil, err
+	}
+	if p.Name == "" {
+		return nil, errors.New("policy has no name")
+	}
+	if p.Descriptor == nil {
+		return nil, fmt.Errorf("policy %s has no predicate", p.Name)
+	}
+	if p.Fix != nil {
+		if err := p.Fix.Validate(); err != nil {
+			return nil, fmt.Errorf("policy %s: %v", p.Name, err)
+		}
+	}
+	if p.ID == uuid.Nil {
+		p.ID = policyID(p.Name)
+	}
+	return p, nil
+}
+
+// BuildPolicy builds the policy's predicate with a factory. Its reports carry the policy's metadata.
+func BuildPolicy(pf PredicateFactory, p *Policy) (Predicate, error) {
+	pred, err := pf.Build(p.Descriptor)
+	if err != nil {
+		return nil, fmt.Errorf("policy %s: %v", p.Name, err)
+	}
+	metadata := p.PolicyMetadata
+	return func(input interface{}) error {
+		err := pred(input)
+		if report, ok := err.(*Report); ok {
+			report.Policy = &metadata
+		}
+		return err
+	}, nil
+}
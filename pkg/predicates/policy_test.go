@@ -0,0 +1,76 @@
+package predicates
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+)
+
+const registryPolicy = `
+name: trusted-registries
+severity: critical
+category: supply-chain
+description: Images must come from the internal registry.
+remediation: Push the image to registry.internal and update the pod.
+docURL: https://example.com/policies/trusted-registries
+predicate:
+  field: {path: spec.containers.image, predicate: {image: {registries: [registry.internal]}}}
+`
+
+func TestPolicy(t *testing.T) {
+	policy, err := ParsePolicy([]byte(registryPolicy))
+	require.NoError(t, err)
+	assert.Equal(t, CRITICAL_SEVERITY, policy.Severity)
+	assert.Equal(t, NewPolicy("trusted-registries", INFO_SEVERITY, nil).ID, policy.ID)
+
+	pred, err := BuildPolicy(NewPredicateFactory(v1.Pod{}), policy)
+	require.NoError(t, err)
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Image: "nginx"}}}}
+	report := pred(pod).(*Report)
+	require.NotNil(t, report.Policy)
+	assert.Equal(t, policy.PolicyMetadata, *report.Policy)
+	assert.Contains(t, report.Error(), "critical policy trusted-registries failed")
+
+	encoded, err := json.Marshal(report)
+	require.NoError(t, err)
+	var decoded struct {
+		Policy struct {
+			ID       string `json:"id"`
+			Severity string `json:"severity"`
+		} `json:"policy"`
+	}
+	require.NoError(t, json.Unmarshal(encoded, &decoded))
+	assert.Equal(t, policy.ID.String(), decoded.Policy.ID)
+	assert.Equal(t, "critical", decoded.Policy.Severity)
+
+	pod.Spec.Containers[0].Image = "registry.internal/app:1.0"
+	assert.NoError(t, pred(pod))
+}
+
+func TestParsePolicyErrors(t *testing.T) {
+	id := uuid.New()
+	policy, err := ParsePolicy([]byte(`{id: ` + id.String() + `, name: p, severity: info, predicate: {value: {type: string, value: x}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, id, policy.ID)
+
+	for _, doc := range []string{
+		`{severity: info, predicate: {value: {type: string, value: x}}}`,
+		`{name: p, severity: urgent, predicate: {value: {type: string, value: x}}}`,
+		`{name: p, severity: info}`,
+		`{id: not-a-uuid, name: p, severity: info, predicate: {value: {type: string, value: x}}}`,
+	} {
+		_, err := ParsePolicy([]byte(doc))
+		assert.Error(t, err, doc)
+	}
+}
+
+func TestLivenessProbePolicy(t *testing.T) {
+	err := HasLivenessProbe(&v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app"}}}})
+	require.IsType(t, &Report{}, err)
+	assert.Equal(t, "liveness-probe", err.(*Report).Policy.Name)
+	assert.Equal(t, WARNING_SEVERITY, err.(*Report).Policy.Severity)
+}
@@ -0,0 +1,258 @@
+package predicates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	v1 "k8s.io/api/core/v1"
+)
+
+// PolicyTestSuffix is the file name suffix of policy test files.
+const PolicyTestSuffix = ".test.yaml"
+
+// BuiltinPolicies are the policies policy test files can refer to by name.
+var BuiltinPolicies = append([]*Policy{LivenessProbePolicy}, PodSecurityRestrictedPolicies...)
+
+// PolicyTestFile proves that a policy does what it says, with fixture objects it must accept or reject.
+//
+// In YAML:
+//
+//	policy: liveness-probe
+//	cases:
+//	  - name: tcp probe
+//	    fixture: fixtures/tcp-probe.yaml
+//	    pass: true
+//	  - name: missing probe
+//	    object: {spec: {containers: [{name: app}]}}
+//	    violations: [spec.containers[0].livenessProbe]
+type PolicyTestFile struct {
+	// Policy names a built-in policy, or is the path of a policy file relative to the test file.
+	Policy string            `json:"policy" yaml:"policy"`
+	Cases  []*PolicyTestCase `json:"cases" yaml:"cases"`
+}
+
+// PolicyTestCase checks the policy against one object.
+type PolicyTestCase struct {
+	Name string `json:"name" yaml:"name"`
+	// Fixture is the path of a YAML object relative to the test file. Object holds the object inline instead.
+	Fixture string                 `json:"fixture,omitempty" yaml:"fixture,omitempty"`
+	Object  map[string]interface{} `json:"object,omitempty" yaml:"object,omitempty"`
+	Pass    bool                   `json:"pass,omitempty" yaml:"pass,omitempty"`
+	// Violations lists the paths a failing object must have violations at, and no others. If it is empty, any
+	// violations will do.
+	Violations []string `json:"violations,omitempty" yaml:"violations,omitempty"`
+}
+
+// PolicyTestResult is the outcome of a test case. Diffs lists how the policy's outcome differed from the one expected,
+// and is empty if the case passed.
+type PolicyTestResult struct {
+	File   string   `json:"file"`
+	Policy string   `json:"policy"`
+	Case   string   `json:"case"`
+	Diffs  []string `json:"diffs,omitempty"`
+}
+
+// Passed reports whether the policy behaved as the test case expected.
+func (r *PolicyTestResult) Passed() bool {
+	return len(r.Diffs) == 0
+}
+
+func (r *PolicyTestResult) String() string {
+	if r.Passed() {
+		return fmt.Sprintf("PASS %s: %s", r.File, r.Case)
+	}
+	return fmt.Sprintf("FAIL %s: %s\n\t%s", r.File, r.Case, strings.Join(r.Diffs, "\n\t"))
+}
+
+// PolicyTestRunner runs policy test files.
+type PolicyTestRunner struct {
+	// Example is an object of the type fixtures are read as. It defaults to a pod.
+	Example interface{}
+	// Policies are the policies test files can refer to by name. They default to BuiltinPolicies.
+	Policies []*Policy
+}
+
+// Run runs the test files at the given paths. Directories are searched for files ending in PolicyTestSuffix.
+func (r *PolicyTestRunner) Run(paths ...string) ([]*PolicyTestResult, error) {
+	var files []string
+	for _, path := range paths {
+		err := filepath.Walk(path, func(file string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if !info.IsDir() && (file == path || strings.HasSuffix(file, PolicyTestSuffix)) {
+				files = append(files, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(files)
+	var results []*PolicyTestResult
+	for _, file := range files {
+		fileResults, err := r.RunFile(file)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, fileResults...)
+	}
+	return results, nil
+}
+
+// RunFile runs the cases of one test file.
+func (r *PolicyTestRunner) RunFile(file string) ([]*PolicyTestResult, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	tests := &PolicyTestFile{}
+	if err := yaml.Unmarshal(data, tests); err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	results, err := r.RunTests(tests, filepath.Dir(file))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	for _, result := range results {
+		result.File = file
+	}
+	return results, nil
+}
+
+// RunTests runs test cases, reading the files they refer to relative to a directory.
+func (r *PolicyTestRunner) RunTests(tests *PolicyTestFile, dir string) ([]*PolicyTestResult, error) {
+	policy, err := r.policy(tests.Policy, dir)
+	if err != nil {
+		return nil, err
+	}
+	example := r.Example
+	if example == nil {
+		example = v1.Pod{}
+	}
+	pred, err := BuildPolicy(NewPredicateFactory(example), policy)
+	if err != nil {
+		return nil, err
+	}
+	var results []*PolicyTestResult
+	for i, c := range tests.Cases {
+		name := c.Name
+		if name == "" {
+			name = fmt.Sprintf("case %d", i)
+		}
+		object, err := fixtureObject(c, dir, reflect.TypeOf(example))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+		results = append(results, &PolicyTestResult{
+			Policy: policy.Name,
+			Case:   name,
+			Diffs:  diffOutcome(c, pred(object)),
+		})
+	}
+	return results, nil
+}
+
+func (r *PolicyTestRunner) policy(ref string, dir string) (*Policy, error) {
+	if ref == "" {
+		return nil, fmt.Errorf("no policy to test")
+	}
+	policies := r.Policies
+	if policies == nil {
+		policies = BuiltinPolicies
+	}
+	for _, p := range policies {
+		if p.Name == ref {
+			return p, nil
+		}
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, ref))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no policy named %q, and no policy file %s", ref, filepath.Join(dir, ref))
+	} else if err != nil {
+		return nil, err
+	}
+	return ParsePolicy(data)
+}
+
+// fixtureObject reads a test case's object as the example type. Unknown fields are rejected, so that a misspelled
+// field cannot make a fixture pass.
+func fixtureObject(c *PolicyTestCase, dir string, t reflect.Type) (interface{}, error) {
+	fields := c.Object
+	if c.Fixture != "" {
+		if fields != nil {
+			return nil, fmt.Errorf("both a fixture file and an inline object")
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, c.Fixture))
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(data, &fields); err != nil {
+			return nil, fmt.Errorf("%s: %v", c.Fixture, err)
+		}
+	}
+	if fields == nil {
+		return nil, fmt.Errorf("no fixture")
+	}
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return nil, err
+	}
+	object := reflect.New(t)
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(object.Interface()); err != nil {
+		return nil, fmt.Errorf("invalid fixture: %v", err)
+	}
+	return object.Interface(), nil
+}
+
+// diffOutcome compares the outcome of a predicate with the one a test case expects.
+func diffOutcome(c *PolicyTestCase, err error) []string {
+	if err == nil {
+		if c.Pass {
+			return nil
+		}
+		return []string{"expected the object to be rejected, but it was accepted"}
+	}
+	report, ok := err.(*Report)
+	if !ok {
+		return []string{fmt.Sprintf("evaluation failed: %v", err)}
+	}
+	if c.Pass {
+		diffs := []string{"expected the object to be accepted, but it was rejected"}
+		for _, v := range report.Violations {
+			diffs = append(diffs, fmt.Sprintf("+ %s", v))
+		}
+		return diffs
+	}
+	if len(c.Violations) == 0 {
+		return nil
+	}
+	expected, found := map[string]bool{}, map[string]bool{}
+	for _, path := range c.Violations {
+		expected[path] = true
+	}
+	var diffs []string
+	for _, v := range report.Violations {
+		if !expected[v.Path] && !found[v.Path] {
+			diffs = append(diffs, fmt.Sprintf("+ %s", v))
+		}
+		found[v.Path] = true
+	}
+	for _, path := range c.Violations {
+		if !found[path] {
+			diffs = append(diffs, fmt.Sprintf("- %s: expected a violation", displayPath(path)))
+		}
+	}
+	return diffs
+}
@@ -0,0 +1,82 @@
+package predicates
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestPolicyFiles(t *testing.T) {
+	results, err := (&PolicyTestRunner{}).Run("testdata/policies")
+	require.NoError(t, err)
+	require.NotEmpty(t, results)
+	perFile := map[string]int{}
+	for _, result := range results {
+		perFile[result.File]++
+		if !result.Passed() {
+			t.Error(result)
+		}
+	}
+
+	// Every test file is found, and every one of its cases reported.
+	var files []string
+	require.NoError(t, filepath.Walk("testdata/policies", func(file string, info os.FileInfo, err error) error {
+		if err == nil && strings.HasSuffix(file, PolicyTestSuffix) {
+			files = append(files, file)
+		}
+		return err
+	}))
+	assert.Len(t, perFile, len(files))
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		require.NoError(t, err)
+		tests := &PolicyTestFile{}
+		require.NoError(t, yaml.Unmarshal(data, tests), file)
+		assert.NotEmpty(t, tests.Cases, file)
+		assert.Equal(t, len(tests.Cases), perFile[file], file)
+	}
+}
+
+func TestPolicyTestDiffs(t *testing.T) {
+	runner := &PolicyTestRunner{}
+	results, err := runner.RunTests(&PolicyTestFile{
+		Policy: "run-as-non-root.yaml",
+		Cases: []*PolicyTestCase{
+			{Name: "accepted", Fixture: "fixtures/tcp-probe.yaml", Pass: true},
+			{Name: "rejected", Fixture: "fixtures/no-probe.yaml"},
+			{
+				Name:       "wrong path",
+				Object:     map[string]interface{}{"spec": map[string]interface{}{}},
+				Violations: []string{"spec.securityContext"},
+			},
+		},
+	}, "testdata/policies")
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	assert.Equal(t, []string{
+		"expected the object to be accepted, but it was rejected",
+		"+ spec.securityContext.runAsNonRoot: expected boolean == true, got <unset>",
+	}, results[0].Diffs)
+	assert.Equal(t, []string{"expected the object to be rejected, but it was accepted"}, results[1].Diffs)
+	assert.Equal(t, []string{
+		"+ spec.securityContext.runAsNonRoot: expected boolean == true, got <unset>",
+		"- spec.securityContext: expected a violation",
+	}, results[2].Diffs)
+	assert.Equal(t, "FAIL : rejected\n\texpected the object to be rejected, but it was accepted", results[1].String())
+
+	for _, tests := range []*PolicyTestFile{
+		{Policy: "missing-policy"},
+		{Policy: "liveness-probe", Cases: []*PolicyTestCase{{Name: "no object"}}},
+		{Policy: "liveness-probe", Cases: []*PolicyTestCase{{Object: map[string]interface{}{"spec": map[string]interface{}{"containerz": nil}}}}},
+		{Policy: "liveness-probe", Cases: []*PolicyTestCase{{Fixture: "fixtures/missing.yaml"}}},
+	} {
+		_, err := runner.RunTests(tests, "testdata/policies")
+		assert.Error(t, err)
+	}
+}
@@ -1,5 +1,10 @@
 package predicates
 
+import (
+	"fmt"
+	"strconv"
+)
+
 func Disjunction(ds... *PredicateDescriptor) *PredicateDescriptor {
 	return &PredicateDescriptor {
 		Or: ds,
@@ -12,21 +17,132 @@ func Conjunction(ds... *PredicateDescriptor) *PredicateDescriptor {
 	}
 }
 
+// Not builds a descriptor holding where ds does not. The negation is pushed down to the leaves of ds, so when a path
+// under ds crosses a list, Not requires that no element satisfies the leaf rather than that some element fails it:
+// Not(Field("spec.containers.name", StringValue("==app"))) fails if any container is named app, and both it and its
+// negation hold for a pod without containers.
 func Not(ds *PredicateDescriptor) *PredicateDescriptor {
 	return &PredicateDescriptor {
 		Negate: ds,
 	}
 }
 
+// Field builds a descriptor applying d to the value at jsonPath. Lists crossed by the path fan out, so d must hold for
+// every value found, and a negated d must hold for none of them, see Not.
 func Field(jsonPath string, d *PredicateDescriptor) *PredicateDescriptor {
 	return &PredicateDescriptor {
 		Field: &FieldPathPredicateDescriptor{
-			Path:       "jsonPath",
+			Path:       jsonPath,
 			Descriptor: d,
 		},
 	}
 }
 
+func All(jsonPath string, d *PredicateDescriptor) *PredicateDescriptor {
+	return quantifier(ALL_QUANTIFIER, 0, jsonPath, d)
+}
+
+func Any(jsonPath string, d *PredicateDescriptor) *PredicateDescriptor {
+	return quantifier(ANY_QUANTIFIER, 0, jsonPath, d)
+}
+
+func None(jsonPath string, d *PredicateDescriptor) *PredicateDescriptor {
+	return quantifier(NONE_QUANTIFIER, 0, jsonPath, d)
+}
+
+func CountAtLeast(n int, jsonPath string, d *PredicateDescriptor) *PredicateDescriptor {
+	return quantifier(AT_LEAST_QUANTIFIER, n, jsonPath, d)
+}
+
+func CountAtMost(n int, jsonPath string, d *PredicateDescriptor) *PredicateDescriptor {
+	return quantifier(AT_MOST_QUANTIFIER, n, jsonPath, d)
+}
+
+func quantifier(kind QuantifierKind, count int, jsonPath string, d *PredicateDescriptor) *PredicateDescriptor {
+	return &PredicateDescriptor {
+		Quantifier: &QuantifierPredicateDescriptor{
+			Kind:       kind,
+			Count:      count,
+			Path:       jsonPath,
+			Descriptor: d,
+		},
+	}
+}
+
+func AllKeys(jsonPath string, d *PredicateDescriptor) *PredicateDescriptor {
+	return keysQuantifier(ALL_QUANTIFIER, jsonPath, d)
+}
+
+func AnyKey(jsonPath string, d *PredicateDescriptor) *PredicateDescriptor {
+	return keysQuantifier(ANY_QUANTIFIER, jsonPath, d)
+}
+
+func NoKey(jsonPath string, d *PredicateDescriptor) *PredicateDescriptor {
+	return keysQuantifier(NONE_QUANTIFIER, jsonPath, d)
+}
+
+func keysQuantifier(kind QuantifierKind, jsonPath string, d *PredicateDescriptor) *PredicateDescriptor {
+	q := quantifier(kind, 0, jsonPath, d)
+	q.Quantifier.Keys = true
+	return q
+}
+
+// HasKey checks that the map at a path has an entry for the key.
+func HasKey(jsonPath string, key string) *PredicateDescriptor {
+	return Exists(keyPath(jsonPath, key))
+}
+
+// KeyMatches checks that at least one key of the map at a path matches a regular expression.
+func KeyMatches(jsonPath string, pattern string) *PredicateDescriptor {
+	return AnyKey(jsonPath, StringValue(pattern))
+}
+
+// ValueForKeyMatches checks that the map at a path has an entry for the key, and that its value matches a regular
+// expression.
+func ValueForKeyMatches(jsonPath string, key string, pattern string) *PredicateDescriptor {
+	return Field(keyPath(jsonPath, key), StringValue(pattern))
+}
+
+// RequiredKeys checks that the map at a path has an entry for each of the keys. Like any conjunction, it reports every
+// key found missing.
+func RequiredKeys(jsonPath string, keys ...string) *PredicateDescriptor {
+	ds := make([]*PredicateDescriptor, 0, len(keys))
+	for _, key := range keys {
+		ds = append(ds, HasKey(jsonPath, key))
+	}
+	return Conjunction(ds...)
+}
+
+// RequiredLabels checks that an object's metadata carries each of the labels.
+func RequiredLabels(keys ...string) *PredicateDescriptor {
+	return RequiredKeys("metadata.labels", keys...)
+}
+
+func keyPath(jsonPath string, key string) string {
+	return fmt.Sprintf("%s[%s]", jsonPath, strconv.Quote(key))
+}
+
+func Exists(jsonPath string) *PredicateDescriptor {
+	return presence(EXISTS_PRESENCE, jsonPath)
+}
+
+func Missing(jsonPath string) *PredicateDescriptor {
+	return presence(MISSING_PRESENCE, jsonPath)
+}
+
+func IsZero(jsonPath string) *PredicateDescriptor {
+	return presence(ZERO_PRESENCE, jsonPath)
+}
+
+func presence(kind PresenceKind, jsonPath string) *PredicateDescriptor {
+	return &PredicateDescriptor {
+		Presence: &PresencePredicateDescriptor{
+			Kind: kind,
+			Path: jsonPath,
+		},
+	}
+}
+
 func StringValue(value string) *PredicateDescriptor {
 	return &PredicateDescriptor {
 		Base: &BasePredicateDescriptor{
@@ -72,28 +188,103 @@ func BooleanValue(value string) *PredicateDescriptor {
 	}
 }
 
-// PredicateDescriptor describes the operation of a predicate, and can be used to build it.
+func QuantityValue(value string) *PredicateDescriptor {
+	return &PredicateDescriptor {
+		Base: &BasePredicateDescriptor{
+			Type:  QUANTITY_FIELD,
+			Value: value,
+		},
+	}
+}
+
+func DurationValue(value string) *PredicateDescriptor {
+	return &PredicateDescriptor {
+		Base: &BasePredicateDescriptor{
+			Type:  DURATION_FIELD,
+			Value: value,
+		},
+	}
+}
+
+func CompareField(fType FieldType, operator string, jsonPath string) *PredicateDescriptor {
+	return &PredicateDescriptor {
+		Base: &BasePredicateDescriptor{
+			Type:      fType,
+			Value:     operator,
+			Reference: jsonPath,
+		},
+	}
+}
+
+func ImageValue(constraints ImagePredicateDescriptor) *PredicateDescriptor {
+	return &PredicateDescriptor {
+		Image: &constraints,
+	}
+}
+
+// CEL builds a descriptor for a CEL rule the current value must satisfy.
+func CEL(rule string) *PredicateDescriptor {
+	return &PredicateDescriptor{
+		CEL: &CELPredicateDescriptor{Rule: rule},
+	}
+}
+
+// PredicateDescriptor describes the operation of a predicate, and can be used to build it. Exactly one of its fields
+// should be set. See ParseDescriptor for its JSON and YAML form.
+//
+// Negate is not a complement when a path under it crosses a list: the lists fan out and the negation applies to each
+// element, see Not.
 type PredicateDescriptor struct {
-	Field   *FieldPathPredicateDescriptor
+	Field   *FieldPathPredicateDescriptor `json:"field,omitempty" yaml:"field,omitempty"`
 
-	And    []*PredicateDescriptor `json:"and"`
-	Or     []*PredicateDescriptor `json:"or"`
-	Negate *PredicateDescriptor
+	Quantifier *QuantifierPredicateDescriptor `json:"quantifier,omitempty" yaml:"quantifier,omitempty"`
+	Presence   *PresencePredicateDescriptor   `json:"presence,omitempty" yaml:"presence,omitempty"`
 
-	Base   *BasePredicateDescriptor
+	And    []*PredicateDescriptor `json:"and,omitempty" yaml:"and,omitempty"`
+	Or     []*PredicateDescriptor `json:"or,omitempty" yaml:"or,omitempty"`
+	Negate *PredicateDescriptor   `json:"not,omitempty" yaml:"not,omitempty"`
+
+	Base   *BasePredicateDescriptor `json:"value,omitempty" yaml:"value,omitempty"`
+	Image  *ImagePredicateDescriptor `json:"image,omitempty" yaml:"image,omitempty"`
+	CEL    *CELPredicateDescriptor   `json:"cel,omitempty" yaml:"cel,omitempty"`
+	// Ref names a descriptor of the factory's registry, see Registry.
+	Ref string `json:"ref,omitempty" yaml:"ref,omitempty"`
 }
 
 // FieldPathPredicateDescriptor describes a path to apply a predicate to.
 type FieldPathPredicateDescriptor struct {
-	Path string
+	Path string `json:"path" yaml:"path"`
 
-	Descriptor *PredicateDescriptor
+	Descriptor *PredicateDescriptor `json:"predicate" yaml:"predicate"`
 }
 
-// BasePredicateDescriptor describes a check for a single field value.
+// QuantifierPredicateDescriptor describes a predicate applied to each element of the list or map at a path, and how
+// many of the elements must satisfy it. An empty path refers to the current value. If Keys is set, the predicate is
+// applied to the keys of the map instead of its values.
+type QuantifierPredicateDescriptor struct {
+	Kind  QuantifierKind `json:"kind" yaml:"kind"`
+	Count int            `json:"count,omitempty" yaml:"count,omitempty"`
+	Path  string         `json:"path,omitempty" yaml:"path,omitempty"`
+	Keys  bool           `json:"keys,omitempty" yaml:"keys,omitempty"`
+
+	Descriptor *PredicateDescriptor `json:"predicate" yaml:"predicate"`
+}
+
+// PresencePredicateDescriptor describes a check that the value at a path is set, unset or zero. A value is unset if it,
+// or anything on the path to it, is nil or absent, or if it is empty and its field is tagged omitempty. An empty path
+// refers to the current value.
+type PresencePredicateDescriptor struct {
+	Kind PresenceKind `json:"kind" yaml:"kind"`
+	Path string       `json:"path,omitempty" yaml:"path,omitempty"`
+}
+
+// BasePredicateDescriptor describes a check for a single field value. If Reference is set, the value is compared to
+// the field at that path instead of a literal, and Value holds only the operator. Both fields are resolved from the
+// same value: the one the enclosing field path starts at.
 type BasePredicateDescriptor struct {
-	Type  FieldType
-	Value string
+	Type      FieldType `json:"type" yaml:"type"`
+	Value     string    `json:"value,omitempty" yaml:"value,omitempty"`
+	Reference string    `json:"reference,omitempty" yaml:"reference,omitempty"`
 }
 
 // FieldType indicates the type of field that we will be checking. Inspecting different kinds of data requires different
@@ -106,5 +297,78 @@ const (
 	NUMERICAL_FIELD
 	DATETIME_FIELD
 	BOOLEAN_FIELD
+	QUANTITY_FIELD
+	DURATION_FIELD
 )
 
+func (t FieldType) String() string {
+	switch t {
+	case STRING_FIELD:
+		return "string"
+	case URI_FIELD:
+		return "uri"
+	case NUMERICAL_FIELD:
+		return "number"
+	case DATETIME_FIELD:
+		return "datetime"
+	case BOOLEAN_FIELD:
+		return "boolean"
+	case QUANTITY_FIELD:
+		return "quantity"
+	case DURATION_FIELD:
+		return "duration"
+	default:
+		return fmt.Sprintf("FieldType(%d)", int32(t))
+	}
+}
+
+
+// QuantifierKind indicates how many elements of a collection must satisfy a quantified predicate.
+type QuantifierKind int32
+
+const (
+	ALL_QUANTIFIER QuantifierKind = iota
+	ANY_QUANTIFIER
+	NONE_QUANTIFIER
+	AT_LEAST_QUANTIFIER
+	AT_MOST_QUANTIFIER
+)
+
+func (k QuantifierKind) String() string {
+	switch k {
+	case ALL_QUANTIFIER:
+		return "all"
+	case ANY_QUANTIFIER:
+		return "any"
+	case NONE_QUANTIFIER:
+		return "none"
+	case AT_LEAST_QUANTIFIER:
+		return "atLeast"
+	case AT_MOST_QUANTIFIER:
+		return "atMost"
+	default:
+		return fmt.Sprintf("QuantifierKind(%d)", int32(k))
+	}
+}
+
+// PresenceKind indicates which state of a field a presence predicate requires.
+type PresenceKind int32
+
+const (
+	EXISTS_PRESENCE PresenceKind = iota
+	MISSING_PRESENCE
+	ZERO_PRESENCE
+)
+
+func (k PresenceKind) String() string {
+	switch k {
+	case EXISTS_PRESENCE:
+		return "exists"
+	case MISSING_PRESENCE:
+		return "missing"
+	case ZERO_PRESENCE:
+		return "zero"
+	default:
+		return fmt.Sprintf("PresenceKind(%d)", int32(k))
+	}
+}
@@ -3,64 +3,154 @@ package predicates
 import (
 	"errors"
 	"fmt"
-	"github.com/blevesearch/bleve"
 	"reflect"
-	"strconv"
-	"strings"
+	"sort"
+	"sync"
 	"time"
 )
 
 // Predicate defines a function which takes in an object, and returns an error indicating some issue.
-// Super generic.
-type Predicate func(interface{}) bool
+// Super generic. The returned error is a *Report listing every failing leaf, or nil if the object passes.
+type Predicate func(interface{}) error
 
-// Predicate defines a function which takes in an object, and returns an error indicating some issue.
-// Super generic.
-type internalPredicate func(value reflect.Value) bool
+// internalPredicate checks a reflected value found at the given location, and returns the violations it found.
+type internalPredicate func(value reflect.Value, at location) []*Violation
+
+// valueMatcher checks a single reflected value against a base descriptor.
+type valueMatcher func(value reflect.Value) bool
 
 type PredicateFactory interface {
 	Build(d *PredicateDescriptor) (Predicate, error)
 }
 
-func NewPredicateFactory(example interface{}) PredicateFactory {
-	return &predicateFactoryImpl{
+// FactoryOption configures a PredicateFactory.
+type FactoryOption func(*predicateFactoryImpl)
+
+// WithClock sets the clock that relative datetime values, such as `olderThan 30d`, are evaluated against. It defaults
+// to time.Now.
+func WithClock(clock func() time.Time) FactoryOption {
+	return func(pf *predicateFactoryImpl) {
+		pf.clock = clock
+	}
+}
+
+func NewPredicateFactory(example interface{}, opts ...FactoryOption) PredicateFactory {
+	pf := &predicateFactoryImpl{
 		example: example,
+		clock:   time.Now,
+	}
+	for _, opt := range opts {
+		opt(pf)
 	}
+	return pf
 }
 
 type predicateFactoryImpl struct {
 	example interface{}
+	clock   func() time.Time
+	// convert, if set, turns inputs into values of the example's type before they are checked.
+	convert func(input interface{}) (reflect.Value, error)
+	// trace, if set, receives a trace of every evaluation.
+	trace func(*Trace)
+	// registry resolves references. It defaults to DefaultRegistry.
+	registry *Registry
+
+	celOnce sync.Once
+	cel     *celEnvironment
+	celErr  error
 }
 
 func (pf *predicateFactoryImpl) Build(d *PredicateDescriptor) (Predicate, error) {
-	internal, err :=  parsePredicate("", pf.example, d)
+	internal, err := pf.parsePredicate("", reflect.TypeOf(pf.example), d)
 	if err != nil {
 		return nil, err
 	}
-	return func(input interface{}) bool {
-		return internal(reflect.ValueOf(input))
+	return func(input interface{}) error {
+		value := reflect.ValueOf(input)
+		if pf.convert != nil {
+			// Predicates are called concurrently, so the conversion must not share the err of Build.
+			converted, convErr := pf.convert(input)
+			if convErr != nil {
+				return convErr
+			}
+			value = converted
+		}
+		value = addressable(value)
+		if pf.trace != nil {
+			root := &Trace{}
+			violations := internal(value, location{root: value, trace: root})
+			pf.trace(root.Children[0])
+			if len(violations) != 0 {
+				return &Report{Violations: violations}
+			}
+			return nil
+		}
+		// Most inputs pass, so decide first without building a report, and only then find the violations.
+		if len(internal(value, location{quiet: true, root: value})) == 0 {
+			return nil
+		}
+		if violations := internal(value, location{root: value}); len(violations) != 0 {
+			return &Report{Violations: violations}
+		}
+		return nil
 	}, nil
 }
 
 
-func parsePredicate(currentPath string, currentExample interface{}, predD *PredicateDescriptor) (internalPredicate, error) {
+func (pf *predicateFactoryImpl) parsePredicate(currentPath string, currentType reflect.Type, predD *PredicateDescriptor) (internalPredicate, error) {
+	pred, err := pf.parseNode(currentPath, currentType, predD)
+	if err != nil || pf.trace == nil {
+		return pred, err
+	}
+	return traced(predD, pred), nil
+}
+
+func (pf *predicateFactoryImpl) parseNode(currentPath string, currentType reflect.Type, predD *PredicateDescriptor) (internalPredicate, error) {
 	if predD == nil {
 		return nil, errors.New("received a nil descriptor")
 	}
 	if predD.Field != nil {
-		return parseFieldPredicate(currentPath, currentExample, predD)
+		return pf.parseFieldPredicate(currentPath, currentType, predD)
+	} else if predD.Quantifier != nil {
+		return pf.parseQuantifierPredicate(currentPath, currentType, predD)
+	} else if predD.Presence != nil {
+		return pf.parsePresencePredicate(currentPath, currentType, predD)
 	} else if len(predD.And) != 0 {
-		return parseAndPredicate(currentPath, currentExample, predD)
+		return pf.parseAndPredicate(currentPath, currentType, predD)
 	} else if len(predD.Or) != 0 {
-		return parseOrPredicate(currentPath, currentExample, predD)
+		return pf.parseOrPredicate(currentPath, currentType, predD)
+	} else if predD.Negate != nil {
+		return pf.parseNotPredicate(currentPath, currentType, predD)
+	} else if predD.Base != nil && predD.Base.Reference != "" {
+		return pf.parseReferencePredicate(currentPath, currentType, "", predD.Base)
+	} else if predD.Base != nil {
+		return pf.parseBasePredicate(currentPath, currentType, predD.Base)
+	} else if predD.Image != nil {
+		return pf.parseImagePredicate(currentPath, currentType, predD.Image)
+	} else if predD.CEL != nil {
+		return pf.parseCELPredicate(currentPath, currentType, predD.CEL)
+	} else if predD.Ref != "" {
+		return pf.parseRefPredicate(currentPath, currentType, predD)
 	}
 	return nil, errors.New(fmt.Sprintf("empty descriptor at path %s", currentPath))
 }
 
-func parseAndPredicate(currentPath string, currentExample interface{}, andPredicate *PredicateDescriptor) (internalPredicate, error) {
+func (pf *predicateFactoryImpl) parseRefPredicate(currentPath string, currentType reflect.Type, pred *PredicateDescriptor) (internalPredicate, error) {
+	registry := pf.registry
+	if registry == nil {
+		registry = DefaultRegistry
+	}
+	resolved, err := registry.Resolve(pred)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve %s at path %s: %v", pred.Ref, displayPath(currentPath), err)
+	}
+	return pf.parsePredicate(currentPath, currentType, resolved)
+}
+
+func (pf *predicateFactoryImpl) parseAndPredicate(currentPath string, currentType reflect.Type, andPredicate *PredicateDescriptor) (internalPredicate, error) {
 	var ands []internalPredicate
 	for _, pred := range andPredicate.And {
-		q, err := parsePredicate(currentPath, currentExample, pred)
+		q, err := pf.parsePredicate(currentPath, currentType, pred)
 		if err != nil {
 			return nil, err
 		}
@@ -72,20 +162,32 @@ func parseAndPredicate(currentPath string, currentExample interface{}, andPredic
 	if len(ands) == 1 {
 		return ands[0], nil
 	}
-	return func(input reflect.Value) bool {
-		for _, a := range ands {
-			if pass := a(input); !pass {
-				return false
+	order := newChildOrder(len(ands), true)
+	return func(input reflect.Value, at location) []*Violation {
+		if at.quiet {
+			defer order.done()
+			for _, i := range order.current() {
+				failed := len(ands[i](input, at)) != 0
+				order.record(i, failed)
+				if failed {
+					return quietViolations
+				}
 			}
+			return nil
 		}
-		return true
+		// A report lists every failing child, not only the first, so that all the reasons are reported at once.
+		var violations []*Violation
+		for i, a := range ands {
+			violations = append(violations, a(input, at.and(i))...)
+		}
+		return violations
 	}, nil
 }
 
-func parseOrPredicate(currentPath string, currentExample interface{}, orPredicate *PredicateDescriptor) (internalPredicate, error) {
+func (pf *predicateFactoryImpl) parseOrPredicate(currentPath string, currentType reflect.Type, orPredicate *PredicateDescriptor) (internalPredicate, error) {
 	var ors []internalPredicate
 	for _, pred := range orPredicate.Or{
-		q, err := parsePredicate(currentPath, currentExample, pred)
+		q, err := pf.parsePredicate(currentPath, currentType, pred)
 		if err != nil {
 			return nil, err
 		}
@@ -97,185 +199,536 @@ func parseOrPredicate(currentPath string, currentExample interface{}, orPredicat
 	if len(ors) == 1 {
 		return ors[0], nil
 	}
-	return func(input reflect.Value) bool {
-		for _, a := range ors {
-			if pass := a(input); pass {
-				return true
+	order := newChildOrder(len(ors), false)
+	return func(input reflect.Value, at location) []*Violation {
+		if at.quiet {
+			defer order.done()
+			for _, i := range order.current() {
+				failed := len(ors[i](input, at)) != 0
+				order.record(i, failed)
+				if !failed {
+					return nil
+				}
+			}
+			return quietViolations
+		}
+		var violations []*Violation
+		for i, a := range ors {
+			branchViolations := a(input, at.or(i))
+			if len(branchViolations) == 0 {
+				return nil
 			}
+			violations = append(violations, branchViolations...)
 		}
-		return false
+		return violations
 	}, nil
 }
 
-func parseFieldPredicate(currentPath string, currentExample interface{}, pred *PredicateDescriptor) (internalPredicate, error) {
-	newPath, newExample, extractor, err := fieldExtractor(currentPath, currentExample, pred.Field.Path)
-	if err != nil {
-		return nil, err
+func (pf *predicateFactoryImpl) parseNotPredicate(currentPath string, currentType reflect.Type, notPredicate *PredicateDescriptor) (internalPredicate, error) {
+	// Negations are pushed down to the leaves, so that a negated path over a list means that no element matches, and
+	// violations are reported at the values that matched.
+	if pushed := pushNegation(notPredicate.Negate); pushed != nil {
+		return pf.parsePredicate(currentPath, currentType, pushed)
 	}
-	child, err := parsePredicate(newPath, newExample, pred.Field.Descriptor)
+	child, err := pf.parsePredicate(currentPath, currentType, notPredicate.Negate)
 	if err != nil {
 		return nil, err
 	}
-	return func(input reflect.Value) bool {
-		return child(extractor(input))
+	expected := fmt.Sprintf("NOT %s", describe(notPredicate.Negate))
+	negate := func(input reflect.Value, at location) []*Violation {
+		if violations := child(input, at.enter("not")); len(violations) != 0 {
+			return nil
+		}
+		if at.quiet {
+			return quietViolations
+		}
+		return []*Violation{at.violation(expected, input)}
+	}
+	if notPredicate.Negate.Base == nil && notPredicate.Negate.Image == nil {
+		return negate, nil
+	}
+	return func(input reflect.Value, at location) []*Violation {
+		// Base values and images hold for a list if they hold for each of its elements, so their negation must hold
+		// for each element instead.
+		value := indirect(input)
+		if !value.IsValid() || !isCollection(value) {
+			return negate(input, at)
+		}
+		var violations []*Violation
+		for i := 0; i < value.Len(); i++ {
+			violations = append(violations, negate(value.Index(i), at.index(i))...)
+			if at.quiet && len(violations) != 0 {
+				return violations
+			}
+		}
+		return violations
 	}, nil
 }
 
-func fieldExtractor(currentPath string, currentExample interface{}, jsonPath string) (string, interface{}, func(reflect.Value) reflect.Value, error) {
-	steps := strings.Split(jsonPath, ".")
-	if len(steps) == 0 {
-		return "", nil, nil, errors.New(fmt.Sprintf("empty json path for field after: %s", currentPath))
-	}
-	for _, step := range steps {
-		currType := reflect.TypeOf(currentExample)
-		for fieldIndex := 0; fieldIndex < currType.NumField(); fieldIndex++ {
-			currField := currType.FieldByIndex(fieldIndex)
-			jsonTags := currField.
+// pushNegation returns a descriptor equivalent to the negation of d, with the negation moved into its children, or nil
+// if d is a leaf that must be negated as it is.
+func pushNegation(d *PredicateDescriptor) *PredicateDescriptor {
+	switch {
+	case d.Field != nil:
+		if child := d.Field.Descriptor; child == nil || (child.Base != nil && child.Base.Reference != "") {
+			return nil
 		}
-		currentPath = fmt.Sprintf("%s.%s", currentPath, step)
+		return Field(d.Field.Path, Not(d.Field.Descriptor))
+	case d.Quantifier != nil:
+		q := *d.Quantifier
+		switch q.Kind {
+		case ALL_QUANTIFIER:
+			q.Kind, q.Descriptor = ANY_QUANTIFIER, Not(q.Descriptor)
+		case ANY_QUANTIFIER:
+			q.Kind, q.Descriptor = ALL_QUANTIFIER, Not(q.Descriptor)
+		case NONE_QUANTIFIER:
+			q.Kind = ANY_QUANTIFIER
+		case AT_LEAST_QUANTIFIER:
+			if q.Count == 0 {
+				return nil
+			}
+			q.Kind, q.Count = AT_MOST_QUANTIFIER, q.Count-1
+		case AT_MOST_QUANTIFIER:
+			q.Kind, q.Count = AT_LEAST_QUANTIFIER, q.Count+1
+		default:
+			return nil
+		}
+		return &PredicateDescriptor{Quantifier: &q}
+	case d.Presence != nil:
+		switch d.Presence.Kind {
+		case EXISTS_PRESENCE:
+			return Missing(d.Presence.Path)
+		case MISSING_PRESENCE:
+			return Exists(d.Presence.Path)
+		case ZERO_PRESENCE:
+			if d.Presence.Path != "" {
+				return Field(d.Presence.Path, Not(IsZero("")))
+			}
+		}
+		return nil
+	case len(d.And) != 0:
+		return Disjunction(negateAll(d.And)...)
+	case len(d.Or) != 0:
+		return Conjunction(negateAll(d.Or)...)
+	case d.Negate != nil:
+		return d.Negate
 	}
-	return currentPath, nil, nil, nil
+	return nil
 }
 
-func parseBasePredicate(example interface{}, prefix, suffix string, fType FieldType) (internalPredicate, error) {
-	switch fType {
-	case STRING_FIELD:
-		return parseTextPredicate(prefix, suffix)
-	case URI_FIELD:
-		return parseKeywordPredicate(prefix, suffix)
-	case NUMERICAL_FIELD:
-		return parseKeywordPredicate(prefix, suffix)
-	case DATETIME_FIELD:
-		return parseNumberPredicate(prefix, suffix)
-	case BOOLEAN_FIELD:
-		return parseDatePredicate(prefix, suffix)
-	default:
-		return nil, fmt.Errorf("cannot handle field of type %d", fType)
+func negateAll(ds []*PredicateDescriptor) []*PredicateDescriptor {
+	negated := make([]*PredicateDescriptor, 0, len(ds))
+	for _, d := range ds {
+		negated = append(negated, Not(d))
 	}
+	return negated
 }
 
-func parseTextPredicate(prefix, suffix string) (internalPredicate, error) {
-	mq := bleve.NewMatchQuery(suffix)
-	mq.SetField(prefix)
-	return mq, nil
-}
-
-func parseKeywordPredicate(prefix, suffix string) (internalPredicate, error) {
-	mq := bleve.NewMatchQuery(suffix)
-	mq.SetField(prefix)
-	return mq, nil
+func (pf *predicateFactoryImpl) parseFieldPredicate(currentPath string, currentType reflect.Type, pred *PredicateDescriptor) (internalPredicate, error) {
+	if child := pred.Field.Descriptor; child != nil && child.Base != nil && child.Base.Reference != "" {
+		// Both sides of a comparison between fields are resolved from the value the field path starts at.
+		return pf.parseReferencePredicate(currentPath, currentType, pred.Field.Path, child.Base)
+	}
+	newPath, newType, extractor, err := fieldExtractor(currentPath, currentType, pred.Field.Path)
+	if err != nil {
+		return nil, err
+	}
+	child, err := pf.parsePredicate(newPath, newType, pred.Field.Descriptor)
+	if err != nil {
+		return nil, err
+	}
+	return func(input reflect.Value, at location) []*Violation {
+		// Lists crossed by the path fan out, so the child must hold for every value found.
+		return extractor.check(input, at, child)
+	}, nil
 }
 
-func parseNumberPredicate(prefix, suffix string) (internalPredicate, error) {
-	if strings.HasPrefix(suffix, "==") {
-		num, err := parseNum(strings.TrimPrefix(suffix, "=="))
+func (pf *predicateFactoryImpl) parseReferencePredicate(currentPath string, currentType reflect.Type, jsonPath string, base *BasePredicateDescriptor) (internalPredicate, error) {
+	if t := derefType(currentType); t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		// Compare within each element of a list, so that both sides are resolved from the same element.
+		compare, err := pf.parseReferencePredicate(currentPath+"[]", t.Elem(), jsonPath, base)
 		if err != nil {
 			return nil, err
 		}
-		inc := true
-		return bleve.NewNumericRangeInclusiveQuery(&num, &num, &inc, &inc), nil
-	} else if strings.HasPrefix(suffix, "!=") {
-		num, err := parseNum(strings.TrimPrefix(suffix, "!="))
-		if err != nil {
+		return func(input reflect.Value, at location) []*Violation {
+			var violations []*Violation
+			forEachElement(indirect(input), at, func(elem reflect.Value, elemAt location) {
+				violations = append(violations, compare(elem, elemAt)...)
+			})
+			return violations
+		}, nil
+	}
+	extract := identityExtractor
+	if jsonPath != "" {
+		var err error
+		if _, _, extract, err = fieldExtractor(currentPath, currentType, jsonPath); err != nil {
 			return nil, err
 		}
-		inc := false
-		return bleve.NewConjunctionQuery(
-			bleve.NewNumericRangeInclusiveQuery(&num, nil, &inc, nil),
-			bleve.NewNumericRangeInclusiveQuery(nil, &num, nil, &inc),
-		), nil
-	} else if strings.HasPrefix(suffix, "<=") {
-		num, err := parseNum(strings.TrimPrefix(suffix, "<="))
-		if err != nil {
-			return nil, err
+	}
+	refPath, _, refSteps, err := resolveFieldPath(currentPath, currentType, base.Reference)
+	if err != nil {
+		return nil, err
+	}
+	for _, step := range refSteps {
+		if step.kind == elementsStep {
+			return nil, fmt.Errorf("reference %s crosses a list, and must resolve to a single value", refPath)
 		}
-		inc := true
-		return bleve.NewNumericRangeInclusiveQuery(nil, &num, nil, &inc), nil
-	} else if strings.HasPrefix(suffix, ">=") {
-		num, err := parseNum(strings.TrimPrefix(suffix, ">="))
-		if err != nil {
+	}
+	compare, err := parseValueComparator(base.Type, base.Value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s comparison at path %s: %v", base.Type, displayPath(currentPath), err)
+	}
+	extractRef := newExtractor(refSteps)
+	expected := describeBase(base)
+	return func(input reflect.Value, at location) []*Violation {
+		other, _ := extractRef.single(input, at)
+		return extract.check(input, at, func(value reflect.Value, valueAt location) []*Violation {
+			if compare(indirect(value), indirect(other)) {
+				return nil
+			}
+			if valueAt.quiet {
+				return quietViolations
+			}
+			return []*Violation{valueAt.violation(fmt.Sprintf("%s (%s)", expected, formatValue(other)), value)}
+		})
+	}, nil
+}
+
+func (pf *predicateFactoryImpl) parseQuantifierPredicate(currentPath string, currentType reflect.Type, pred *PredicateDescriptor) (internalPredicate, error) {
+	q := pred.Quantifier
+	newPath, newType, extract := currentPath, derefType(currentType), identityExtractor
+	if q.Path != "" {
+		var err error
+		if newPath, newType, extract, err = fieldExtractor(currentPath, currentType, q.Path); err != nil {
 			return nil, err
 		}
-		inc := true
-		return bleve.NewNumericRangeInclusiveQuery(&num, nil, &inc, nil), nil
-	} else if strings.HasPrefix(suffix, "<") {
-		num, err := parseNum(strings.TrimPrefix(suffix, "<"))
-		if err != nil {
-			return nil, err
+	}
+	elements, elemType := forEachElement, reflect.Type(nil)
+	switch newType.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		elemType = newType.Elem()
+	default:
+		return nil, fmt.Errorf("cannot apply %s quantifier to %s at path %s", q.Kind, typeName(newType), displayPath(newPath))
+	}
+	if q.Keys {
+		if newType.Kind() != reflect.Map {
+			return nil, fmt.Errorf("cannot apply %s quantifier to the keys of %s at path %s", q.Kind, typeName(newType), displayPath(newPath))
 		}
-		inc := false
-		return bleve.NewNumericRangeInclusiveQuery(nil, &num, nil, &inc), nil
-	} else if strings.HasPrefix(suffix, ">") {
-		num, err := parseNum(strings.TrimPrefix(suffix, ">"))
-		if err != nil {
-			return nil, err
+		elements, elemType = forEachKey, newType.Key()
+	}
+	if q.Count < 0 {
+		return nil, fmt.Errorf("invalid count %d for %s quantifier at path %s", q.Count, q.Kind, displayPath(newPath))
+	}
+	child, err := pf.parsePredicate(newPath+"[]", elemType, q.Descriptor)
+	if err != nil {
+		return nil, err
+	}
+	expected := describe(pred)
+	elementExpected := fmt.Sprintf("NOT %s", describe(q.Descriptor))
+	check := func(collection reflect.Value, at location) []*Violation {
+		if at.quiet {
+			// Stop as soon as the outcome is known, and skip building the violations.
+			state := quantifierState{kind: q.Kind, count: q.Count}
+			elems := indirect(collection)
+			if elems.IsValid() && !q.Keys && (elems.Kind() == reflect.Slice || elems.Kind() == reflect.Array) {
+				for i := 0; i < elems.Len() && !state.decided; i++ {
+					state.add(len(child(elems.Index(i), at)) == 0)
+				}
+			} else {
+				elements(elems, at, func(elem reflect.Value, elemAt location) {
+					if !state.decided {
+						state.add(len(child(elem, elemAt)) == 0)
+					}
+				})
+			}
+			if state.holds() {
+				return nil
+			}
+			return quietViolations
+		}
+		var failed []*Violation
+		var passing []elementResult
+		total := 0
+		elements(indirect(collection), at, func(elem reflect.Value, elemAt location) {
+			total++
+			violations := child(elem, elemAt.enter(q.Kind.String()))
+			if len(violations) == 0 {
+				passing = append(passing, elementResult{value: elem, at: elemAt})
+			} else {
+				failed = append(failed, violations...)
+			}
+		})
+		summary := &Violation{
+			Path:     at.path,
+			Expected: expected,
+			Actual:   fmt.Sprintf("%d of %d element(s) matched", len(passing), total),
+			Branch:   at.branch,
+		}
+		switch q.Kind {
+		case ALL_QUANTIFIER:
+			return failed
+		case ANY_QUANTIFIER:
+			if len(passing) == 0 {
+				return append([]*Violation{summary}, failed...)
+			}
+		case NONE_QUANTIFIER:
+			var violations []*Violation
+			for _, p := range passing {
+				violations = append(violations, p.at.violation(elementExpected, p.value))
+			}
+			return violations
+		case AT_LEAST_QUANTIFIER:
+			if len(passing) < q.Count {
+				return append([]*Violation{summary}, failed...)
+			}
+		case AT_MOST_QUANTIFIER:
+			if len(passing) > q.Count {
+				return []*Violation{summary}
+			}
 		}
-		inc := false
-		return bleve.NewNumericRangeInclusiveQuery(&num, nil, &inc, nil), nil
+		return nil
+	}
+	return func(input reflect.Value, at location) []*Violation {
+		return extract.check(input, at, check)
+	}, nil
+}
+
+// quantifierState counts the elements passing a quantified predicate, and knows when the outcome is decided.
+type quantifierState struct {
+	kind    QuantifierKind
+	count   int
+	passing int
+	failing int
+	decided bool
+}
+
+func (s *quantifierState) add(passed bool) {
+	if passed {
+		s.passing++
 	} else {
-		return nil, fmt.Errorf("incorrectly formatted number query: %s", suffix)
+		s.failing++
+	}
+	switch s.kind {
+	case ALL_QUANTIFIER:
+		s.decided = s.failing > 0
+	case ANY_QUANTIFIER, NONE_QUANTIFIER:
+		s.decided = s.passing > 0
+	case AT_LEAST_QUANTIFIER:
+		s.decided = s.passing >= s.count
+	case AT_MOST_QUANTIFIER:
+		s.decided = s.passing > s.count
 	}
 }
 
-func parseNum(strNum string) (float64, error) {
-	num, err := strconv.ParseFloat(strNum, 64)
-	if err != nil {
-		return 0, err
+func (s *quantifierState) holds() bool {
+	switch s.kind {
+	case ALL_QUANTIFIER:
+		return s.failing == 0
+	case ANY_QUANTIFIER:
+		return s.passing > 0
+	case NONE_QUANTIFIER:
+		return s.passing == 0
+	case AT_LEAST_QUANTIFIER:
+		return s.passing >= s.count
+	case AT_MOST_QUANTIFIER:
+		return s.passing <= s.count
 	}
-	return num, err
+	return false
 }
 
-func parseDatePredicate(prefix, suffix string) (internalPredicate, error) {
-	if strings.HasPrefix(suffix, "==") {
-		num, err := parseDate(strings.TrimPrefix(suffix, "=="))
+func (pf *predicateFactoryImpl) parsePresencePredicate(currentPath string, currentType reflect.Type, pred *PredicateDescriptor) (internalPredicate, error) {
+	p := pred.Presence
+	extract, omitEmpty := identityExtractor, false
+	if p.Path != "" {
+		_, _, steps, err := resolveFieldPath(currentPath, currentType, p.Path)
 		if err != nil {
 			return nil, err
 		}
-		inc := true
-		return bleve.NewDateRangeInclusiveQuery(num, num, &inc, &inc), nil
-	} else if strings.HasPrefix(suffix, "!=") {
-		num, err := parseDate(strings.TrimPrefix(suffix, "!="))
-		if err != nil {
-			return nil, err
+		extract, omitEmpty = newExtractor(steps), steps[len(steps)-1].omitEmpty
+	}
+	var expected string
+	var check func(value reflect.Value) bool
+	switch p.Kind {
+	case EXISTS_PRESENCE:
+		expected = "set"
+		check = func(value reflect.Value) bool { return !isMissing(value, omitEmpty) }
+	case MISSING_PRESENCE:
+		expected = "unset"
+		check = func(value reflect.Value) bool { return isMissing(value, omitEmpty) }
+	case ZERO_PRESENCE:
+		expected = "unset or zero"
+		check = func(value reflect.Value) bool {
+			value = indirect(value)
+			return !value.IsValid() || value.IsZero()
 		}
-		inc := false
-		return bleve.NewConjunctionQuery(
-			bleve.NewDateRangeInclusiveQuery(num, time.Time{}, &inc, nil),
-			bleve.NewDateRangeInclusiveQuery(time.Time{}, num, nil, &inc),
-		), nil
-	} else if strings.HasPrefix(suffix, "<=") {
-		num, err := parseDate(strings.TrimPrefix(suffix, "<="))
-		if err != nil {
-			return nil, err
+	default:
+		return nil, fmt.Errorf("cannot handle presence check of kind %d at path %s", p.Kind, displayPath(currentPath))
+	}
+	checkValue := func(value reflect.Value, valueAt location) []*Violation {
+		if check(value) {
+			return nil
 		}
-		inc := true
-		return bleve.NewDateRangeInclusiveQuery(time.Time{}, num, nil, &inc), nil
-	} else if strings.HasPrefix(suffix, ">=") {
-		num, err := parseDate(strings.TrimPrefix(suffix, ">="))
-		if err != nil {
-			return nil, err
+		return []*Violation{valueAt.violation(expected, value)}
+	}
+	return func(input reflect.Value, at location) []*Violation {
+		return extract.check(input, at, checkValue)
+	}, nil
+}
+
+// isMissing reports whether a value would be left out of the object's json form: it could not be reached, it is nil,
+// or it is empty and its field is tagged omitempty.
+func isMissing(value reflect.Value, omitEmpty bool) bool {
+	if !value.IsValid() {
+		return true
+	}
+	switch value.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		if value.IsNil() {
+			return true
 		}
-		inc := true
-		return bleve.NewDateRangeInclusiveQuery(num, time.Time{}, &inc, nil), nil
-	} else if strings.HasPrefix(suffix, "<") {
-		num, err := parseDate(strings.TrimPrefix(suffix, "<"))
-		if err != nil {
-			return nil, err
+	}
+	return omitEmpty && isEmptyValue(value)
+}
+
+// isEmptyValue matches the values encoding/json omits from fields tagged omitempty.
+func isEmptyValue(value reflect.Value) bool {
+	switch value.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return value.Len() == 0
+	case reflect.Bool:
+		return !value.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return value.Int() == 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return value.Uint() == 0
+	case reflect.Float32, reflect.Float64:
+		return value.Float() == 0
+	case reflect.Interface, reflect.Ptr:
+		return value.IsNil()
+	}
+	return false
+}
+
+type elementResult struct {
+	value reflect.Value
+	at    location
+}
+
+// forEachElement visits the elements of a list, or the values of a map in key order. A missing collection is empty.
+func forEachElement(collection reflect.Value, at location, visit fieldVisitor) {
+	if !collection.IsValid() {
+		return
+	}
+	switch collection.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < collection.Len(); i++ {
+			visit(collection.Index(i), at.index(i))
+		}
+	case reflect.Map:
+		for _, key := range sortedKeys(collection) {
+			visit(collection.MapIndex(key), keyLocation(at, key))
 		}
-		inc := false
-		return bleve.NewDateRangeInclusiveQuery(time.Time{}, num, nil, &inc), nil
-	} else if strings.HasPrefix(suffix, ">") {
-		num, err := parseDate(strings.TrimPrefix(suffix, ">"))
+	}
+}
+
+// forEachKey visits the keys of a map in order, each at the location of its entry. A missing map is empty.
+func forEachKey(collection reflect.Value, at location, visit fieldVisitor) {
+	if !collection.IsValid() || collection.Kind() != reflect.Map {
+		return
+	}
+	for _, key := range sortedKeys(collection) {
+		visit(key, keyLocation(at, key))
+	}
+}
+
+func sortedKeys(collection reflect.Value) []reflect.Value {
+	keys := collection.MapKeys()
+	sort.Slice(keys, func(i, j int) bool {
+		return fmt.Sprint(keys[i].Interface()) < fmt.Sprint(keys[j].Interface())
+	})
+	return keys
+}
+
+// keyLocation is the location of a map entry. String keys are written as in json paths, so that the path can be read
+// back.
+func keyLocation(at location, key reflect.Value) location {
+	if key.Kind() == reflect.String {
+		return at.key(key.String())
+	}
+	return at.index(key.Interface())
+}
+
+// fieldExtractor resolves a json path against the current type. It returns the extended path, the type found at the
+// end of the path, and an extractor which finds the matching values in an input of the current type.
+func fieldExtractor(currentPath string, currentType reflect.Type, jsonPath string) (string, reflect.Type, extractor, error) {
+	newPath, newType, steps, err := resolveFieldPath(currentPath, currentType, jsonPath)
+	if err != nil {
+		return "", nil, extractor{}, err
+	}
+	return newPath, derefType(newType), newExtractor(steps), nil
+}
+
+// resolveFieldPath resolves each step of a json path against the current type. The type found at the end of the path
+// is returned as declared, without following pointers.
+func resolveFieldPath(currentPath string, currentType reflect.Type, jsonPath string) (string, reflect.Type, []fieldStep, error) {
+	if jsonPath == "" {
+		return "", nil, nil, errors.New(fmt.Sprintf("empty json path for field after: %s", currentPath))
+	}
+	segments, err := splitJSONPath(jsonPath)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("%v after: %s", err, currentPath)
+	}
+	var steps []fieldStep
+	for _, segment := range segments {
+		// Implicitly descend into the elements of any list we cross.
+		currentType = derefType(currentType)
+		for currentType.Kind() == reflect.Slice || currentType.Kind() == reflect.Array {
+			steps = append(steps, fieldStep{kind: elementsStep})
+			currentType = derefType(currentType.Elem())
+		}
+		if segment.bracket && currentType.Kind() != reflect.Map {
+			return "", nil, nil, fmt.Errorf("cannot select key %q of %s at path %s: not a map",
+				segment.name, typeName(currentType), displayPath(currentPath))
+		}
+		step, nextType, err := resolveStep(currentPath, currentType, segment.name)
 		if err != nil {
-			return nil, err
+			return "", nil, nil, err
 		}
-		inc := false
-		return bleve.NewDateRangeInclusiveQuery(num, time.Time{}, &inc, nil), nil
-	} else {
-		return nil, fmt.Errorf("incorrectly formatted number query: %s", suffix)
+		steps = append(steps, step)
+		if step.kind == mapStep {
+			currentPath = formatKey(currentPath, segment.name)
+		} else {
+			currentPath = joinPath(currentPath, segment.name)
+		}
+		currentType = nextType
 	}
+	return currentPath, currentType, steps, nil
 }
 
-func parseDate(strDate string) (time.Time, error) {
-	return time.Parse("2006-01-02T15:04:05.000Z", strDate)
+func (pf *predicateFactoryImpl) parseBasePredicate(currentPath string, currentType reflect.Type, base *BasePredicateDescriptor) (internalPredicate, error) {
+	match, err := parseValueMatcher(base.Type, base.Value, pf.clock)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s predicate at path %s: %v", base.Type, currentPath, err)
+	}
+	expected := describeBase(base)
+	var check internalPredicate
+	check = func(input reflect.Value, at location) []*Violation {
+		value := indirect(input)
+		if value.IsValid() && isCollection(value) {
+			// A base value applied to a list must hold for each of its elements.
+			if value.Len() == 0 {
+				return []*Violation{at.violation(expected, input)}
+			}
+			var violations []*Violation
+			for i := 0; i < value.Len(); i++ {
+				violations = append(violations, check(value.Index(i), at.index(i))...)
+			}
+			return violations
+		}
+		if value.IsValid() && match(value) {
+			return nil
+		}
+		return []*Violation{at.violation(expected, input)}
+	}
+	return check, nil
 }
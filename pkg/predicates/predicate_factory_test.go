@@ -0,0 +1,389 @@
+package predicates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// violationStrings builds a descriptor against pods, and returns the violations it finds in a pod.
+func violationStrings(t *testing.T, d *PredicateDescriptor, pod *v1.Pod) []string {
+	pred, err := NewPredicateFactory(v1.Pod{}).Build(d)
+	require.NoError(t, err)
+	err = pred(pod)
+	if err == nil {
+		return nil
+	}
+	require.IsType(t, &Report{}, err)
+	var violations []string
+	for _, v := range err.(*Report).Violations {
+		violations = append(violations, v.String())
+	}
+	return violations
+}
+
+func TestNot(t *testing.T) {
+	pod := func() *v1.Pod {
+		return &v1.Pod{Spec: v1.PodSpec{
+			HostNetwork: true,
+			Hostname:    "a",
+			Subdomain:   "b",
+			NodeName:    "node-1",
+			Containers: []v1.Container{
+				{Name: "app", Image: "app:1.0", Args: []string{"serve", "--debug"}},
+				{Name: "debug", Image: "nginx:latest"},
+			},
+		}}
+	}
+	for _, c := range []struct {
+		name       string
+		d          *PredicateDescriptor
+		violations []string
+		// fix changes the pod so that the descriptor holds.
+		fix func(*v1.Pod)
+	}{{
+		name:       "no element of a list matches",
+		d:          Not(Field("spec.containers.image", StringValue("=~:latest$"))),
+		violations: []string{"spec.containers[1].image: expected NOT matching `:latest$`, got \"nginx:latest\""},
+		fix:        func(p *v1.Pod) { p.Spec.Containers = p.Spec.Containers[:1] },
+	}, {
+		name:       "empty list",
+		d:          Not(Field("spec.containers.image", StringValue("=~:latest$"))),
+		violations: []string{"spec.containers[1].image: expected NOT matching `:latest$`, got \"nginx:latest\""},
+		fix:        func(p *v1.Pod) { p.Spec.Containers = nil },
+	}, {
+		name:       "single value",
+		d:          Not(Field("spec.hostNetwork", BooleanValue("==true"))),
+		violations: []string{"spec.hostNetwork: expected NOT boolean == true, got true"},
+		fix:        func(p *v1.Pod) { p.Spec.HostNetwork = false },
+	}, {
+		name: "and",
+		d:    Not(Conjunction(Field("spec.hostname", StringValue("==a")), Field("spec.subdomain", StringValue("==b")))),
+		violations: []string{
+			"spec.hostname: expected NOT equal to `a`, got \"a\" (branch or[0])",
+			"spec.subdomain: expected NOT equal to `b`, got \"b\" (branch or[1])",
+		},
+		fix: func(p *v1.Pod) { p.Spec.Subdomain = "c" },
+	}, {
+		name:       "or",
+		d:          Not(Disjunction(Field("spec.hostname", StringValue("==x")), Field("spec.subdomain", StringValue("==b")))),
+		violations: []string{"spec.subdomain: expected NOT equal to `b`, got \"b\" (branch and[1])"},
+		fix:        func(p *v1.Pod) { p.Spec.Subdomain = "c" },
+	}, {
+		name:       "quantifier",
+		d:          Not(Any("spec.containers", Field("name", StringValue("==debug")))),
+		violations: []string{"spec.containers[1].name: expected NOT equal to `debug`, got \"debug\" (branch all)"},
+		fix:        func(p *v1.Pod) { p.Spec.Containers[1].Name = "sidecar" },
+	}, {
+		name:       "count quantifier",
+		d:          Not(CountAtLeast(1, "spec.containers", Exists("args"))),
+		violations: []string{"spec.containers: expected atMost(0, spec.containers, args exists), got 1 of 2 element(s) matched"},
+		fix:        func(p *v1.Pod) { p.Spec.Containers[0].Args = nil },
+	}, {
+		name:       "presence",
+		d:          Not(Exists("spec.nodeName")),
+		violations: []string{"spec.nodeName: expected unset, got \"node-1\""},
+		fix:        func(p *v1.Pod) { p.Spec.NodeName = "" },
+	}, {
+		name:       "base value applied to a list",
+		d:          Field("spec.containers.args", Not(StringValue("==--debug"))),
+		violations: []string{"spec.containers[0].args[1]: expected NOT equal to `--debug`, got \"--debug\""},
+		fix:        func(p *v1.Pod) { p.Spec.Containers[0].Args = nil },
+	}, {
+		name:       "double negation",
+		d:          Not(Not(Field("spec.hostname", StringValue("==x")))),
+		violations: []string{"spec.hostname: expected equal to `x`, got \"a\""},
+		fix:        func(p *v1.Pod) { p.Spec.Hostname = "x" },
+	}} {
+		t.Run(c.name, func(t *testing.T) {
+			p := pod()
+			assert.Equal(t, c.violations, violationStrings(t, c.d, p))
+			c.fix(p)
+			assert.Empty(t, violationStrings(t, c.d, p))
+		})
+	}
+}
+
+func TestPushNegation(t *testing.T) {
+	a, b := Field("spec.hostname", StringValue("==a")), Field("spec.subdomain", StringValue("==b"))
+	for _, c := range []struct {
+		d, expected *PredicateDescriptor
+	}{
+		{Field("spec", a), Field("spec", Not(a))},
+		// A reference resolves from where the field path starts, so the negation stays outside of it.
+		{Field("spec.priority", CompareField(NUMERICAL_FIELD, "<=", "spec.activeDeadlineSeconds")), nil},
+		{Conjunction(a, b), Disjunction(Not(a), Not(b))},
+		{Disjunction(a, b), Conjunction(Not(a), Not(b))},
+		{All("spec.containers", a), Any("spec.containers", Not(a))},
+		{Any("spec.containers", a), All("spec.containers", Not(a))},
+		{None("spec.containers", a), Any("spec.containers", a)},
+		{CountAtLeast(2, "spec.containers", a), CountAtMost(1, "spec.containers", a)},
+		{CountAtLeast(0, "spec.containers", a), nil},
+		{CountAtMost(1, "spec.containers", a), CountAtLeast(2, "spec.containers", a)},
+		{Exists("spec.nodeName"), Missing("spec.nodeName")},
+		{Missing("spec.nodeName"), Exists("spec.nodeName")},
+		{IsZero("spec.nodeName"), Field("spec.nodeName", Not(IsZero("")))},
+		{IsZero(""), nil},
+		{Not(a), a},
+		{StringValue("==a"), nil},
+	} {
+		assert.Equal(t, c.expected, pushNegation(c.d))
+	}
+}
+
+func TestQuantifiers(t *testing.T) {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": "web", "Tier": "x", "kubernetes.io/os": ""}},
+		Spec: v1.PodSpec{Containers: []v1.Container{
+			{Name: "app", Image: "app:1.0"},
+			{Name: "debug", Image: "busybox"},
+		}},
+	}
+	// An empty pod has no containers and a nil label map.
+	empty := &v1.Pod{}
+	for _, c := range []struct {
+		d     *PredicateDescriptor
+		pod   []string
+		empty []string
+	}{{
+		d:   All("spec.containers", Field("image", StringValue("=~:"))),
+		pod: []string{"spec.containers[1].image: expected matching `:`, got \"busybox\" (branch all)"},
+	}, {
+		d: Any("spec.containers", Field("name", StringValue("==sidecar"))),
+		pod: []string{
+			"spec.containers: expected any(spec.containers, name equal to `sidecar`), got 0 of 2 element(s) matched",
+			"spec.containers[0].name: expected equal to `sidecar`, got \"app\" (branch any)",
+			"spec.containers[1].name: expected equal to `sidecar`, got \"debug\" (branch any)",
+		},
+		empty: []string{"spec.containers: expected any(spec.containers, name equal to `sidecar`), got 0 of 0 element(s) matched"},
+	}, {
+		d:   None("spec.containers", Field("name", StringValue("==debug"))),
+		pod: []string{`spec.containers[1]: expected NOT name equal to ` + "`debug`" + `, got {"name":"debug","image":"busybox","resources":{}}`},
+	}, {
+		d: CountAtLeast(2, "spec.containers", Field("image", StringValue("=~:"))),
+		pod: []string{
+			"spec.containers: expected atLeast(2, spec.containers, image matching `:`), got 1 of 2 element(s) matched",
+			"spec.containers[1].image: expected matching `:`, got \"busybox\" (branch atLeast)",
+		},
+		empty: []string{"spec.containers: expected atLeast(2, spec.containers, image matching `:`), got 0 of 0 element(s) matched"},
+	}, {
+		d:   CountAtMost(1, "spec.containers", Exists("name")),
+		pod: []string{"spec.containers: expected atMost(1, spec.containers, name exists), got 2 of 2 element(s) matched"},
+	}, {
+		d: AllKeys("metadata.labels", StringValue("=~^[a-z]+$")),
+		pod: []string{
+			"metadata.labels.Tier: expected matching `^[a-z]+$`, got \"Tier\" (branch all)",
+			"metadata.labels[\"kubernetes.io/os\"]: expected matching `^[a-z]+$`, got \"kubernetes.io/os\" (branch all)",
+		},
+	}, {
+		d:     AnyKey("metadata.labels", StringValue("==app")),
+		empty: []string{"metadata.labels: expected any(keys(metadata.labels), equal to `app`), got 0 of 0 element(s) matched"},
+	}, {
+		d:   NoKey("metadata.labels", StringValue("=~^kubernetes.io/")),
+		pod: []string{"metadata.labels[\"kubernetes.io/os\"]: expected NOT matching `^kubernetes.io/`, got \"kubernetes.io/os\""},
+	}, {
+		// Quantifiers over a map without keys apply to its values.
+		d:   All("metadata.labels", StringValue("!=")),
+		pod: []string{"metadata.labels[\"kubernetes.io/os\"]: expected not equal to ``, got \"\" (branch all)"},
+	}} {
+		assert.Equal(t, c.pod, violationStrings(t, c.d, pod), describe(c.d))
+		assert.Equal(t, c.empty, violationStrings(t, c.d, empty), describe(c.d))
+	}
+
+	_, err := NewPredicateFactory(v1.Pod{}).Build(All("spec.hostname", Exists("")))
+	assert.EqualError(t, err, "cannot apply all quantifier to string at path spec.hostname")
+	_, err = NewPredicateFactory(v1.Pod{}).Build(AnyKey("spec.containers", Exists("")))
+	assert.EqualError(t, err, "cannot apply any quantifier to the keys of []v1.Container at path spec.containers")
+	_, err = NewPredicateFactory(v1.Pod{}).Build(CountAtMost(-1, "spec.containers", Exists("")))
+	assert.EqualError(t, err, "invalid count -1 for atMost quantifier at path spec.containers")
+}
+
+func TestPresence(t *testing.T) {
+	zero, one := int64(0), int64(1)
+	pods := map[string]*v1.Pod{
+		// Nothing is set, so the security context on the way to runAsUser is a nil pointer.
+		"unset": {},
+		"empty": {
+			ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{}},
+			Spec: v1.PodSpec{
+				SecurityContext: &v1.PodSecurityContext{},
+				Containers:      []v1.Container{},
+				Volumes:         []v1.Volume{},
+			},
+		},
+		"set": {Spec: v1.PodSpec{
+			SecurityContext: &v1.PodSecurityContext{RunAsUser: &zero},
+			Containers:      []v1.Container{{Name: "app"}, {Name: "sidecar", SecurityContext: &v1.SecurityContext{RunAsUser: &one}}},
+		}},
+	}
+	for _, c := range []struct {
+		d          *PredicateDescriptor
+		violations map[string][]string
+	}{{
+		d: Exists("spec.securityContext.runAsUser"),
+		violations: map[string][]string{
+			"unset": {"spec.securityContext.runAsUser: expected set, got <unset>"},
+			"empty": {"spec.securityContext.runAsUser: expected set, got <nil>"},
+		},
+	}, {
+		d:          Missing("spec.securityContext.runAsUser"),
+		violations: map[string][]string{"set": {"spec.securityContext.runAsUser: expected unset, got 0"}},
+	}, {
+		// A pointer to a zero value is zero.
+		d: IsZero("spec.securityContext.runAsUser"),
+	}, {
+		// A struct is set once its pointer is, even if all of its fields are zero.
+		d:          Exists("spec.securityContext"),
+		violations: map[string][]string{"unset": {"spec.securityContext: expected set, got <nil>"}},
+	}, {
+		d: Missing("spec.securityContext"),
+		violations: map[string][]string{
+			"empty": {"spec.securityContext: expected unset, got {}"},
+			"set":   {`spec.securityContext: expected unset, got {"runAsUser":0}`},
+		},
+	}, {
+		d:          IsZero("spec.securityContext"),
+		violations: map[string][]string{"set": {`spec.securityContext: expected unset or zero, got {"runAsUser":0}`}},
+	}, {
+		// An empty list is set unless its field is tagged omitempty.
+		d:          Exists("spec.containers"),
+		violations: map[string][]string{"unset": {"spec.containers: expected set, got <nil>"}},
+	}, {
+		d: Exists("spec.volumes"),
+		violations: map[string][]string{
+			"unset": {"spec.volumes: expected set, got <nil>"},
+			"empty": {"spec.volumes: expected set, got []"},
+			"set":   {"spec.volumes: expected set, got <nil>"},
+		},
+	}, {
+		d: IsZero("spec.volumes"),
+		// Only a nil slice is zero.
+		violations: map[string][]string{"empty": {"spec.volumes: expected unset or zero, got []"}},
+	}, {
+		d: Missing("metadata.labels"),
+	}, {
+		d: Exists("metadata.labels"),
+		violations: map[string][]string{
+			"unset": {"metadata.labels: expected set, got <nil>"},
+			"empty": {"metadata.labels: expected set, got {}"},
+			"set":   {"metadata.labels: expected set, got <nil>"},
+		},
+	}, {
+		d:          IsZero("metadata.labels"),
+		violations: map[string][]string{"empty": {"metadata.labels: expected unset or zero, got {}"}},
+	}, {
+		// A struct field is always set, as encoding/json never omits structs.
+		d: Exists("spec.containers.resources"),
+	}, {
+		d: IsZero("spec.containers.resources"),
+	}, {
+		// Presence checks apply to each element of a list on the way.
+		d:          Exists("spec.containers.securityContext.runAsUser"),
+		violations: map[string][]string{"set": {"spec.containers[0].securityContext.runAsUser: expected set, got <unset>"}},
+	}, {
+		d:          Missing("spec.containers.securityContext.runAsUser"),
+		violations: map[string][]string{"set": {"spec.containers[1].securityContext.runAsUser: expected unset, got 1"}},
+	}, {
+		d:          IsZero("spec.containers.securityContext.runAsUser"),
+		violations: map[string][]string{"set": {"spec.containers[1].securityContext.runAsUser: expected unset or zero, got 1"}},
+	}} {
+		for name, pod := range pods {
+			assert.Equal(t, c.violations[name], violationStrings(t, c.d, pod), "%s on the %s pod", describe(c.d), name)
+		}
+	}
+}
+
+func TestCompareField(t *testing.T) {
+	ten, thirty := int64(10), int64(30)
+	probe := func(delay int32) *v1.Probe { return &v1.Probe{InitialDelaySeconds: delay} }
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "web"},
+		Spec: v1.PodSpec{
+			Hostname:                      "web",
+			Subdomain:                     "api",
+			ActiveDeadlineSeconds:         &ten,
+			TerminationGracePeriodSeconds: &thirty,
+			Containers: []v1.Container{{
+				Name:           "app",
+				LivenessProbe:  probe(10),
+				ReadinessProbe: probe(5),
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceMemory: resource.MustParse("512Mi")},
+					Limits:   v1.ResourceList{v1.ResourceMemory: resource.MustParse("1Gi")},
+				},
+			}, {
+				Name:           "sidecar",
+				LivenessProbe:  probe(1),
+				ReadinessProbe: probe(5),
+				Resources: v1.ResourceRequirements{
+					Requests: v1.ResourceList{v1.ResourceMemory: resource.MustParse("2Gi")},
+				},
+			}},
+		},
+	}
+	for _, c := range []struct {
+		d          *PredicateDescriptor
+		violations []string
+	}{{
+		d: Field("spec.hostname", CompareField(STRING_FIELD, "==", "metadata.name")),
+	}, {
+		d:          Field("spec.subdomain", CompareField(STRING_FIELD, "==", "metadata.name")),
+		violations: []string{`spec.subdomain: expected string == metadata.name ("web"), got "api"`},
+	}, {
+		d: Field("spec.terminationGracePeriodSeconds", CompareField(NUMERICAL_FIELD, ">=", "spec.activeDeadlineSeconds")),
+	}, {
+		d:          Field("spec.activeDeadlineSeconds", CompareField(NUMERICAL_FIELD, ">=", "spec.terminationGracePeriodSeconds")),
+		violations: []string{"spec.activeDeadlineSeconds: expected number >= spec.terminationGracePeriodSeconds (30), got 10"},
+	}, {
+		// Within a list, both sides are resolved from the same element.
+		d: Field("spec.containers", Field("livenessProbe.initialDelaySeconds",
+			CompareField(NUMERICAL_FIELD, ">=", "readinessProbe.initialDelaySeconds"))),
+		violations: []string{"spec.containers[1].livenessProbe.initialDelaySeconds: expected number >= readinessProbe.initialDelaySeconds (5), got 1"},
+	}, {
+		d: All("spec.containers", Field("livenessProbe.initialDelaySeconds",
+			CompareField(NUMERICAL_FIELD, ">=", "readinessProbe.initialDelaySeconds"))),
+		violations: []string{"spec.containers[1].livenessProbe.initialDelaySeconds: expected number >= readinessProbe.initialDelaySeconds (5), got 1 (branch all)"},
+	}, {
+		// A missing reference fails the comparison.
+		d: Field("spec.containers", Field(`resources.requests["memory"]`,
+			CompareField(QUANTITY_FIELD, "<=", `resources.limits["memory"]`))),
+		violations: []string{`spec.containers[1].resources.requests.memory: expected quantity <= resources.limits["memory"] (<unset>), got 2Gi`},
+	}, {
+		// So do values of the wrong type.
+		d:          Field("spec.hostname", CompareField(NUMERICAL_FIELD, "==", "spec.activeDeadlineSeconds")),
+		violations: []string{`spec.hostname: expected number == spec.activeDeadlineSeconds (10), got "web"`},
+	}, {
+		d:          Field("spec.priority", CompareField(NUMERICAL_FIELD, "!=", "spec.activeDeadlineSeconds")),
+		violations: []string{"spec.priority: expected number != spec.activeDeadlineSeconds (10), got <nil>"},
+	}} {
+		assert.Equal(t, c.violations, violationStrings(t, c.d, pod), describe(c.d))
+	}
+
+	for _, c := range []struct {
+		d   *PredicateDescriptor
+		err string
+	}{{
+		d:   Field("spec.hostname", CompareField(STRING_FIELD, "==", "metadata.nmae")),
+		err: `no field "nmae" in v1.ObjectMeta at path metadata, did you mean "name"?`,
+	}, {
+		// References resolve from where the field path starts, not from the compared value.
+		d:   Field("spec.containers.livenessProbe.initialDelaySeconds", CompareField(NUMERICAL_FIELD, ">=", "readinessProbe.initialDelaySeconds")),
+		err: `no field "readinessProbe" in v1.Pod at path <root>`,
+	}, {
+		d:   Field("spec.hostname", CompareField(STRING_FIELD, "==", "spec.containers.name")),
+		err: "reference spec.containers.name crosses a list, and must resolve to a single value",
+	}, {
+		d:   Field("spec.hostname", CompareField(STRING_FIELD, "==5", "metadata.name")),
+		err: `invalid string comparison at path <root>: expected only an operator when comparing to a field, found "==5"`,
+	}, {
+		d:   Field("spec.hostname", CompareField(BOOLEAN_FIELD, "<", "metadata.name")),
+		err: "invalid boolean comparison at path <root>: operator < cannot be applied to a boolean",
+	}} {
+		_, err := NewPredicateFactory(v1.Pod{}).Build(c.d)
+		assert.EqualError(t, err, c.err, describe(c.d))
+	}
+}
@@ -0,0 +1,95 @@
+package predicates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestKeyPath(t *testing.T) {
+	for _, c := range []struct {
+		key      string
+		path     string
+		segments []pathSegment
+	}{
+		{"team", `metadata.labels["team"]`, []pathSegment{{name: "metadata"}, {name: "labels"}, {name: "team", bracket: true}}},
+		{"app.kubernetes.io/name", `metadata.labels["app.kubernetes.io/name"]`,
+			[]pathSegment{{name: "metadata"}, {name: "labels"}, {name: "app.kubernetes.io/name", bracket: true}}},
+		{`say "hi"`, `metadata.labels["say \"hi\""]`, []pathSegment{{name: "metadata"}, {name: "labels"}, {name: `say "hi"`, bracket: true}}},
+	} {
+		path := keyPath("metadata.labels", c.key)
+		assert.Equal(t, c.path, path)
+		segments, err := splitJSONPath(path)
+		if assert.NoError(t, err, path) {
+			assert.Equal(t, c.segments, segments, path)
+		}
+	}
+}
+
+func TestMapKeyPredicates(t *testing.T) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{
+		Labels:      map[string]string{"app.kubernetes.io/name": "web", "team": "payments"},
+		Annotations: map[string]string{"prometheus.io/scrape": "true", "kubernetes.io/description": "front end"},
+	}}
+	// An empty pod has nil label and annotation maps.
+	empty := &v1.Pod{}
+	for _, c := range []struct {
+		d     *PredicateDescriptor
+		pod   []string
+		empty []string
+	}{{
+		d:     HasKey("metadata.labels", "app.kubernetes.io/name"),
+		empty: []string{`metadata.labels["app.kubernetes.io/name"]: expected set, got <unset>`},
+	}, {
+		d:     HasKey("metadata.annotations", "prometheus.io/port"),
+		pod:   []string{`metadata.annotations["prometheus.io/port"]: expected set, got <unset>`},
+		empty: []string{`metadata.annotations["prometheus.io/port"]: expected set, got <unset>`},
+	}, {
+		d:     KeyMatches("metadata.annotations", `^prometheus\.io/`),
+		empty: []string{"metadata.annotations: expected any(keys(metadata.annotations), matching `^prometheus\\.io/`), got 0 of 0 element(s) matched"},
+	}, {
+		d: KeyMatches("metadata.labels", `^helm\.sh/`),
+		pod: []string{
+			"metadata.labels: expected any(keys(metadata.labels), matching `^helm\\.sh/`), got 0 of 2 element(s) matched",
+			"metadata.labels[\"app.kubernetes.io/name\"]: expected matching `^helm\\.sh/`, got \"app.kubernetes.io/name\" (branch any)",
+			"metadata.labels.team: expected matching `^helm\\.sh/`, got \"team\" (branch any)",
+		},
+		empty: []string{"metadata.labels: expected any(keys(metadata.labels), matching `^helm\\.sh/`), got 0 of 0 element(s) matched"},
+	}, {
+		d:     ValueForKeyMatches("metadata.annotations", "prometheus.io/scrape", "^(true|false)$"),
+		empty: []string{"metadata.annotations[\"prometheus.io/scrape\"]: expected matching `^(true|false)$`, got <unset>"},
+	}, {
+		d:     ValueForKeyMatches("metadata.labels", "team", "^platform$"),
+		pod:   []string{"metadata.labels.team: expected matching `^platform$`, got \"payments\""},
+		empty: []string{"metadata.labels.team: expected matching `^platform$`, got <unset>"},
+	}, {
+		d: RequiredKeys("metadata.annotations", "prometheus.io/scrape", "prometheus.io/port"),
+		pod: []string{
+			`metadata.annotations["prometheus.io/port"]: expected set, got <unset> (branch and[1])`,
+		},
+		empty: []string{
+			`metadata.annotations["prometheus.io/scrape"]: expected set, got <unset> (branch and[0])`,
+			`metadata.annotations["prometheus.io/port"]: expected set, got <unset> (branch and[1])`,
+		},
+	}, {
+		d: RequiredLabels("app.kubernetes.io/name", "app.kubernetes.io/part-of", "tier"),
+		pod: []string{
+			`metadata.labels["app.kubernetes.io/part-of"]: expected set, got <unset> (branch and[1])`,
+			`metadata.labels.tier: expected set, got <unset> (branch and[2])`,
+		},
+		empty: []string{
+			`metadata.labels["app.kubernetes.io/name"]: expected set, got <unset> (branch and[0])`,
+			`metadata.labels["app.kubernetes.io/part-of"]: expected set, got <unset> (branch and[1])`,
+			`metadata.labels.tier: expected set, got <unset> (branch and[2])`,
+		},
+	}} {
+		assert.Equal(t, c.pod, violationStrings(t, c.d, pod), describe(c.d))
+		assert.Equal(t, c.empty, violationStrings(t, c.d, empty), describe(c.d))
+	}
+
+	// Keys can only be selected in maps.
+	_, err := NewPredicateFactory(v1.Pod{}).Build(HasKey("metadata.name", "team"))
+	assert.EqualError(t, err, `cannot select key "team" of string at path metadata.name: not a map`)
+}
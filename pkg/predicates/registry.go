@@ -0,0 +1,279 @@
+package predicates
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry holds named, versioned descriptors, so that descriptors can share building blocks by referring to them with
+// Ref instead of copying them. A reference is either a name, which resolves to the latest version registered under it,
+// or a name pinned to a version, e.g. `port-validator@v2`.
+type Registry struct {
+	mu      sync.RWMutex
+	entries map[string]map[string]*PredicateDescriptor
+}
+
+// DefaultRegistry is the registry references are resolved against unless a factory is given another one with
+// WithRegistry. It holds the built-in building blocks.
+var DefaultRegistry = builtinRegistry()
+
+func builtinRegistry() *Registry {
+	r := NewRegistry()
+	r.MustRegister("port-validator", "v1", PortValidator)
+	r.MustRegister("liveness-probe", "v1", LivenessProbeDescriptor)
+	for _, profile := range []struct {
+		name     string
+		policies []*Policy
+	}{{"pss-baseline", PodSecurityBaselinePolicies}, {"pss-restricted", PodSecurityRestrictedPolicies}} {
+		var refs []*PredicateDescriptor
+		for _, p := range profile.policies {
+			if _, _, err := r.Lookup(p.Name); err != nil {
+				r.MustRegister(p.Name, "v1", p.Descriptor)
+			}
+			refs = append(refs, Ref(p.Name+"@v1"))
+		}
+		r.MustRegister(profile.name, "v1", Conjunction(refs...))
+	}
+	return r
+}
+
+func NewRegistry() *Registry {
+	return &Registry{entries: map[string]map[string]*PredicateDescriptor{}}
+}
+
+// WithRegistry sets the registry that references are resolved against. It defaults to DefaultRegistry.
+func WithRegistry(r *Registry) FactoryOption {
+	return func(pf *predicateFactoryImpl) {
+		pf.registry = r
+	}
+}
+
+// Ref builds a descriptor for the registered descriptor a reference names.
+func Ref(ref string) *PredicateDescriptor {
+	return &PredicateDescriptor{
+		Ref: ref,
+	}
+}
+
+// RefCycleError reports references that resolve to themselves. Cycle lists the pinned references in the order they
+// were followed, starting and ending with the same one.
+type RefCycleError struct {
+	Cycle []string
+}
+
+func (e *RefCycleError) Error() string {
+	return fmt.Sprintf("reference cycle: %s", strings.Join(e.Cycle, " -> "))
+}
+
+// Register adds a version of a named descriptor. Versions cannot be replaced, and a descriptor that would make
+// references resolve in a cycle is rejected. Descriptors may refer to names that are not registered yet.
+func (r *Registry) Register(name, version string, d *PredicateDescriptor) error {
+	if name == "" || strings.ContainsAny(name, "@ ") {
+		return fmt.Errorf("invalid descriptor name %q", name)
+	}
+	if version == "" || strings.ContainsAny(version, "@ ") {
+		return fmt.Errorf("invalid version %q of descriptor %s", version, name)
+	}
+	if d == nil {
+		return fmt.Errorf("received a nil descriptor for %s@%s", name, version)
+	}
+	r.mu.Lock()
+	versions := r.entries[name]
+	if versions == nil {
+		versions = map[string]*PredicateDescriptor{}
+		r.entries[name] = versions
+	}
+	if _, ok := versions[version]; ok {
+		r.mu.Unlock()
+		return fmt.Errorf("descriptor %s@%s is already registered", name, version)
+	}
+	versions[version] = d
+	r.mu.Unlock()
+
+	if err := r.checkCycles(); err != nil {
+		r.mu.Lock()
+		delete(versions, version)
+		if len(versions) == 0 {
+			delete(r.entries, name)
+		}
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// MustRegister is like Register, but panics if the descriptor cannot be registered.
+func (r *Registry) MustRegister(name, version string, d *PredicateDescriptor) {
+	if err := r.Register(name, version, d); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup finds the descriptor a reference names, and returns it with the reference pinned to the version found.
+func (r *Registry) Lookup(ref string) (*PredicateDescriptor, string, error) {
+	name, version := splitRef(ref)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions, ok := r.entries[name]
+	if !ok {
+		return nil, "", fmt.Errorf("no descriptor named %s is registered", name)
+	}
+	if version == "" {
+		version = latestVersion(versions)
+	}
+	d, ok := versions[version]
+	if !ok {
+		return nil, "", fmt.Errorf("no version %s of descriptor %s is registered", version, name)
+	}
+	return d, fmt.Sprintf("%s@%s", name, version), nil
+}
+
+// Names lists the registered references, pinned to each of their versions.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var names []string
+	for name, versions := range r.entries {
+		for version := range versions {
+			names = append(names, fmt.Sprintf("%s@%s", name, version))
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve replaces the references of a descriptor by the descriptors they name, recursively. Parts of the descriptor
+// without references are shared with the original.
+func (r *Registry) Resolve(d *PredicateDescriptor) (*PredicateDescriptor, error) {
+	return r.resolve(d, nil)
+}
+
+// resolve expands references, tracking the references being expanded to detect cycles.
+func (r *Registry) resolve(d *PredicateDescriptor, expanding []string) (*PredicateDescriptor, error) {
+	if d == nil || !hasRefs(d) {
+		return d, nil
+	}
+	if d.Ref != "" {
+		target, pinned, err := r.Lookup(d.Ref)
+		if err != nil {
+			return nil, err
+		}
+		for i, ref := range expanding {
+			if ref == pinned {
+				return nil, &RefCycleError{Cycle: append(expanding[i:len(expanding):len(expanding)], pinned)}
+			}
+		}
+		return r.resolve(target, append(expanding[:len(expanding):len(expanding)], pinned))
+	}
+	var err error
+	resolved := *d
+	child := func(c *PredicateDescriptor) *PredicateDescriptor {
+		if err != nil {
+			return c
+		}
+		var out *PredicateDescriptor
+		out, err = r.resolve(c, expanding)
+		return out
+	}
+	children := func(cs []*PredicateDescriptor) []*PredicateDescriptor {
+		if cs == nil {
+			return nil
+		}
+		out := make([]*PredicateDescriptor, 0, len(cs))
+		for _, c := range cs {
+			out = append(out, child(c))
+		}
+		return out
+	}
+	if d.Field != nil {
+		resolved.Field = &FieldPathPredicateDescriptor{Path: d.Field.Path, Descriptor: child(d.Field.Descriptor)}
+	}
+	if d.Quantifier != nil {
+		q := *d.Quantifier
+		q.Descriptor = child(q.Descriptor)
+		resolved.Quantifier = &q
+	}
+	resolved.And, resolved.Or, resolved.Negate = children(d.And), children(d.Or), child(d.Negate)
+	if err != nil {
+		return nil, err
+	}
+	return &resolved, nil
+}
+
+// checkCycles resolves every registered descriptor, failing on the first cycle found. Missing references are left for
+// Build to report, since they may be registered later.
+func (r *Registry) checkCycles() error {
+	for _, ref := range r.Names() {
+		if _, err := r.resolve(Ref(ref), nil); err != nil {
+			if _, ok := err.(*RefCycleError); ok {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func hasRefs(d *PredicateDescriptor) bool {
+	if d == nil {
+		return false
+	}
+	if d.Ref != "" {
+		return true
+	}
+	if d.Field != nil && hasRefs(d.Field.Descriptor) {
+		return true
+	}
+	if d.Quantifier != nil && hasRefs(d.Quantifier.Descriptor) {
+		return true
+	}
+	for _, c := range d.And {
+		if hasRefs(c) {
+			return true
+		}
+	}
+	for _, c := range d.Or {
+		if hasRefs(c) {
+			return true
+		}
+	}
+	return hasRefs(d.Negate)
+}
+
+func splitRef(ref string) (string, string) {
+	if i := strings.LastIndex(ref, "@"); i >= 0 {
+		return ref[:i], ref[i+1:]
+	}
+	return ref, ""
+}
+
+// latestVersion picks the highest version, comparing the numbers in versions such as v2 or 1.10.0 numerically.
+func latestVersion(versions map[string]*PredicateDescriptor) string {
+	latest := ""
+	for version := range versions {
+		if latest == "" || compareVersions(version, latest) > 0 {
+			latest = version
+		}
+	}
+	return latest
+}
+
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(strings.TrimPrefix(a, "v"), "."), strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(as) && i < len(bs); i++ {
+		an, aErr := strconv.Atoi(as[i])
+		bn, bErr := strconv.Atoi(bs[i])
+		switch {
+		case aErr == nil && bErr == nil && an != bn:
+			if an < bn {
+				return -1
+			}
+			return 1
+		case (aErr != nil || bErr != nil) && as[i] != bs[i]:
+			return strings.Compare(as[i], bs[i])
+		}
+	}
+	return len(as) - len(bs)
+}
@@ -0,0 +1,83 @@
+package predicates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, r.Register("port", "v1", PortValidator))
+	require.NoError(t, r.Register("port", "v2", NumberValue("<=65535")))
+	require.NoError(t, r.Register("port", "v10", NumberValue("<=80")))
+	require.NoError(t, r.Register("probe-port", "v1", Field("livenessProbe.tcpSocket.port", Ref("port@v2"))))
+	assert.Error(t, r.Register("port", "v1", PortValidator))
+	assert.Error(t, r.Register("port@v3", "v3", PortValidator))
+
+	_, pinned, err := r.Lookup("port")
+	require.NoError(t, err)
+	assert.Equal(t, "port@v10", pinned)
+	_, _, err = r.Lookup("port@v3")
+	assert.EqualError(t, err, "no version v3 of descriptor port is registered")
+
+	pf := NewPredicateFactory(v1.Pod{}, WithRegistry(r))
+	pred, err := pf.Build(All("spec.containers", Conjunction(Exists("livenessProbe.tcpSocket"), Ref("probe-port"))))
+	require.NoError(t, err)
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{LivenessProbe: &v1.Probe{Handler: v1.Handler{
+		TCPSocket: &v1.TCPSocketAction{},
+	}}}}}}
+	pod.Spec.Containers[0].LivenessProbe.TCPSocket.Port.IntVal = 20000
+	assert.NoError(t, pred(pod))
+	pod.Spec.Containers[0].LivenessProbe.TCPSocket.Port.IntVal = 70000
+	assert.Error(t, pred(pod))
+
+	_, err = pf.Build(Field("spec.priority", Ref("missing")))
+	assert.EqualError(t, err, "cannot resolve missing at path spec.priority: no descriptor named missing is registered")
+
+	// The built-in building blocks are in the default registry.
+	pred, err = NewPredicateFactory(v1.Pod{}).Build(Ref("liveness-probe@v1"))
+	require.NoError(t, err)
+	for _, pod := range syntheticPods(16) {
+		assert.Equal(t, HasLivenessProbe(pod) == nil, pred(pod) == nil)
+	}
+}
+
+func TestRegistryCycles(t *testing.T) {
+	r := NewRegistry()
+	require.NoError(t, r.Register("a", "v1", Conjunction(Exists("spec"), Ref("b"))))
+	require.NoError(t, r.Register("b", "v1", Not(Ref("c"))))
+	err := r.Register("c", "v1", Field("spec", Ref("a@v1")))
+	require.Error(t, err)
+	assert.Equal(t, []string{"a@v1", "b@v1", "c@v1", "a@v1"}, err.(*RefCycleError).Cycle)
+	assert.Equal(t, []string{"a@v1", "b@v1"}, r.Names())
+
+	// A self reference pinned to another version is not a cycle.
+	require.NoError(t, r.Register("c", "v1", Exists("spec")))
+	require.NoError(t, r.Register("c", "v2", Disjunction(Ref("c@v1"), Missing("spec"))))
+	resolved, err := r.Resolve(Ref("c"))
+	require.NoError(t, err)
+	assert.Equal(t, Disjunction(Exists("spec"), Missing("spec")), resolved)
+}
+
+func TestRefEncoding(t *testing.T) {
+	d, err := ParseDescriptor([]byte(`{field: {path: spec.priority, predicate: {ref: port-validator@v1}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, Field("spec.priority", Ref("port-validator@v1")), d)
+
+	d, err = ParseExpression(`all(spec.containers, ports { all(@, containerPort { ref("port-validator") }) })`)
+	require.NoError(t, err)
+	expression, err := FormatExpression(d)
+	require.NoError(t, err)
+	assert.Equal(t, `all(spec.containers, ports { all(@, containerPort { ref("port-validator") }) })`, expression)
+
+	assert.Empty(t, Lint(v1.Pod{}, Field("spec.priority", Ref("port-validator"))))
+	assert.Equal(t, []string{
+		"spec.hostname: number value applied to a string field only holds for strings that parse as a number (branch and[0])",
+		"spec.hostname: number value applied to a string field only holds for strings that parse as a number (branch and[1])",
+	}, lintMessages(Lint(v1.Pod{}, Field("spec.hostname", Ref("port-validator")))))
+	assert.Equal(t, []string{"spec.priority: cannot resolve port: no descriptor named port is registered"},
+		lintMessages(Lint(v1.Pod{}, Field("spec.priority", Ref("port")))))
+}
@@ -0,0 +1,302 @@
+package predicates
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// RemediationTemplate proposes a fix for the objects that fail a policy, as a patch against the failing object.
+//
+// The patch is a text/template rendering YAML. It is executed with the object's JSON form as .Object. With ForEach set,
+// it is instead executed once for each element of the list at that path that violations were reported under, with the
+// element as .Item and its index as .Index, and the results are combined. The `json` function renders a value as JSON,
+// which is also valid YAML.
+//
+// For a JSON patch the template renders a list of RFC 6902 operations:
+//
+//	type: json
+//	forEach: spec.containers
+//	patch: |
+//	  {{ with .Item.ports }}
+//	  - op: add
+//	    path: /spec/containers/{{ $.Index }}/livenessProbe
+//	    value: {tcpSocket: {port: {{ (index . 0).containerPort }}}}
+//	  {{ end }}
+//
+// For a strategic-merge patch it renders an object. Objects rendered for several elements are merged, concatenating
+// their lists, which the API server then merges by key:
+//
+//	type: strategic-merge
+//	patch: '{spec: {securityContext: {runAsNonRoot: true}}}'
+type RemediationTemplate struct {
+	Type    PatchType `json:"type" yaml:"type"`
+	ForEach string    `json:"forEach,omitempty" yaml:"forEach,omitempty"`
+	Patch   string    `json:"patch" yaml:"patch"`
+}
+
+// PatchType is the format of a remediation patch.
+type PatchType int32
+
+const (
+	// JSON_PATCH is an RFC 6902 JSON Patch, a list of operations.
+	JSON_PATCH PatchType = iota
+	// STRATEGIC_MERGE_PATCH is a Kubernetes strategic-merge patch, a partial object.
+	STRATEGIC_MERGE_PATCH
+)
+
+func (t PatchType) String() string {
+	switch t {
+	case JSON_PATCH:
+		return "json"
+	case STRATEGIC_MERGE_PATCH:
+		return "strategic-merge"
+	default:
+		return fmt.Sprintf("PatchType(%d)", int32(t))
+	}
+}
+
+// Patch is a proposed fix for an object.
+type Patch struct {
+	Type PatchType       `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// patchOperation is one operation of a JSON patch. From and Value are kept as they were rendered, so that a null
+// value is told apart from a missing one.
+type patchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  *string         `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// patchOperationMembers gives, for each JSON patch operation, the member it requires besides op and path.
+var patchOperationMembers = map[string]string{
+	"add": "value", "remove": "", "replace": "value", "move": "from", "copy": "from", "test": "value",
+}
+
+// remediationData is what a remediation template is executed with.
+type remediationData struct {
+	Object interface{}
+	Item   interface{}
+	Index  int
+}
+
+var remediationFuncs = template.FuncMap{
+	"json": func(value interface{}) (string, error) {
+		encoded, err := json.Marshal(value)
+		return string(encoded), err
+	},
+}
+
+// Remediate proposes a patch for an input that failed the policy with the given error. It returns nil if the policy
+// has no remediation template, the error is not a report, or the template renders nothing for the input.
+func (p *Policy) Remediate(input interface{}, err error) (*Patch, error) {
+	report, ok := err.(*Report)
+	if p.Fix == nil || !ok {
+		return nil, nil
+	}
+	patch, err := p.Fix.Render(input, report)
+	if err != nil {
+		return nil, fmt.Errorf("policy %s: %v", p.Name, err)
+	}
+	return patch, nil
+}
+
+// Validate checks that the template and its ForEach path can be parsed.
+func (t *RemediationTemplate) Validate() error {
+	_, _, err := t.compile()
+	return err
+}
+
+func (t *RemediationTemplate) compile() (*template.Template, []pathSegment, error) {
+	if t.Type != JSON_PATCH && t.Type != STRATEGIC_MERGE_PATCH {
+		return nil, nil, fmt.Errorf("unknown patch type %s", t.Type)
+	}
+	tmpl, err := template.New("patch").Funcs(remediationFuncs).Parse(t.Patch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid remediation template: %v", err)
+	}
+	var forEach []pathSegment
+	if t.ForEach != "" {
+		if forEach, err = splitJSONPath(t.ForEach); err != nil {
+			return nil, nil, fmt.Errorf("invalid remediation forEach: %v", err)
+		}
+	}
+	return tmpl, forEach, nil
+}
+
+// Render proposes a patch for an input that failed with a report. It returns nil if the template renders nothing.
+func (t *RemediationTemplate) Render(input interface{}, report *Report) (*Patch, error) {
+	tmpl, forEach, err := t.compile()
+	if err != nil {
+		return nil, err
+	}
+	object, err := jsonForm(input)
+	if err != nil {
+		return nil, err
+	}
+	var rendered []interface{}
+	render := func(data remediationData) error {
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, data); err != nil {
+			return fmt.Errorf("cannot render remediation: %v", err)
+		}
+		var doc interface{}
+		if err := yaml.Unmarshal(out.Bytes(), &doc); err != nil {
+			return fmt.Errorf("remediation is not valid YAML: %v", err)
+		}
+		if doc != nil {
+			rendered = append(rendered, doc)
+		}
+		return nil
+	}
+	if forEach == nil {
+		err = render(remediationData{Object: object})
+	} else {
+		list, listPath := object, ""
+		for _, segment := range forEach {
+			fields, _ := list.(map[string]interface{})
+			list, listPath = fields[segment.name], formatKey(listPath, segment.name)
+		}
+		items, _ := list.([]interface{})
+		for i, item := range items {
+			if blamed(report, fmt.Sprintf("%s[%d]", listPath, i)) {
+				if err = render(remediationData{Object: object, Item: item, Index: i}); err != nil {
+					break
+				}
+			}
+		}
+	}
+	if err != nil || len(rendered) == 0 {
+		return nil, err
+	}
+	if t.Type == JSON_PATCH {
+		return jsonPatch(rendered)
+	}
+	return strategicMergePatch(rendered)
+}
+
+// jsonForm converts an input to the maps, lists and scalars of its JSON form.
+func jsonForm(input interface{}) (interface{}, error) {
+	switch u := input.(type) {
+	case *unstructured.Unstructured:
+		input = u.Object
+	case unstructured.Unstructured:
+		input = u.Object
+	}
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode input: %v", err)
+	}
+	var object interface{}
+	if err := json.Unmarshal(encoded, &object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
+
+// blamed reports whether any violation was found at or below a path.
+func blamed(report *Report, path string) bool {
+	for _, v := range report.Violations {
+		if v.Path == path || strings.HasPrefix(v.Path, path+".") || strings.HasPrefix(v.Path, path+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonPatch(rendered []interface{}) (*Patch, error) {
+	var operations []patchOperation
+	for _, doc := range rendered {
+		encoded, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		var ops []patchOperation
+		if err := json.Unmarshal(encoded, &ops); err != nil {
+			return nil, fmt.Errorf("remediation is not a list of JSON patch operations: %s", encoded)
+		}
+		for _, op := range ops {
+			if err := op.validate(); err != nil {
+				return nil, err
+			}
+		}
+		operations = append(operations, ops...)
+	}
+	data, err := json.Marshal(operations)
+	if err != nil {
+		return nil, err
+	}
+	return &Patch{Type: JSON_PATCH, Data: data}, nil
+}
+
+// validate checks an operation against RFC 6902: its kind must be known, its paths must be JSON pointers, and it must
+// have the value or source its kind requires.
+func (op *patchOperation) validate() error {
+	member, ok := patchOperationMembers[op.Op]
+	if !ok {
+		return fmt.Errorf("unknown JSON patch operation %s", strconv.Quote(op.Op))
+	}
+	if !isJSONPointer(op.Path) {
+		return fmt.Errorf("JSON patch path %s is not a JSON pointer", strconv.Quote(op.Path))
+	}
+	switch {
+	case member == "value" && len(op.Value) == 0:
+		return fmt.Errorf("JSON patch operation %s of %s has no value", op.Op, op.Path)
+	case member == "from" && op.From == nil:
+		return fmt.Errorf("JSON patch operation %s to %s has no from", op.Op, op.Path)
+	case member == "from" && !isJSONPointer(*op.From):
+		return fmt.Errorf("JSON patch from %s is not a JSON pointer", strconv.Quote(*op.From))
+	}
+	return nil
+}
+
+// isJSONPointer reports whether a path is an RFC 6901 JSON pointer. The empty pointer refers to the whole document.
+func isJSONPointer(path string) bool {
+	return path == "" || strings.HasPrefix(path, "/")
+}
+
+func strategicMergePatch(rendered []interface{}) (*Patch, error) {
+	var merged interface{}
+	for _, doc := range rendered {
+		if _, ok := doc.(map[string]interface{}); !ok {
+			return nil, fmt.Errorf("remediation is not a strategic-merge patch object")
+		}
+		merged = mergePatches(merged, doc)
+	}
+	data, err := json.Marshal(merged)
+	if err != nil {
+		return nil, err
+	}
+	return &Patch{Type: STRATEGIC_MERGE_PATCH, Data: data}, nil
+}
+
+// mergePatches combines two partial objects, merging objects and concatenating lists. Scalars from the second win.
+func mergePatches(a, b interface{}) interface{} {
+	switch bv := b.(type) {
+	case map[string]interface{}:
+		av, ok := a.(map[string]interface{})
+		if !ok {
+			return bv
+		}
+		for key, value := range bv {
+			av[key] = mergePatches(av[key], value)
+		}
+		return av
+	case []interface{}:
+		if av, ok := a.([]interface{}); ok {
+			return append(av, bv...)
+		}
+		return bv
+	default:
+		return b
+	}
+}
@@ -0,0 +1,167 @@
+package predicates
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+)
+
+// applyAdds applies the add operations of a JSON patch to a pod, which is all the fixes under test use.
+func applyAdds(t *testing.T, pod *v1.Pod, patch *Patch) *v1.Pod {
+	object, err := jsonForm(pod)
+	require.NoError(t, err)
+	var ops []patchOperation
+	require.NoError(t, json.Unmarshal(patch.Data, &ops))
+	for _, op := range ops {
+		require.Equal(t, "add", op.Op)
+		steps := strings.Split(op.Path, "/")[1:]
+		parent := object
+		for _, step := range steps[:len(steps)-1] {
+			if i, err := strconv.Atoi(step); err == nil {
+				parent = parent.([]interface{})[i]
+			} else {
+				parent = parent.(map[string]interface{})[step]
+			}
+		}
+		var value interface{}
+		require.NoError(t, json.Unmarshal(op.Value, &value))
+		parent.(map[string]interface{})[steps[len(steps)-1]] = value
+	}
+	encoded, err := json.Marshal(object)
+	require.NoError(t, err)
+	patched := &v1.Pod{}
+	require.NoError(t, json.Unmarshal(encoded, patched))
+	return patched
+}
+
+func TestLivenessProbeRemediation(t *testing.T) {
+	probe := &v1.Probe{
+		Handler:             v1.Handler{Exec: &v1.ExecAction{Command: []string{"true"}}},
+		InitialDelaySeconds: 5,
+		PeriodSeconds:       5,
+	}
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{
+		{Name: "ok", LivenessProbe: probe},
+		{Name: "web", Ports: []v1.ContainerPort{{ContainerPort: 10250}, {ContainerPort: 8080}, {ContainerPort: 9090}}},
+	}}}
+	err := HasLivenessProbe(pod)
+	require.Error(t, err)
+	patch, err := LivenessProbePolicy.Remediate(pod, err)
+	require.NoError(t, err)
+	require.NotNil(t, patch)
+	assert.Equal(t, JSON_PATCH, patch.Type)
+	assert.JSONEq(t, `[{"op": "add", "path": "/spec/containers/1/livenessProbe",
+		"value": {"tcpSocket": {"port": 8080}, "initialDelaySeconds": 10, "periodSeconds": 10}}]`, string(patch.Data))
+	assert.NoError(t, HasLivenessProbe(applyAdds(t, pod, patch)))
+
+	// A probe that is there but misconfigured is not replaced.
+	pod.Spec.Containers[0].LivenessProbe = &v1.Probe{Handler: v1.Handler{Exec: &v1.ExecAction{}}}
+	patch, err = LivenessProbePolicy.Remediate(pod, HasLivenessProbe(pod))
+	require.NoError(t, err)
+	assert.JSONEq(t, `[{"op": "add", "path": "/spec/containers/1/livenessProbe",
+		"value": {"tcpSocket": {"port": 8080}, "initialDelaySeconds": 10, "periodSeconds": 10}}]`, string(patch.Data))
+	pod.Spec.Containers[0].LivenessProbe = probe
+
+	// Without a port that PortValidator accepts there is nothing to probe.
+	pod.Spec.Containers[1].Ports = []v1.ContainerPort{{ContainerPort: 10250}}
+	patch, err = LivenessProbePolicy.Remediate(pod, HasLivenessProbe(pod))
+	assert.NoError(t, err)
+	assert.Nil(t, patch)
+	pod.Spec.Containers[1].Ports = nil
+	patch, err = LivenessProbePolicy.Remediate(pod, HasLivenessProbe(pod))
+	assert.NoError(t, err)
+	assert.Nil(t, patch)
+
+	patch, err = LivenessProbePolicy.Remediate(pod, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, patch)
+}
+
+const runAsNonRootPolicy = `
+name: run-as-non-root
+severity: error
+predicate:
+  field: {path: spec.securityContext.runAsNonRoot, predicate: {value: {type: boolean, value: "true"}}}
+fix:
+  type: strategic-merge
+  patch: '{spec: {securityContext: {runAsNonRoot: true}}}'
+`
+
+func TestStrategicMergeRemediation(t *testing.T) {
+	policy, err := ParsePolicy([]byte(runAsNonRootPolicy))
+	require.NoError(t, err)
+	pred, err := BuildPolicy(NewPredicateFactory(v1.Pod{}), policy)
+	require.NoError(t, err)
+	pod := &v1.Pod{}
+	patch, err := policy.Remediate(pod, pred(pod))
+	require.NoError(t, err)
+	assert.Equal(t, STRATEGIC_MERGE_PATCH, patch.Type)
+	assert.JSONEq(t, `{"spec": {"securityContext": {"runAsNonRoot": true}}}`, string(patch.Data))
+
+	// Patches rendered for several elements are merged.
+	fix := &RemediationTemplate{
+		Type:    STRATEGIC_MERGE_PATCH,
+		ForEach: "spec.containers",
+		Patch:   `{spec: {containers: [{name: {{ json .Item.name }}, securityContext: {allowPrivilegeEscalation: false}}]}}`,
+	}
+	report := &Report{Violations: []*Violation{
+		{Path: "spec.containers[0].securityContext"},
+		{Path: "spec.containers[2].securityContext.allowPrivilegeEscalation"},
+	}}
+	pod.Spec.Containers = []v1.Container{{Name: "a"}, {Name: "b"}, {Name: "c"}}
+	patch, err = fix.Render(pod, report)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"spec": {"containers": [
+		{"name": "a", "securityContext": {"allowPrivilegeEscalation": false}},
+		{"name": "c", "securityContext": {"allowPrivilegeEscalation": false}}]}}`, string(patch.Data))
+}
+
+func TestJSONPatchOperations(t *testing.T) {
+	// Null values are kept, and each operation keeps the members it was rendered with.
+	fix := &RemediationTemplate{Type: JSON_PATCH, Patch: `[
+		{op: add, path: /metadata/annotations, value: null},
+		{op: replace, path: /spec/hostname, value: ""},
+		{op: test, path: /spec/priority, value: 0},
+		{op: remove, path: /spec/nodeName},
+		{op: move, path: /spec/subdomain, from: /spec/hostname},
+		{op: copy, path: /metadata/labels, from: ""}]`}
+	patch, err := fix.Render(&v1.Pod{}, &Report{Violations: []*Violation{{Path: ""}}})
+	require.NoError(t, err)
+	assert.JSONEq(t, `[
+		{"op": "add", "path": "/metadata/annotations", "value": null},
+		{"op": "replace", "path": "/spec/hostname", "value": ""},
+		{"op": "test", "path": "/spec/priority", "value": 0},
+		{"op": "remove", "path": "/spec/nodeName"},
+		{"op": "move", "path": "/spec/subdomain", "from": "/spec/hostname"},
+		{"op": "copy", "path": "/metadata/labels", "from": ""}]`, string(patch.Data))
+}
+
+func TestRemediationErrors(t *testing.T) {
+	_, err := ParsePolicy([]byte(`{name: p, severity: info, predicate: {value: {type: string, value: x}},
+		fix: {type: json, patch: "{{ .Object"}}`))
+	assert.Error(t, err)
+	_, err = ParsePolicy([]byte(`{name: p, severity: info, predicate: {value: {type: string, value: x}},
+		fix: {type: xml, patch: ""}}`))
+	assert.Error(t, err)
+
+	report := &Report{Violations: []*Violation{{Path: ""}}}
+	for _, fix := range []*RemediationTemplate{
+		{Type: JSON_PATCH, Patch: `[{op: upsert, path: /spec}]`},
+		{Type: JSON_PATCH, Patch: `[{op: add, path: spec, value: {}}]`},
+		{Type: JSON_PATCH, Patch: `{op: add, path: /spec}`},
+		{Type: JSON_PATCH, Patch: `[{op: add, path: /spec}]`},
+		{Type: JSON_PATCH, Patch: `[{op: test, path: /spec}]`},
+		{Type: JSON_PATCH, Patch: `[{op: move, path: /spec}]`},
+		{Type: JSON_PATCH, Patch: `[{op: copy, path: /spec, from: metadata}]`},
+		{Type: STRATEGIC_MERGE_PATCH, Patch: `[spec]`},
+		{Type: STRATEGIC_MERGE_PATCH, Patch: `{spec: [}`},
+	} {
+		_, err := fix.Render(&v1.Pod{}, report)
+		assert.Error(t, err, fix.Patch)
+	}
+}
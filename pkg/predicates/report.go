@@ -0,0 +1,181 @@
+package predicates
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Violation describes a single leaf of a predicate that did not hold for an input.
+type Violation struct {
+	// Path is the resolved field path of the offending value, e.g. spec.containers[1].livenessProbe.httpGet.port.
+	Path string `json:"path"`
+	// Expected describes the constraint the value had to satisfy.
+	Expected string `json:"expected"`
+	// Actual is the value found at Path.
+	Actual string `json:"actual"`
+	// Branch lists the And/Or branches taken to reach the leaf, e.g. and[0].or[2].
+	Branch string `json:"branch,omitempty"`
+}
+
+func (v *Violation) String() string {
+	path := v.Path
+	if path == "" {
+		path = "<root>"
+	}
+	if v.Branch == "" {
+		return fmt.Sprintf("%s: expected %s, got %s", path, v.Expected, v.Actual)
+	}
+	return fmt.Sprintf("%s: expected %s, got %s (branch %s)", path, v.Expected, v.Actual, v.Branch)
+}
+
+// Report is the error returned by a Predicate when an input does not satisfy it. It lists every failing leaf, and the
+// policy that was violated when the predicate was built by BuildPolicy.
+type Report struct {
+	Policy     *PolicyMetadata `json:"policy,omitempty"`
+	Violations []*Violation    `json:"violations"`
+}
+
+func (r *Report) Error() string {
+	lines := make([]string, 0, len(r.Violations))
+	for _, v := range r.Violations {
+		lines = append(lines, v.String())
+	}
+	summary := fmt.Sprintf("%d violation(s): %s", len(r.Violations), strings.Join(lines, "; "))
+	if r.Policy == nil {
+		return summary
+	}
+	return fmt.Sprintf("%s policy %s failed with %s", r.Policy.Severity, r.Policy.Name, summary)
+}
+
+// location tracks where in the input, and where in the predicate tree, an evaluation currently is.
+type location struct {
+	path   string
+	branch string
+	// quiet locations are used to decide whether an input passes, without the cost of building paths and violations.
+	quiet bool
+	// root is the input the predicate was applied to.
+	root reflect.Value
+	// trace, if set, is the trace of the node being evaluated, which nodes evaluated from it are added to.
+	trace *Trace
+}
+
+// quietViolations is returned in place of the violations found at a quiet location.
+var quietViolations = []*Violation{{Expected: "<quiet>"}}
+
+func (l location) field(step string) location {
+	if l.quiet {
+		return l
+	}
+	if l.path == "" {
+		l.path = step
+	} else {
+		l.path = fmt.Sprintf("%s.%s", l.path, step)
+	}
+	return l
+}
+
+// key extends the path with a map key, written after a dot or in brackets.
+func (l location) key(name string) location {
+	if l.quiet {
+		return l
+	}
+	l.path = formatKey(l.path, name)
+	return l
+}
+
+func (l location) index(key interface{}) location {
+	if l.quiet {
+		return l
+	}
+	l.path = fmt.Sprintf("%s[%v]", l.path, key)
+	return l
+}
+
+func (l location) and(i int) location {
+	if l.quiet {
+		return l
+	}
+	return l.enter(fmt.Sprintf("and[%d]", i))
+}
+
+func (l location) or(i int) location {
+	if l.quiet {
+		return l
+	}
+	return l.enter(fmt.Sprintf("or[%d]", i))
+}
+
+func (l location) enter(branch string) location {
+	if l.quiet {
+		return l
+	}
+	if l.branch == "" {
+		l.branch = branch
+	} else {
+		l.branch = fmt.Sprintf("%s.%s", l.branch, branch)
+	}
+	return l
+}
+
+func (l location) violation(expected string, actual reflect.Value) *Violation {
+	if l.quiet {
+		return quietViolations[0]
+	}
+	return &Violation{
+		Path:     l.path,
+		Expected: expected,
+		Actual:   formatValue(actual),
+		Branch:   l.branch,
+	}
+}
+
+// maxFormattedLength bounds how much of a composite value is included in a violation.
+const maxFormattedLength = 200
+
+// formatValue renders a reflected value for display in a violation.
+func formatValue(v reflect.Value) string {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return "<nil>"
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return "<unset>"
+	}
+	if !v.CanInterface() {
+		return v.String()
+	}
+	if (v.Kind() == reflect.Map || v.Kind() == reflect.Slice) && v.IsNil() {
+		return "<nil>"
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return fmt.Sprintf("%q", v.String())
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		if encoded, err := json.Marshal(v.Interface()); err == nil {
+			// Types serialized as strings, such as resource.Quantity and metav1.Time, are shown unquoted.
+			var str string
+			if json.Unmarshal(encoded, &str) == nil {
+				return str
+			}
+			return truncate(string(encoded), maxFormattedLength)
+		}
+	}
+	// Many API types, such as intstr.IntOrString, only implement fmt.Stringer on their pointer.
+	ptr := reflect.New(v.Type())
+	ptr.Elem().Set(v)
+	if stringer, ok := ptr.Interface().(fmt.Stringer); ok {
+		return stringer.String()
+	}
+	return fmt.Sprintf("%v", v.Interface())
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
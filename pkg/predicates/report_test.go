@@ -0,0 +1,48 @@
+package predicates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestReport(t *testing.T) {
+	pred, err := NewPredicateFactory(v1.Pod{}).Build(Field("spec", Conjunction(
+		Field("hostname", StringValue("==a")),
+		Disjunction(Field("priority", NumberValue(">=5")), Exists("nodeName")),
+		Field("containers.name", StringValue("==app")),
+	)))
+	require.NoError(t, err)
+	priority := int32(1)
+	pod := &v1.Pod{Spec: v1.PodSpec{
+		Hostname:   "b",
+		Priority:   &priority,
+		Containers: []v1.Container{{Name: "app"}, {Name: "sidecar"}},
+	}}
+
+	// Every failing child of the And is reported, along with every branch of the Or that holds for none.
+	err = pred(pod)
+	require.IsType(t, &Report{}, err)
+	assert.Equal(t, []*Violation{
+		{Path: "spec.hostname", Expected: "equal to `a`", Actual: `"b"`, Branch: "and[0]"},
+		{Path: "spec.priority", Expected: "number >= 5", Actual: "1", Branch: "and[1].or[0]"},
+		{Path: "spec.nodeName", Expected: "set", Actual: `""`, Branch: "and[1].or[1]"},
+		{Path: "spec.containers[1].name", Expected: "equal to `app`", Actual: `"sidecar"`, Branch: "and[2]"},
+	}, err.(*Report).Violations)
+	assert.Equal(t, "4 violation(s): "+
+		"spec.hostname: expected equal to `a`, got \"b\" (branch and[0]); "+
+		"spec.priority: expected number >= 5, got 1 (branch and[1].or[0]); "+
+		"spec.nodeName: expected set, got \"\" (branch and[1].or[1]); "+
+		"spec.containers[1].name: expected equal to `app`, got \"sidecar\" (branch and[2])", err.Error())
+
+	pod.Spec.Hostname, pod.Spec.NodeName, pod.Spec.Containers = "a", "node-1", pod.Spec.Containers[:1]
+	assert.NoError(t, pred(pod))
+}
+
+func TestViolationString(t *testing.T) {
+	assert.Equal(t, "<root>: expected set, got <nil>", (&Violation{Expected: "set", Actual: "<nil>"}).String())
+	assert.Equal(t, "spec.hostPID: expected boolean == false, got true (branch and[1])",
+		(&Violation{Path: "spec.hostPID", Expected: "boolean == false", Actual: "true", Branch: "and[1]"}).String())
+}
@@ -0,0 +1,215 @@
+package predicates
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// OpenAPISchema is the subset of an OpenAPI v3 schema, as found in a CustomResourceDefinition's openAPIV3Schema, that
+// is needed to resolve field paths and read values.
+type OpenAPISchema struct {
+	Type                 string                    `json:"type,omitempty" yaml:"type,omitempty"`
+	Format               string                    `json:"format,omitempty" yaml:"format,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty" yaml:"properties,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty" yaml:"items,omitempty"`
+	AdditionalProperties *OpenAPISchema            `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
+
+	IntOrString           bool `json:"x-kubernetes-int-or-string,omitempty" yaml:"x-kubernetes-int-or-string,omitempty"`
+	PreserveUnknownFields bool `json:"x-kubernetes-preserve-unknown-fields,omitempty" yaml:"x-kubernetes-preserve-unknown-fields,omitempty"`
+	EmbeddedResource      bool `json:"x-kubernetes-embedded-resource,omitempty" yaml:"x-kubernetes-embedded-resource,omitempty"`
+}
+
+// UnmarshalYAML reads a schema, also accepting the boolean form of additionalProperties.
+func (s *OpenAPISchema) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!bool" {
+		// `additionalProperties: true` or `false` is read as a schema allowing any value.
+		*s = OpenAPISchema{}
+		return nil
+	}
+	type plain OpenAPISchema
+	return node.Decode((*plain)(s))
+}
+
+// ParseOpenAPISchema reads an OpenAPI v3 schema from a JSON or YAML document.
+func ParseOpenAPISchema(data []byte) (*OpenAPISchema, error) {
+	schema := &OpenAPISchema{}
+	if err := yaml.Unmarshal(data, schema); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// crdDocument is the part of a CustomResourceDefinition, in either apiextensions.k8s.io/v1 or v1beta1, that holds its
+// schemas.
+type crdDocument struct {
+	Kind string `yaml:"kind"`
+	Spec struct {
+		Validation *crdValidation `yaml:"validation"`
+		Versions   []struct {
+			Name    string         `yaml:"name"`
+			Storage bool           `yaml:"storage"`
+			Schema  *crdValidation `yaml:"schema"`
+		} `yaml:"versions"`
+	} `yaml:"spec"`
+}
+
+type crdValidation struct {
+	OpenAPIV3Schema *OpenAPISchema `yaml:"openAPIV3Schema"`
+}
+
+// ParseCRDSchema reads the openAPIV3Schema of one version of a CustomResourceDefinition from a JSON or YAML document.
+// An empty version selects the storage version.
+func ParseCRDSchema(data []byte, version string) (*OpenAPISchema, error) {
+	crd := &crdDocument{}
+	if err := yaml.Unmarshal(data, crd); err != nil {
+		return nil, err
+	}
+	if crd.Kind != "CustomResourceDefinition" {
+		return nil, fmt.Errorf("expected a CustomResourceDefinition, found kind %q", crd.Kind)
+	}
+	for _, v := range crd.Spec.Versions {
+		if v.Name == version || (version == "" && v.Storage) {
+			if v.Schema != nil && v.Schema.OpenAPIV3Schema != nil {
+				return v.Schema.OpenAPIV3Schema, nil
+			}
+			if crd.Spec.Validation != nil && crd.Spec.Validation.OpenAPIV3Schema != nil {
+				// apiextensions.k8s.io/v1beta1 may share one schema between all versions.
+				return crd.Spec.Validation.OpenAPIV3Schema, nil
+			}
+			return nil, fmt.Errorf("version %q has no openAPIV3Schema", v.Name)
+		}
+	}
+	if version == "" && crd.Spec.Validation != nil && crd.Spec.Validation.OpenAPIV3Schema != nil {
+		return crd.Spec.Validation.OpenAPIV3Schema, nil
+	}
+	return nil, fmt.Errorf("no schema for version %q", version)
+}
+
+// NewSchemaPredicateFactory creates a factory for objects described by an OpenAPI v3 schema rather than a Go type,
+// such as custom resources. Paths are checked against the schema when predicates are built. The predicates accept
+// map[string]interface{} and unstructured.Unstructured values, or anything else that encodes to JSON matching the
+// schema.
+func NewSchemaPredicateFactory(schema *OpenAPISchema, opts ...FactoryOption) PredicateFactory {
+	t := schemaType(schema, true)
+	pf := &predicateFactoryImpl{
+		example: reflect.Zero(t).Interface(),
+		clock:   time.Now,
+		convert: func(input interface{}) (reflect.Value, error) {
+			return decodeSchemaValue(input, t)
+		},
+	}
+	for _, opt := range opts {
+		opt(pf)
+	}
+	return pf
+}
+
+var (
+	stringPtrType      = reflect.TypeOf((*string)(nil))
+	int64PtrType       = reflect.TypeOf((*int64)(nil))
+	float64PtrType     = reflect.TypeOf((*float64)(nil))
+	boolPtrType        = reflect.TypeOf((*bool)(nil))
+	timePtrType        = reflect.TypeOf((*metav1.Time)(nil))
+	intOrStringPtrType = reflect.TypeOf((*intstr.IntOrString)(nil))
+	objectMetaPtrType  = reflect.TypeOf((*metav1.ObjectMeta)(nil))
+	anyType            = reflect.TypeOf((*interface{})(nil)).Elem()
+	anyMapType         = reflect.TypeOf(map[string]interface{}{})
+)
+
+// schemaType builds a Go type that the JSON form of values matching the schema decodes into. Scalars and objects are
+// pointers, so that unset fields can be told apart from zero values. Resources, at the root or embedded, have their
+// metadata typed as metav1.ObjectMeta.
+func schemaType(schema *OpenAPISchema, resource bool) reflect.Type {
+	if schema == nil {
+		return anyType
+	}
+	if schema.IntOrString {
+		return intOrStringPtrType
+	}
+	switch schema.Type {
+	case "string":
+		if schema.Format == "date-time" {
+			return timePtrType
+		}
+		return stringPtrType
+	case "integer":
+		return int64PtrType
+	case "number":
+		return float64PtrType
+	case "boolean":
+		return boolPtrType
+	case "array":
+		return reflect.SliceOf(schemaType(schema.Items, false))
+	case "object", "":
+		resource = resource || schema.EmbeddedResource
+		if len(schema.Properties) != 0 || resource {
+			return reflect.PtrTo(schemaStructType(schema, resource))
+		}
+		if schema.AdditionalProperties != nil {
+			return reflect.MapOf(reflect.TypeOf(""), schemaType(schema.AdditionalProperties, false))
+		}
+		if schema.Type == "" && !schema.PreserveUnknownFields {
+			return anyType
+		}
+		return anyMapType
+	default:
+		return anyType
+	}
+}
+
+func schemaStructType(schema *OpenAPISchema, resource bool) reflect.Type {
+	properties := map[string]reflect.Type{}
+	for name, property := range schema.Properties {
+		properties[name] = schemaType(property, false)
+	}
+	if resource {
+		properties["apiVersion"] = stringPtrType
+		properties["kind"] = stringPtrType
+		properties["metadata"] = objectMetaPtrType
+	}
+	names := make([]string, 0, len(properties))
+	for name := range properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fields := make([]reflect.StructField, 0, len(names))
+	for i, name := range names {
+		fields = append(fields, reflect.StructField{
+			Name: fmt.Sprintf("Field%d", i),
+			Type: properties[name],
+			Tag:  reflect.StructTag(fmt.Sprintf(`json:"%s,omitempty"`, name)),
+		})
+	}
+	return reflect.StructOf(fields)
+}
+
+// decodeSchemaValue converts an input to the type built from a schema, through its JSON form.
+func decodeSchemaValue(input interface{}, t reflect.Type) (reflect.Value, error) {
+	switch u := input.(type) {
+	case *unstructured.Unstructured:
+		input = u.Object
+	case unstructured.Unstructured:
+		input = u.Object
+	}
+	encoded, err := json.Marshal(input)
+	if err != nil {
+		return reflect.Value{}, fmt.Errorf("cannot encode input: %v", err)
+	}
+	value := reflect.New(t)
+	if err := json.Unmarshal(encoded, value.Interface()); err != nil {
+		if typeErr, ok := err.(*json.UnmarshalTypeError); ok {
+			return reflect.Value{}, fmt.Errorf("input does not match schema: expected %s at path %s, got %s",
+				typeName(typeErr.Type), displayPath(typeErr.Field), typeErr.Value)
+		}
+		return reflect.Value{}, fmt.Errorf("input does not match schema: %v", err)
+	}
+	return value.Elem(), nil
+}
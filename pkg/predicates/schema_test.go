@@ -0,0 +1,109 @@
+package predicates
+
+import (
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func certificateFactory(t *testing.T) PredicateFactory {
+	data, err := ioutil.ReadFile("testdata/certificate-crd.yaml")
+	require.NoError(t, err)
+	schema, err := ParseCRDSchema(data, "")
+	require.NoError(t, err)
+	return NewSchemaPredicateFactory(schema)
+}
+
+func certificate() map[string]interface{} {
+	return map[string]interface{}{
+		"apiVersion": "cert-manager.io/v1",
+		"kind":       "Certificate",
+		"metadata": map[string]interface{}{
+			"name":   "web",
+			"labels": map[string]interface{}{"team": "payments"},
+		},
+		"spec": map[string]interface{}{
+			"secretName":  "web-tls",
+			"dnsNames":    []interface{}{"example.com", "www.example.com"},
+			"duration":    "2160h",
+			"privateKey":  map[string]interface{}{"algorithm": "ECDSA", "size": 256},
+			"issuerRef":   map[string]interface{}{"name": "letsencrypt", "kind": "ClusterIssuer"},
+			"renewBefore": "360h",
+		},
+		"status": map[string]interface{}{"notAfter": "2020-06-01T00:00:00Z"},
+	}
+}
+
+func TestSchemaPredicates(t *testing.T) {
+	pf := certificateFactory(t)
+	for expression, pass := range map[string]bool{
+		`spec.privateKey.algorithm == "ECDSA" and spec.privateKey.size >= 256`: true,
+		`spec.privateKey.size >= 384`:                                          false,
+		`all(spec.dnsNames, @ matches "example\.com$")`:                        true,
+		`spec.duration <= duration("2160h")`:                                   true,
+		`spec.isCA missing`:                                                    true,
+		`spec.isCA == false`:                                                   false,
+		`metadata.labels["team"] exists`:                                       true,
+		`spec.secretTemplate.labels missing`:                                   true,
+		`status.notAfter > datetime("2020-01-01T00:00:00Z")`:                   true,
+		`spec.issuerRef.kind == "Issuer"`:                                      false,
+	} {
+		d, err := ParseExpression(expression)
+		require.NoError(t, err, expression)
+		pred, err := pf.Build(d)
+		if !assert.NoError(t, err, expression) {
+			continue
+		}
+		for _, input := range []interface{}{certificate(), &unstructured.Unstructured{Object: certificate()}} {
+			err = pred(input)
+			assert.Equal(t, pass, err == nil, "%s: %v", expression, err)
+		}
+	}
+}
+
+func TestSchemaPathErrors(t *testing.T) {
+	pf := certificateFactory(t)
+	_, err := pf.Build(Field("spec.secretNme", StringValue("")))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `did you mean "secretName"?`)
+	}
+	_, err = pf.Build(Field("spec.issuerRef.name.first", StringValue("")))
+	assert.Error(t, err)
+	_, err = pf.Build(Field("status.conditions", StringValue("")))
+	assert.Error(t, err)
+}
+
+// A predicate may be called from several goroutines at once, including with inputs that fail to convert. Run with
+// -race to check that calls share no state.
+func TestSchemaPredicateConcurrentCalls(t *testing.T) {
+	pred, err := certificateFactory(t).Build(Field("spec.privateKey.size", NumberValue(">=256")))
+	require.NoError(t, err)
+	invalid := certificate()
+	invalid["spec"].(map[string]interface{})["privateKey"] = map[string]interface{}{"size": "large"}
+
+	var wg sync.WaitGroup
+	errs := make([]error, 64)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%2 == 0 {
+				errs[i] = pred(certificate())
+			} else {
+				errs[i] = pred(invalid)
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if i%2 == 0 {
+			assert.NoError(t, err)
+		} else {
+			assert.EqualError(t, err, "input does not match schema: expected int64 at path spec.privateKey.size, got string")
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package predicates
+
+import (
+	"sort"
+	"sync/atomic"
+)
+
+// reorderInterval is how many evaluations of an And or Or pass between reorderings of its children.
+const reorderInterval = 1024
+
+// childOrder measures how often each child of an And or Or fails, and orders the children so that the one most likely
+// to decide the outcome is evaluated first: the most likely to fail for an And, and the most likely to pass for an Or.
+// The order only applies to quiet evaluation, so reports list violations in declaration order regardless.
+type childOrder struct {
+	// evaluations is updated atomically, and must come first to be 64-bit aligned on 32-bit platforms.
+	evaluations uint64
+	failFirst   bool
+	failures    []uint64
+	runs        []uint64
+	order       atomic.Value
+}
+
+func newChildOrder(n int, failFirst bool) *childOrder {
+	o := &childOrder{
+		failFirst: failFirst,
+		failures:  make([]uint64, n),
+		runs:      make([]uint64, n),
+	}
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	o.order.Store(order)
+	return o
+}
+
+// current returns the order to evaluate the children in.
+func (o *childOrder) current() []int {
+	return o.order.Load().([]int)
+}
+
+// record counts the outcome of evaluating a child.
+func (o *childOrder) record(child int, failed bool) {
+	atomic.AddUint64(&o.runs[child], 1)
+	if failed {
+		atomic.AddUint64(&o.failures[child], 1)
+	}
+}
+
+// done counts an evaluation of the parent, and reorders the children periodically.
+func (o *childOrder) done() {
+	if atomic.AddUint64(&o.evaluations, 1)%reorderInterval != 0 {
+		return
+	}
+	n := len(o.runs)
+	rates := make([]float64, n)
+	for i := 0; i < n; i++ {
+		runs, failures := atomic.LoadUint64(&o.runs[i]), atomic.LoadUint64(&o.failures[i])
+		if runs == 0 {
+			// Children that are never reached keep their place behind the measured ones.
+			rates[i] = -1
+			continue
+		}
+		rates[i] = float64(failures) / float64(runs)
+		if !o.failFirst {
+			rates[i] = 1 - rates[i]
+		}
+	}
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return rates[order[a]] > rates[order[b]]
+	})
+	o.order.Store(order)
+}
@@ -0,0 +1,53 @@
+package predicates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestChildOrder(t *testing.T) {
+	order := newChildOrder(3, true)
+	for i := 0; i < reorderInterval; i++ {
+		order.record(0, false)
+		order.record(1, i%2 == 0)
+		order.record(2, true)
+		order.done()
+	}
+	assert.Equal(t, []int{2, 1, 0}, order.current())
+
+	order = newChildOrder(3, false)
+	for i := 0; i < reorderInterval; i++ {
+		order.record(0, true)
+		order.record(1, false)
+		order.done()
+	}
+	assert.Equal(t, []int{1, 0, 2}, order.current())
+}
+
+func TestReportsIgnoreChildOrder(t *testing.T) {
+	pred, err := NewPredicateFactory(v1.Pod{}).Build(LivenessProbeDescriptor)
+	if !assert.NoError(t, err) {
+		return
+	}
+	pods := syntheticPods(16)
+	var first []string
+	for _, pod := range pods {
+		if err := pred(pod); err != nil {
+			first = append(first, err.Error())
+		}
+	}
+	// Enough evaluations for the children to be reordered several times.
+	for round := 0; round < 4*reorderInterval/len(pods); round++ {
+		var reports []string
+		for _, pod := range pods {
+			if err := pred(pod); err != nil {
+				reports = append(reports, err.Error())
+			}
+		}
+		if !assert.Equal(t, first, reports, "round %d", round) {
+			return
+		}
+	}
+}
@@ -0,0 +1,312 @@
+package predicates
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Template is a descriptor with named parameters, which are written as ${name} in its paths, values, references and
+// image constraints. A list parameter used as a whole element of a list, such as the registries of an image
+// constraint, is expanded into its items. Templates are instantiated with a map of parameter values, for example once
+// per namespace or team, without copying the descriptor by hand.
+//
+// In YAML:
+//
+//	parameters:
+//	  - {name: maxPort, type: number, default: 9999}
+//	  - {name: allowedRegistries, type: string, list: true}
+//	predicate:
+//	  and:
+//	    - field: {path: spec.containers.ports.containerPort, predicate: {value: {type: number, value: "<=${maxPort}"}}}
+//	    - field: {path: spec.containers.image, predicate: {image: {registries: ["${allowedRegistries}"]}}}
+type Template struct {
+	Parameters []*TemplateParameter `json:"parameters,omitempty" yaml:"parameters,omitempty"`
+	Descriptor *PredicateDescriptor `json:"predicate" yaml:"predicate"`
+}
+
+// TemplateParameter declares a template parameter. Parameters without a default are required. Values are checked
+// against the type, and against Pattern and Enum when set. List parameters check each of their items.
+type TemplateParameter struct {
+	Name        string      `json:"name" yaml:"name"`
+	Type        FieldType   `json:"type" yaml:"type"`
+	List        bool        `json:"list,omitempty" yaml:"list,omitempty"`
+	Default     interface{} `json:"default,omitempty" yaml:"default,omitempty"`
+	Description string      `json:"description,omitempty" yaml:"description,omitempty"`
+	Pattern     string      `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	Enum        []string    `json:"enum,omitempty" yaml:"enum,omitempty"`
+}
+
+var parameterRegexp = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// hasParameters reports whether a descriptor string refers to template parameters, and so cannot be checked until the
+// template is instantiated.
+func hasParameters(s string) bool {
+	return parameterRegexp.MatchString(s)
+}
+
+// ParseTemplate reads a JSON or YAML template, and checks that its parameters are well formed and that it only refers
+// to declared parameters.
+func ParseTemplate(data []byte) (*Template, error) {
+	t := &Template{}
+	if err := yaml.Unmarshal(data, t); err != nil {
+		return nil, err
+	}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Validate checks the parameter declarations and their defaults, and that the descriptor only refers to declared
+// parameters.
+func (t *Template) Validate() error {
+	if t.Descriptor == nil {
+		return fmt.Errorf("template has no predicate")
+	}
+	declared := map[string]*TemplateParameter{}
+	for _, p := range t.Parameters {
+		if !parameterRegexp.MatchString(fmt.Sprintf("${%s}", p.Name)) {
+			return fmt.Errorf("invalid parameter name %q", p.Name)
+		}
+		if _, ok := declared[p.Name]; ok {
+			return fmt.Errorf("duplicate parameter %q", p.Name)
+		}
+		declared[p.Name] = p
+		if p.Pattern != "" {
+			if _, err := regexp.Compile(p.Pattern); err != nil {
+				return fmt.Errorf("invalid pattern for parameter %q: %v", p.Name, err)
+			}
+		}
+		if p.Default != nil {
+			if _, err := p.values(p.Default); err != nil {
+				return fmt.Errorf("invalid default: %v", err)
+			}
+		}
+	}
+	var undeclared []string
+	substitute(t.Descriptor, func(s string, list bool) ([]string, error) {
+		for _, match := range parameterRegexp.FindAllStringSubmatch(s, -1) {
+			if _, ok := declared[match[1]]; !ok {
+				undeclared = append(undeclared, match[1])
+			}
+		}
+		return []string{s}, nil
+	})
+	if len(undeclared) != 0 {
+		return fmt.Errorf("undeclared parameter(s) %s", strings.Join(undeclared, ", "))
+	}
+	return nil
+}
+
+// Instantiate fills in the template's parameters from a map, using defaults for the ones left out, and returns the
+// resulting descriptor. Values may be strings, numbers or booleans, or lists of them for list parameters, as decoded
+// from JSON or YAML.
+func (t *Template) Instantiate(params map[string]interface{}) (*PredicateDescriptor, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	values := map[string][]string{}
+	lists := map[string]bool{}
+	for _, p := range t.Parameters {
+		value, ok := params[p.Name]
+		if !ok {
+			if p.Default == nil {
+				return nil, fmt.Errorf("missing value for required parameter %q", p.Name)
+			}
+			value = p.Default
+		}
+		v, err := p.values(value)
+		if err != nil {
+			return nil, err
+		}
+		values[p.Name], lists[p.Name] = v, p.List
+	}
+	var unknown []string
+	for name := range params {
+		if _, ok := values[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) != 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown parameter(s) %s", strings.Join(unknown, ", "))
+	}
+	return substitute(t.Descriptor, func(s string, list bool) ([]string, error) {
+		if match := parameterRegexp.FindStringSubmatch(s); list && match != nil && match[0] == s && lists[match[1]] {
+			return values[match[1]], nil
+		}
+		var err error
+		replaced := parameterRegexp.ReplaceAllStringFunc(s, func(ref string) string {
+			name := parameterRegexp.FindStringSubmatch(ref)[1]
+			if lists[name] {
+				err = fmt.Errorf("list parameter %q can only be used as a whole list element, found in %q", name, s)
+				return ref
+			}
+			return values[name][0]
+		})
+		return []string{replaced}, err
+	})
+}
+
+// values converts a parameter value to strings, and validates them.
+func (p *TemplateParameter) values(value interface{}) ([]string, error) {
+	var items []interface{}
+	if p.List {
+		list, ok := value.([]interface{})
+		if strs, isStrings := value.([]string); isStrings {
+			list, ok = make([]interface{}, 0, len(strs)), true
+			for _, s := range strs {
+				list = append(list, s)
+			}
+		}
+		if !ok {
+			return nil, fmt.Errorf("parameter %q expects a list, got %v", p.Name, value)
+		}
+		items = list
+	} else {
+		items = []interface{}{value}
+	}
+	strs := make([]string, 0, len(items))
+	for _, item := range items {
+		s, err := p.value(item)
+		if err != nil {
+			return nil, err
+		}
+		strs = append(strs, s)
+	}
+	return strs, nil
+}
+
+func (p *TemplateParameter) value(value interface{}) (string, error) {
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	case bool:
+		s = strconv.FormatBool(v)
+	case int:
+		s = strconv.Itoa(v)
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return "", fmt.Errorf("parameter %q expects a %s, got %v", p.Name, p.Type, value)
+	}
+	if _, err := parseValueMatcher(p.Type, opEqual+s, time.Now); err != nil {
+		return "", fmt.Errorf("parameter %q expects a %s, got %q", p.Name, p.Type, s)
+	}
+	if p.Pattern != "" {
+		if matched, _ := regexp.MatchString(p.Pattern, s); !matched {
+			return "", fmt.Errorf("parameter %q must match `%s`, got %q", p.Name, p.Pattern, s)
+		}
+	}
+	if len(p.Enum) != 0 {
+		allowed := false
+		for _, e := range p.Enum {
+			allowed = allowed || e == s
+		}
+		if !allowed {
+			return "", fmt.Errorf("parameter %q must be one of %s, got %q", p.Name, strings.Join(p.Enum, ", "), s)
+		}
+	}
+	return s, nil
+}
+
+// substituter rewrites one string of a descriptor. Strings that are elements of a list may be replaced by several.
+type substituter func(s string, list bool) ([]string, error)
+
+// substitute copies a descriptor, rewriting each of its strings.
+func substitute(d *PredicateDescriptor, sub substituter) (*PredicateDescriptor, error) {
+	if d == nil {
+		return nil, nil
+	}
+	var err error
+	str := func(s string) string {
+		if err != nil || s == "" {
+			return s
+		}
+		var out []string
+		out, err = sub(s, false)
+		if err != nil {
+			return s
+		}
+		return out[0]
+	}
+	strs := func(ss []string) []string {
+		if ss == nil {
+			return nil
+		}
+		out := make([]string, 0, len(ss))
+		for _, s := range ss {
+			if err != nil {
+				return ss
+			}
+			var expanded []string
+			expanded, err = sub(s, true)
+			out = append(out, expanded...)
+		}
+		return out
+	}
+	child := func(c *PredicateDescriptor) *PredicateDescriptor {
+		if err != nil {
+			return c
+		}
+		var out *PredicateDescriptor
+		out, err = substitute(c, sub)
+		return out
+	}
+	children := func(cs []*PredicateDescriptor) []*PredicateDescriptor {
+		if cs == nil {
+			return nil
+		}
+		out := make([]*PredicateDescriptor, 0, len(cs))
+		for _, c := range cs {
+			out = append(out, child(c))
+		}
+		return out
+	}
+
+	out := &PredicateDescriptor{}
+	if d.Field != nil {
+		out.Field = &FieldPathPredicateDescriptor{Path: str(d.Field.Path), Descriptor: child(d.Field.Descriptor)}
+	}
+	if d.Quantifier != nil {
+		q := *d.Quantifier
+		q.Path, q.Descriptor = str(q.Path), child(q.Descriptor)
+		out.Quantifier = &q
+	}
+	if d.Presence != nil {
+		p := *d.Presence
+		p.Path = str(p.Path)
+		out.Presence = &p
+	}
+	out.And, out.Or, out.Negate = children(d.And), children(d.Or), child(d.Negate)
+	if d.Base != nil {
+		b := *d.Base
+		b.Value, b.Reference = str(b.Value), str(b.Reference)
+		out.Base = &b
+	}
+	if d.Image != nil {
+		image := *d.Image
+		image.Registries, image.Repository = strs(image.Registries), str(image.Repository)
+		image.ForbiddenTags, image.TagPattern = strs(image.ForbiddenTags), str(image.TagPattern)
+		out.Image = &image
+	}
+	out.Ref = str(d.Ref)
+	if d.CEL != nil {
+		cel := *d.CEL
+		cel.Rule, cel.Message = str(cel.Rule), str(cel.Message)
+		out.CEL = &cel
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,90 @@
+package predicates
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+)
+
+const registryTemplate = `
+parameters:
+  - name: maxPort
+    type: number
+    default: 9999
+  - name: allowedRegistries
+    type: string
+    list: true
+    pattern: '^[a-z0-9.-]+(:[0-9]+)?$'
+  - name: team
+    type: string
+    enum: [payments, search]
+predicate:
+  and:
+    - quantifier:
+        kind: all
+        path: spec.containers.ports
+        predicate:
+          field: {path: containerPort, predicate: {value: {type: number, value: "<=${maxPort}"}}}
+    - field: {path: spec.containers.image, predicate: {image: {registries: ["${allowedRegistries}"]}}}
+    - field: {path: 'metadata.labels["team"]', predicate: {value: {type: string, value: "==${team}"}}}
+`
+
+func TestTemplate(t *testing.T) {
+	template, err := ParseTemplate([]byte(registryTemplate))
+	require.NoError(t, err)
+	d, err := template.Instantiate(map[string]interface{}{
+		"allowedRegistries": []interface{}{"gcr.io", "quay.io"},
+		"team":              "payments",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "<=9999", d.And[0].Quantifier.Descriptor.Field.Descriptor.Base.Value)
+	assert.Equal(t, []string{"gcr.io", "quay.io"}, d.And[1].Field.Descriptor.Image.Registries)
+	assert.Equal(t, "==payments", d.And[2].Field.Descriptor.Base.Value)
+	// The template itself is left unchanged.
+	assert.Equal(t, "<=${maxPort}", template.Descriptor.And[0].Quantifier.Descriptor.Field.Descriptor.Base.Value)
+
+	pred, err := NewPredicateFactory(v1.Pod{}).Build(d)
+	require.NoError(t, err)
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{
+		Image: "gcr.io/team/app:1.0",
+		Ports: []v1.ContainerPort{{ContainerPort: 8080}},
+	}}}}
+	pod.Labels = map[string]string{"team": "payments"}
+	assert.NoError(t, pred(pod))
+	pod.Spec.Containers[0].Image = "nginx"
+	assert.Error(t, pred(pod))
+}
+
+func TestTemplateErrors(t *testing.T) {
+	template, err := ParseTemplate([]byte(registryTemplate))
+	require.NoError(t, err)
+	for _, params := range []map[string]interface{}{
+		{"allowedRegistries": []interface{}{"gcr.io"}},                                          // team is required
+		{"allowedRegistries": []interface{}{"gcr.io"}, "team": "billing"},                       // not in enum
+		{"allowedRegistries": []interface{}{"gcr.io/x"}, "team": "search"},                      // pattern
+		{"allowedRegistries": "gcr.io", "team": "search"},                                       // not a list
+		{"allowedRegistries": []interface{}{"gcr.io"}, "team": "search", "maxPort": "lots"},     // not a number
+		{"allowedRegistries": []interface{}{"gcr.io"}, "team": "search", "minPort": float64(1)}, // unknown
+	} {
+		_, err := template.Instantiate(params)
+		assert.Error(t, err, "%v", params)
+	}
+
+	_, err = ParseTemplate([]byte(`{predicate: {value: {type: number, value: ">=${undeclared}"}}}`))
+	assert.Error(t, err)
+	_, err = ParseTemplate([]byte(`{parameters: [{name: n, type: number, default: many}], predicate: {value: {type: number, value: ">=${n}"}}}`))
+	assert.Error(t, err)
+	_, err = (&Template{
+		Parameters: []*TemplateParameter{{Name: "names", Type: STRING_FIELD, List: true}},
+		Descriptor: StringValue("==${names}"),
+	}).Instantiate(map[string]interface{}{"names": []string{"a", "b"}})
+	assert.Error(t, err)
+}
+
+func TestPortRangeTemplate(t *testing.T) {
+	d, err := PortRangeTemplate.Instantiate(map[string]interface{}{"minPort": 1024})
+	require.NoError(t, err)
+	assert.Equal(t, Conjunction(NumberValue(">=1024"), NumberValue("<=9999")), d)
+}
@@ -0,0 +1,165 @@
+package predicates
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Trace records the evaluation of a predicate node, and of the nodes it evaluated in turn, to explain an outcome.
+type Trace struct {
+	// Node names the node: and, or, not, the path of a field, the quantifier and its path, or the description of a
+	// leaf such as `livenessProbe exists`.
+	Node string `json:"node"`
+	// Path is the path of the value the node was applied to.
+	Path string `json:"path"`
+	// Value is the value the node was applied to. It is shown at leaves, and where a field step extracted it.
+	Value  string `json:"value,omitempty"`
+	Passed bool   `json:"passed"`
+	// Note tells which branch of an Or held, where a failing And stopped and which of its other branches failed, or
+	// what a failing leaf expected.
+	Note string `json:"note,omitempty"`
+	// ReportOnly marks the branches of an And after the first that failed. An untraced predicate stops at that branch
+	// when deciding the outcome, and only evaluates the later ones to report their violations.
+	ReportOnly bool     `json:"reportOnly,omitempty"`
+	Children   []*Trace `json:"children,omitempty"`
+}
+
+// String renders the trace as indented text, one node per line.
+func (t *Trace) String() string {
+	var b strings.Builder
+	t.write(&b, 0)
+	return b.String()
+}
+
+func (t *Trace) write(b *strings.Builder, depth int) {
+	outcome := "PASS"
+	if !t.Passed {
+		outcome = "FAIL"
+	}
+	fmt.Fprintf(b, "%s%s %s at %s", strings.Repeat("  ", depth), outcome, t.Node, displayPath(t.Path))
+	if t.Value != "" {
+		fmt.Fprintf(b, " = %s", t.Value)
+	}
+	if t.Note != "" {
+		fmt.Fprintf(b, " (%s)", t.Note)
+	}
+	if t.ReportOnly {
+		b.WriteString(" [report only]")
+	}
+	b.WriteString("\n")
+	for _, child := range t.Children {
+		child.write(b, depth+1)
+	}
+}
+
+// WithTrace makes predicates record a trace of each evaluation, and pass it to record. Traced predicates evaluate
+// every node in declaration order and always build their violations, so they are slower; use them to debug a
+// descriptor, not to check many objects. The trace of a failing And shows the branch an untraced evaluation in
+// declaration order stops at, and marks the later branches as evaluated for the report only.
+func WithTrace(record func(*Trace)) FactoryOption {
+	return func(pf *predicateFactoryImpl) {
+		pf.trace = record
+	}
+}
+
+// Explain evaluates a descriptor against an input, and returns the trace of the evaluation along with its outcome.
+func Explain(example interface{}, d *PredicateDescriptor, input interface{}) (*Trace, error) {
+	var trace *Trace
+	pred, err := NewPredicateFactory(example, WithTrace(func(t *Trace) { trace = t })).Build(d)
+	if err != nil {
+		return nil, err
+	}
+	return trace, pred(input)
+}
+
+// traced wraps a node so that evaluations at a traced location add a trace of the node to the current one.
+func traced(d *PredicateDescriptor, pred internalPredicate) internalPredicate {
+	node := traceNodeName(d)
+	// Values are shown where they are extracted, which is the first node after a field step, and at leaves.
+	leaf := true
+	switch descriptorKind(d) {
+	case "and", "or", "not", "quantifier":
+		leaf = false
+	case "field":
+		leaf = d.Field.Descriptor != nil && d.Field.Descriptor.Base != nil && d.Field.Descriptor.Base.Reference != ""
+	}
+	return func(input reflect.Value, at location) []*Violation {
+		if at.trace == nil {
+			return pred(input, at)
+		}
+		t := &Trace{Node: node, Path: at.path}
+		if leaf || at.trace.Node == "" || at.path != at.trace.Path {
+			t.Value = formatValue(input)
+		}
+		at.trace.Children = append(at.trace.Children, t)
+		at.trace = t
+		violations := pred(input, at)
+		t.Passed = len(violations) == 0
+		t.Note = traceNote(d, t, violations)
+		return violations
+	}
+}
+
+func traceNodeName(d *PredicateDescriptor) string {
+	switch descriptorKind(d) {
+	case "field":
+		if child := d.Field.Descriptor; child != nil && child.Base != nil && child.Base.Reference != "" {
+			return describe(d)
+		}
+		return fmt.Sprintf("field %s", d.Field.Path)
+	case "quantifier":
+		q := d.Quantifier
+		path := displayPath(q.Path)
+		if q.Keys {
+			path = fmt.Sprintf("keys(%s)", path)
+		}
+		if q.Kind == AT_LEAST_QUANTIFIER || q.Kind == AT_MOST_QUANTIFIER {
+			return fmt.Sprintf("%s(%d, %s)", q.Kind, q.Count, path)
+		}
+		return fmt.Sprintf("%s(%s)", q.Kind, path)
+	case "and", "or", "not":
+		return descriptorKind(d)
+	}
+	return describe(d)
+}
+
+func traceNote(d *PredicateDescriptor, t *Trace, violations []*Violation) string {
+	switch descriptorKind(d) {
+	case "and":
+		if t.Passed {
+			return ""
+		}
+		first := -1
+		var others []string
+		for i, child := range t.Children {
+			switch {
+			case first >= 0:
+				child.ReportOnly = true
+				if !child.Passed {
+					others = append(others, fmt.Sprintf("and[%d]", i))
+				}
+			case !child.Passed:
+				first = i
+			}
+		}
+		if len(others) == 0 {
+			return fmt.Sprintf("stops at and[%d]", first)
+		}
+		return fmt.Sprintf("stops at and[%d], %s also failed", first, strings.Join(others, ", "))
+	case "or":
+		if !t.Passed {
+			return "no branch holds"
+		}
+		if len(t.Children) == 0 {
+			return ""
+		}
+		return fmt.Sprintf("or[%d] holds", len(t.Children)-1)
+	case "not":
+		return ""
+	}
+	if t.Passed || len(t.Children) != 0 || len(violations) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("expected %s, found %s", violations[0].Expected, violations[0].Actual)
+}
@@ -0,0 +1,81 @@
+package predicates
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func TestTrace(t *testing.T) {
+	d := Field("spec", Conjunction(
+		Disjunction(Field("hostname", StringValue("==a")), Field("hostname", StringValue("==b"))),
+		Field("priority", NumberValue(">=5")),
+		Exists("nodeName"),
+	))
+	priority := int32(1)
+	pod := &v1.Pod{Spec: v1.PodSpec{Hostname: "b", Priority: &priority}}
+	trace, err := Explain(v1.Pod{}, d, pod)
+	require.Error(t, err)
+	assert.Equal(t, strings.Join([]string{
+		`FAIL field spec at <root> = ` + formatValue(reflect.ValueOf(pod)),
+		`  FAIL and at spec = ` + formatValue(reflect.ValueOf(pod.Spec)) + ` (stops at and[1], and[2] also failed)`,
+		`    PASS or at spec (or[1] holds)`,
+		`      FAIL field hostname at spec`,
+		`        FAIL equal to ` + "`a`" + ` at spec.hostname = "b" (expected equal to ` + "`a`" + `, found "b")`,
+		`      PASS field hostname at spec`,
+		`        PASS equal to ` + "`b`" + ` at spec.hostname = "b"`,
+		`    FAIL field priority at spec`,
+		`      FAIL number >= 5 at spec.priority = 1 (expected number >= 5, found 1)`,
+		`    FAIL nodeName exists at spec = ` + formatValue(reflect.ValueOf(pod.Spec)) + ` (expected set, found "") [report only]`,
+	}, "\n")+"\n", trace.String())
+	assert.True(t, trace.Children[0].Children[2].ReportOnly)
+	assert.False(t, trace.Children[0].Children[1].ReportOnly)
+
+	// Branches after the one an And stops at are marked even when they pass.
+	pod.Spec.NodeName = "node"
+	trace, err = Explain(v1.Pod{}, d, pod)
+	require.Error(t, err)
+	assert.Equal(t, "stops at and[1]", trace.Children[0].Note)
+	assert.True(t, trace.Children[0].Children[2].Passed)
+	assert.True(t, trace.Children[0].Children[2].ReportOnly)
+
+	encoded, err := json.Marshal(trace)
+	require.NoError(t, err)
+	decoded := &Trace{}
+	require.NoError(t, json.Unmarshal(encoded, decoded))
+	assert.Equal(t, trace, decoded)
+}
+
+func TestTraceLivenessProbe(t *testing.T) {
+	var traces []*Trace
+	pred, err := NewPredicateFactory(v1.Pod{}, WithTrace(func(t *Trace) { traces = append(traces, t) })).Build(LivenessProbeDescriptor)
+	require.NoError(t, err)
+	probe := &v1.Probe{
+		Handler:             v1.Handler{TCPSocket: &v1.TCPSocketAction{Port: intstr.FromString("http")}},
+		InitialDelaySeconds: 5,
+	}
+	pod := &v1.Pod{Spec: v1.PodSpec{Containers: []v1.Container{{Name: "app", LivenessProbe: probe}}}}
+
+	// A named port is not a number, which the trace shows at the leaf that failed.
+	assert.Error(t, pred(pod))
+	require.Len(t, traces, 1)
+	text := traces[0].String()
+	assert.Contains(t, text, "FAIL or at spec.containers[0].livenessProbe (no branch holds)")
+	assert.Contains(t, text, `FAIL number >= 0 at spec.containers[0].livenessProbe.tcpSocket.port = http`)
+
+	probe.TCPSocket.Port = intstr.FromInt(8080)
+	assert.NoError(t, pred(pod))
+	require.Len(t, traces, 2)
+	assert.True(t, traces[1].Passed)
+	assert.Contains(t, traces[1].String(), "PASS or at spec.containers[0].livenessProbe (or[2] holds)")
+
+	// Predicates built without the option record nothing.
+	assert.NoError(t, HasLivenessProbe(pod))
+	assert.Len(t, traces, 2)
+}